@@ -0,0 +1,20 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go.mau.fi/util/exhttp"
+)
+
+func healthCheck(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	includeLogins := token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(m.Matrix.AS.Registration.ServerToken)) == 1
+	health := c.GetHealth(includeLogins)
+	statusCode := http.StatusOK
+	if !health.Healthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	exhttp.WriteJSONResponse(w, statusCode, health)
+}
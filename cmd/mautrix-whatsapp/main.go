@@ -42,6 +42,7 @@ func main() {
 		)
 	}
 	m.PostStart = func() {
+		m.Matrix.AS.Router.HandleFunc("/_matrix/mau/whatsapp/health", healthCheck).Methods(http.MethodGet)
 		if m.Matrix.Provisioning != nil {
 			m.Matrix.Provisioning.Router.HandleFunc("/v1/login", legacyProvLogin).Methods(http.MethodGet)
 			m.Matrix.Provisioning.Router.HandleFunc("/v1/logout", legacyProvLogout).Methods(http.MethodPost)
@@ -0,0 +1,134 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+const (
+	// profilePictureQueryInterval is the minimum time between two profile picture info queries.
+	profilePictureQueryInterval = 250 * time.Millisecond
+	profilePictureBackoffMin    = 1 * time.Minute
+	profilePictureBackoffMax    = 30 * time.Minute
+	deferredAvatarRetryInterval = 1 * time.Minute
+)
+
+var errProfilePictureRateLimited = errors.New("profile picture queries are rate limited")
+
+// getProfilePictureInfo wraps GetProfilePictureInfo with a limiter that spaces out queries and
+// backs off after WhatsApp responds with a rate limit error. While backing off, queries fail
+// immediately with errProfilePictureRateLimited so callers can defer the avatar instead.
+func (wa *WhatsAppClient) getProfilePictureInfo(ctx context.Context, jid types.JID, params *whatsmeow.GetProfilePictureParams) (*types.ProfilePictureInfo, error) {
+	wa.avatarLimitLock.Lock()
+	if time.Now().Before(wa.avatarBackoffUntil) {
+		wa.avatarLimitLock.Unlock()
+		return nil, errProfilePictureRateLimited
+	}
+	if wait := profilePictureQueryInterval - time.Since(wa.lastAvatarQuery); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			wa.avatarLimitLock.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+	wa.lastAvatarQuery = time.Now()
+	wa.avatarLimitLock.Unlock()
+
+	info, err := wa.Client.GetProfilePictureInfo(jid, params)
+	if errors.Is(err, whatsmeow.ErrIQRateOverLimit) {
+		wa.avatarLimitLock.Lock()
+		wa.avatarBackoff = min(max(wa.avatarBackoff*2, profilePictureBackoffMin), profilePictureBackoffMax)
+		wa.avatarBackoffUntil = time.Now().Add(wa.avatarBackoff)
+		backoff := wa.avatarBackoff
+		wa.avatarLimitLock.Unlock()
+		wa.profilePictureRateLimits.Add(1)
+		wa.UserLogin.Log.Warn().
+			Stringer("jid", jid).
+			Stringer("backoff", backoff).
+			Msg("Profile picture queries were rate limited, deferring avatar fetches")
+		return nil, fmt.Errorf("%w: %w", errProfilePictureRateLimited, err)
+	} else if err == nil || errors.Is(err, whatsmeow.ErrProfilePictureNotSet) || errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized) {
+		wa.avatarLimitLock.Lock()
+		wa.avatarBackoff = 0
+		wa.avatarLimitLock.Unlock()
+	}
+	return info, err
+}
+
+// deferAvatar marks the avatar of the given user or chat to be fetched again after the rate limit expires.
+func (wa *WhatsAppClient) deferAvatar(jid types.JID, isGhost bool) {
+	wa.avatarLimitLock.Lock()
+	defer wa.avatarLimitLock.Unlock()
+	if wa.deferredAvatars == nil {
+		wa.deferredAvatars = make(map[types.JID]bool)
+	}
+	wa.deferredAvatars[jid] = isGhost
+}
+
+func (wa *WhatsAppClient) popDeferredAvatars() map[types.JID]bool {
+	wa.avatarLimitLock.Lock()
+	defer wa.avatarLimitLock.Unlock()
+	if len(wa.deferredAvatars) == 0 || time.Now().Before(wa.avatarBackoffUntil) {
+		return nil
+	}
+	deferred := wa.deferredAvatars
+	wa.deferredAvatars = nil
+	return deferred
+}
+
+func (wa *WhatsAppClient) deferredAvatarLoop(ctx context.Context) {
+	ticker := time.NewTicker(deferredAvatarRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			wa.retryDeferredAvatars(ctx)
+		}
+	}
+}
+
+func (wa *WhatsAppClient) retryDeferredAvatars(ctx context.Context) {
+	deferred := wa.popDeferredAvatars()
+	if len(deferred) == 0 {
+		return
+	}
+	log := wa.UserLogin.Log.With().Str("action", "retry deferred avatars").Logger()
+	ctx = log.WithContext(ctx)
+	log.Debug().Int("count", len(deferred)).Msg("Retrying deferred avatar fetches")
+	for jid, isGhost := range deferred {
+		if ctx.Err() != nil {
+			return
+		}
+		if isGhost {
+			ghost, err := wa.Main.Bridge.GetExistingGhostByID(ctx, waid.MakeUserID(jid))
+			if err != nil {
+				log.Err(err).Stringer("jid", jid).Msg("Failed to get ghost to retry avatar")
+			} else if ghost != nil && wa.fetchGhostAvatar(ctx, ghost) {
+				err = wa.Main.Bridge.DB.Ghost.Update(ctx, ghost.Ghost)
+				if err != nil {
+					log.Err(err).Stringer("jid", jid).Msg("Failed to save ghost after retrying avatar")
+				}
+			}
+		} else {
+			portal, err := wa.Main.Bridge.GetExistingPortalByKey(ctx, wa.makeWAPortalKey(jid))
+			if err != nil {
+				log.Err(err).Stringer("jid", jid).Msg("Failed to get portal to retry avatar")
+			} else if portal != nil && portal.MXID != "" && wa.makePortalAvatarFetcher("", types.EmptyJID, time.Now())(ctx, portal) {
+				err = portal.Save(ctx)
+				if err != nil {
+					log.Err(err).Stringer("jid", jid).Msg("Failed to save portal after retrying avatar")
+				}
+			}
+		}
+	}
+}
@@ -18,12 +18,17 @@ import (
 	"go.mau.fi/whatsmeow/proto/waHistorySync"
 	"go.mau.fi/whatsmeow/proto/waWeb"
 	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
 	"google.golang.org/protobuf/proto"
 	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
 	"maunium.net/go/mautrix/bridgev2/networkid"
 	"maunium.net/go/mautrix/bridgev2/simplevent"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 
 	"go.mau.fi/mautrix-whatsapp/pkg/connector/wadb"
+	"go.mau.fi/mautrix-whatsapp/pkg/msgconv"
 	"go.mau.fi/mautrix-whatsapp/pkg/waid"
 )
 
@@ -72,6 +77,10 @@ func (wa *WhatsAppClient) handleWAHistorySync(ctx context.Context, evt *waHistor
 	ctx = log.WithContext(ctx)
 	if evt.GetGlobalSettings() != nil {
 		log.Debug().Interface("global_settings", evt.GetGlobalSettings()).Msg("Got global settings in history sync")
+		wa.updateDefaultDisappearingTimer(ctx, evt.GetGlobalSettings())
+	}
+	if len(evt.GetRecentStickers()) > 0 {
+		wa.storeRecentStickers(ctx, evt.GetRecentStickers())
 	}
 	if evt.GetSyncType() == waHistorySync.HistorySync_INITIAL_STATUS_V3 || evt.GetSyncType() == waHistorySync.HistorySync_PUSH_NAME || evt.GetSyncType() == waHistorySync.HistorySync_NON_BLOCKING_DATA {
 		log.Debug().
@@ -84,9 +93,28 @@ func (wa *WhatsAppClient) handleWAHistorySync(ctx context.Context, evt *waHistor
 		return
 	}
 
-	// Check if 24 hours have passed since the last sync
+	if evt.GetSyncType() == waHistorySync.HistorySync_ON_DEMAND {
+		wa.handleOnDemandHistorySync(ctx, evt)
+		return
+	}
+
 	loginMetadata := wa.UserLogin.Metadata.(*waid.UserLoginMetadata)
-	if !loginMetadata.LastHistorySync.IsZero() {
+	syncType := evt.GetSyncType().String()
+	if evt.GetChunkOrder() == 1 && loginMetadata.HistorySyncCursor != nil {
+		// The first chunk means WhatsApp started a new sync, so the cursor of any earlier sync is no longer relevant
+		loginMetadata.HistorySyncCursor = nil
+	}
+	resuming := loginMetadata.HistorySyncCursor.InProgress(syncType)
+	if loginMetadata.HistorySyncCursor.Covers(syncType, evt.GetChunkOrder()) {
+		log.Info().
+			Uint32("cursor_chunk_order", loginMetadata.HistorySyncCursor.ChunkOrder).
+			Msg("Skipping history sync chunk that was already stored")
+		return
+	}
+
+	// Check if 24 hours have passed since the last sync
+	// (chunks continuing a sync that was already started aren't subject to the limit)
+	if !resuming && !loginMetadata.LastHistorySync.IsZero() {
 		lastSyncTime := loginMetadata.LastHistorySync.Time
 		if time.Since(lastSyncTime) < 24*time.Hour {
 			timeSinceLastSync := time.Since(lastSyncTime)
@@ -106,6 +134,9 @@ func (wa *WhatsAppClient) handleWAHistorySync(ctx context.Context, evt *waHistor
 		Int("conversation_count", len(evt.GetConversations())).
 		Int("past_participant_count", len(evt.GetPastParticipants())).
 		Msg("Storing history sync")
+	if !resuming {
+		wa.sendConnectionNotice(ctx, true, "WhatsApp history sync started, chats will be backfilled as the sync progresses")
+	}
 	successfullySavedTotal := 0
 	failedToSaveTotal := 0
 	totalMessageCount := 0
@@ -156,6 +187,10 @@ func (wa *WhatsAppClient) handleWAHistorySync(ctx context.Context, evt *waHistor
 				maxTimeIndex = i
 			}
 
+			if payInfo := rawMsg.GetMessage().GetPaymentInfo(); payInfo != nil {
+				wa.queuePaymentStatusUpdate(ctx, msgEvt, payInfo)
+			}
+
 			msgType := getMessageType(msgEvt.Message)
 			if msgType == "ignore" || strings.HasPrefix(msgType, "unknown_protocol_") {
 				ignoredTypes++
@@ -211,6 +246,22 @@ func (wa *WhatsAppClient) handleWAHistorySync(ctx context.Context, evt *waHistor
 		Int("total_message_count", totalMessageCount).
 		Msg("Finished storing history sync")
 
+	// Only advance the cursor once the chunk has been stored. Messages are inserted with
+	// ON CONFLICT DO NOTHING, so reprocessing a partially stored chunk won't duplicate anything.
+	loginMetadata.HistorySyncCursor = &waid.HistorySyncCursor{
+		SyncType:   syncType,
+		ChunkOrder: evt.GetChunkOrder(),
+		Progress:   evt.GetProgress(),
+		UpdatedAt:  jsontime.UnixNow(),
+	}
+	err := wa.UserLogin.Save(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to save history sync cursor")
+	}
+	if evt.GetProgress() >= 100 {
+		wa.sendConnectionNotice(ctx, true, "WhatsApp history sync finished")
+	}
+
 	// Update last sync time
 	loginMetadata.LastHistorySync = jsontime.Unix{Time: time.Now()}
 	// We don't need to explicitly save the metadata as it's stored in the UserLogin object
@@ -218,6 +269,208 @@ func (wa *WhatsAppClient) handleWAHistorySync(ctx context.Context, evt *waHistor
 	log.Info().Time("last_history_sync", time.Now()).Msg("LastHistorySync time has been updated to force WhatsApp sync")
 }
 
+const (
+	historyRequestBatchSize  = 50
+	historyRequestMaxBatches = 20
+	historyRequestMaxDays    = 365
+	// historyRequestTimeout is how long to wait for the phone to respond to a single history request batch.
+	historyRequestTimeout = 5 * time.Minute
+)
+
+type historyRequest struct {
+	cutoff   time.Time
+	batches  int
+	messages []*events.Message
+	// roomID is where the result of the request is reported, usually the room the command was sent in
+	roomID  id.RoomID
+	timeout *time.Timer
+}
+
+// requestHistory asks the primary device for messages older than the given anchor message.
+// More batches are requested automatically until the cutoff is reached, see handleOnDemandHistorySync.
+func (wa *WhatsAppClient) requestHistory(ctx context.Context, anchor *types.MessageInfo, req *historyRequest) error {
+	wa.historyRequestsLock.Lock()
+	wa.historyRequests[anchor.Chat] = req
+	req.batches++
+	batch := req.batches
+	if req.timeout != nil {
+		req.timeout.Stop()
+	}
+	req.timeout = time.AfterFunc(historyRequestTimeout, func() {
+		wa.expireHistoryRequest(anchor.Chat, req, batch)
+	})
+	wa.historyRequestsLock.Unlock()
+	_, err := wa.Client.SendMessage(
+		ctx,
+		wa.JID.ToNonAD(),
+		wa.Client.BuildHistorySyncRequest(anchor, historyRequestBatchSize),
+		whatsmeow.SendRequestExtra{Peer: true},
+	)
+	if err != nil {
+		wa.historyRequestsLock.Lock()
+		if wa.historyRequests[anchor.Chat] == req {
+			delete(wa.historyRequests, anchor.Chat)
+		}
+		req.timeout.Stop()
+		wa.historyRequestsLock.Unlock()
+	}
+	return err
+}
+
+// expireHistoryRequest removes a history request if the phone hasn't responded to the given batch in time.
+// Messages received in earlier batches are still bridged.
+func (wa *WhatsAppClient) expireHistoryRequest(jid types.JID, req *historyRequest, batch int) {
+	wa.historyRequestsLock.Lock()
+	if wa.historyRequests[jid] != req || req.batches != batch {
+		wa.historyRequestsLock.Unlock()
+		return
+	}
+	delete(wa.historyRequests, jid)
+	wa.historyRequestsLock.Unlock()
+	wa.UserLogin.Log.Warn().
+		Stringer("chat_jid", jid).
+		Int("batch", batch).
+		Msg("Timed out waiting for requested history batch")
+	if len(req.messages) == 0 {
+		wa.sendHistoryRequestNotice(req, "Your phone didn't respond to the history request in time.")
+		return
+	}
+	wa.dispatchRequestedHistory(jid, req)
+}
+
+// sendHistoryRequestNotice reports the result of a history request. The command that started the
+// request has already returned by the time the phone responds, so this doesn't use the command event.
+func (wa *WhatsAppClient) sendHistoryRequestNotice(req *historyRequest, message string, args ...any) {
+	ctx := wa.UserLogin.Log.WithContext(context.Background())
+	_, err := wa.Main.Bridge.Bot.SendMessage(ctx, req.roomID, event.EventMessage, &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    fmt.Sprintf(message, args...),
+		},
+	}, nil)
+	if err != nil {
+		wa.UserLogin.Log.Err(err).Stringer("room_id", req.roomID).Msg("Failed to send history request notice")
+	}
+}
+
+func (wa *WhatsAppClient) handleOnDemandHistorySync(ctx context.Context, evt *waHistorySync.HistorySync) {
+	log := zerolog.Ctx(ctx)
+	for _, conv := range evt.GetConversations() {
+		jid, err := types.ParseJID(conv.GetID())
+		if err != nil {
+			log.Warn().Err(err).Str("chat_jid", conv.GetID()).Msg("Failed to parse chat JID in on-demand history sync")
+			continue
+		}
+		wa.historyRequestsLock.Lock()
+		req, ok := wa.historyRequests[jid]
+		if ok {
+			delete(wa.historyRequests, jid)
+			req.timeout.Stop()
+		}
+		wa.historyRequestsLock.Unlock()
+		if !ok {
+			log.Debug().Stringer("chat_jid", jid).Msg("Ignoring on-demand history sync for chat that wasn't requested")
+			continue
+		}
+		var oldest *types.MessageInfo
+		newCount := 0
+		for _, rawMsg := range conv.GetMessages() {
+			msgEvt, err := wa.Client.ParseWebMessage(jid, rawMsg.GetMessage())
+			if err != nil {
+				log.Warn().Err(err).
+					Str("msg_id", rawMsg.GetMessage().GetKey().GetID()).
+					Msg("Dropping requested historical message due to parse error")
+				continue
+			}
+			if oldest == nil || msgEvt.Info.Timestamp.Before(oldest.Timestamp) {
+				oldest = &msgEvt.Info
+			}
+			if msgEvt.Info.Timestamp.Before(req.cutoff) {
+				continue
+			}
+			existing, err := wa.Main.Bridge.DB.Message.GetFirstPartByID(ctx, wa.UserLogin.ID, waid.MakeMessageID(jid, msgEvt.Info.Sender, msgEvt.Info.ID))
+			if err != nil {
+				log.Err(err).Str("msg_id", msgEvt.Info.ID).Msg("Failed to check if requested historical message is already bridged")
+				continue
+			} else if existing != nil {
+				continue
+			}
+			req.messages = append(req.messages, msgEvt)
+			newCount++
+		}
+		log.Debug().
+			Stringer("chat_jid", jid).
+			Int("batch", req.batches).
+			Int("msg_count", len(conv.GetMessages())).
+			Int("new_msg_count", newCount).
+			Msg("Received requested history batch")
+		if oldest != nil && oldest.Timestamp.After(req.cutoff) && req.batches < historyRequestMaxBatches {
+			err = wa.requestHistory(ctx, oldest, req)
+			if err == nil {
+				continue
+			}
+			log.Err(err).Stringer("chat_jid", jid).Msg("Failed to request next history batch")
+		}
+		wa.dispatchRequestedHistory(jid, req)
+	}
+}
+
+func (wa *WhatsAppClient) dispatchRequestedHistory(jid types.JID, req *historyRequest) {
+	if len(req.messages) == 0 {
+		wa.sendHistoryRequestNotice(req, "WhatsApp didn't send any messages that weren't already bridged.")
+		return
+	}
+	slices.SortFunc(req.messages, func(a, b *events.Message) int {
+		return a.Info.Timestamp.Compare(b.Info.Timestamp)
+	})
+	for _, msg := range req.messages {
+		wa.handleWAMessage(msg)
+	}
+	wa.UserLogin.Log.Info().
+		Stringer("chat_jid", jid).
+		Int("msg_count", len(req.messages)).
+		Msg("Queued requested history for bridging")
+	wa.sendHistoryRequestNotice(req, "Bridging %d older messages received from WhatsApp.", len(req.messages))
+}
+
+func (wa *WhatsAppClient) storeRecentStickers(ctx context.Context, stickers []*waHistorySync.StickerMetadata) {
+	saved := 0
+	for _, meta := range stickers {
+		if len(meta.GetFileSHA256()) == 0 || len(meta.GetMediaKey()) == 0 || meta.GetDirectPath() == "" {
+			continue
+		}
+		err := wa.Main.DB.Sticker.Put(ctx, wadb.NewSticker(wa.UserLogin.ID, meta))
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Msg("Failed to save recent sticker")
+		} else {
+			saved++
+		}
+	}
+	zerolog.Ctx(ctx).Debug().
+		Int("sticker_count", len(stickers)).
+		Int("saved_count", saved).
+		Msg("Stored recent stickers from history sync")
+}
+
+func (wa *WhatsAppClient) updateDefaultDisappearingTimer(ctx context.Context, settings *waHistorySync.GlobalSettings) {
+	loginMeta := wa.UserLogin.Metadata.(*waid.UserLoginMetadata)
+	if settings.DisappearingModeTimestamp == nil || settings.GetDisappearingModeTimestamp() <= loginMeta.DefaultDisappearingTimerSetAt {
+		return
+	}
+	loginMeta.DefaultDisappearingTimer = uint32(max(settings.GetDisappearingModeDuration(), 0))
+	loginMeta.DefaultDisappearingTimerSetAt = settings.GetDisappearingModeTimestamp()
+	err := wa.UserLogin.Save(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to save default disappearing timer")
+	}
+}
+
+// getDefaultDisappearingTimer returns the user's default disappearing message timer.
+// whatsmeow can't fetch it directly, so it's read from the global settings in history syncs.
+func (wa *WhatsAppClient) getDefaultDisappearingTimer() time.Duration {
+	return time.Duration(wa.UserLogin.Metadata.(*waid.UserLoginMetadata).DefaultDisappearingTimer) * time.Second
+}
+
 func (wa *WhatsAppClient) createPortalsFromHistorySync(ctx context.Context) {
 	// Log that sync with WhatsApp has started
 	wa.UserLogin.Log.Info().Msg("Syncing with WhatsApp started")
@@ -233,6 +486,20 @@ func (wa *WhatsAppClient) createPortalsFromHistorySync(ctx context.Context) {
 		log.Err(err).Msg("Failed to get recent conversations from database")
 		return
 	}
+	if maxAge := wa.Main.Config.HistorySync.MaxInitialConversationAge; maxAge > 0 {
+		cutoff := time.Now().AddDate(0, 0, -maxAge)
+		// Conversations are sorted by last message timestamp, so everything after the first old one is old too
+		tooOld := slices.IndexFunc(conversations, func(conv *wadb.Conversation) bool {
+			return conv.LastMessageTimestamp.Before(cutoff)
+		})
+		if tooOld >= 0 {
+			log.Debug().
+				Int("skipped_count", len(conversations)-tooOld).
+				Time("cutoff", cutoff).
+				Msg("Skipping conversations that are older than the initial conversation age limit")
+			conversations = conversations[:tooOld]
+		}
+	}
 	log.Info().Int("conversation_count", len(conversations)).Msg("Creating portals from history sync")
 	rateLimitErrors := 0
 	var wg sync.WaitGroup
@@ -249,6 +516,10 @@ func (wa *WhatsAppClient) createPortalsFromHistorySync(ctx context.Context) {
 		if conv.ChatJID == types.StatusBroadcastJID && !wa.Main.Config.EnableStatusBroadcast {
 			wg.Done()
 			continue
+		} else if !wa.Main.Config.ChatFilter.Allows(conv.ChatJID) {
+			log.Debug().Stringer("chat_jid", conv.ChatJID).Msg("Skipping creating room because the chat is filtered out")
+			wg.Done()
+			continue
 		}
 		// TODO can the chat info fetch be avoided entirely?
 		time.Sleep(time.Duration(rateLimitErrors) * time.Second)
@@ -272,7 +543,12 @@ func (wa *WhatsAppClient) createPortalsFromHistorySync(ctx context.Context) {
 			log.Err(err).Stringer("chat_jid", conv.ChatJID).
 				Int("error_count", rateLimitErrors).
 				Msg("Ratelimit error getting chat info, retrying after sleep")
-			time.Sleep(time.Duration(rateLimitErrors) * time.Minute)
+			select {
+			case <-time.After(time.Duration(rateLimitErrors) * time.Minute):
+			case <-ctx.Done():
+				log.Warn().Err(ctx.Err()).Msg("Context cancelled while waiting for ratelimit, stopping history sync portal creation")
+				return
+			}
 			continue
 		} else if err != nil {
 			log.Err(err).Stringer("chat_jid", conv.ChatJID).Msg("Failed to get chat info")
@@ -314,6 +590,15 @@ func (wa *WhatsAppClient) FetchMessages(ctx context.Context, params bridgev2.Fet
 	if err != nil {
 		return nil, err
 	}
+	portalMeta := params.Portal.Metadata.(*waid.PortalMetadata)
+	if portalMeta.BackfillDisabled || (portalMeta.MaxBackfillMessages > 0 && !params.Forward) {
+		return &bridgev2.FetchMessagesResponse{
+			HasMore: false,
+			Forward: params.Forward,
+		}, nil
+	} else if portalMeta.MaxBackfillMessages > 0 {
+		params.Count = min(params.Count, portalMeta.MaxBackfillMessages)
+	}
 	var markRead bool
 	var startTime, endTime *time.Time
 	if params.Forward {
@@ -368,7 +653,7 @@ func (wa *WhatsAppClient) FetchMessages(ctx context.Context, params bridgev2.Fet
 		}
 		var mediaReq *wadb.MediaRequest
 		isViewOnce := evt.IsViewOnce || evt.IsViewOnceV2 || evt.IsViewOnceV2Extension
-		convertedMessages[i], mediaReq = wa.convertHistorySyncMessage(ctx, params.Portal, &evt.Info, evt.Message, isViewOnce, msg.Reactions)
+		convertedMessages[i], mediaReq = wa.convertHistorySyncMessage(ctx, params.Portal, &evt.Info, evt.Message, isViewOnce, msg.Reactions, msg.GetPaymentInfo())
 		if mediaReq != nil {
 			mediaRequests = append(mediaRequests, mediaReq)
 		}
@@ -413,12 +698,16 @@ func (wa *WhatsAppClient) FetchMessages(ctx context.Context, params bridgev2.Fet
 }
 
 func (wa *WhatsAppClient) convertHistorySyncMessage(
-	ctx context.Context, portal *bridgev2.Portal, info *types.MessageInfo, msg *waE2E.Message, isViewOnce bool, reactions []*waWeb.Reaction,
+	ctx context.Context, portal *bridgev2.Portal, info *types.MessageInfo, msg *waE2E.Message, isViewOnce bool, reactions []*waWeb.Reaction, payInfo *waWeb.PaymentInfo,
 ) (*bridgev2.BackfillMessage, *wadb.MediaRequest) {
 	// TODO use proper intent
 	intent := wa.Main.Bridge.Bot
+	converted := wa.Main.MsgConv.ToMatrix(ctx, portal, wa.Client, intent, msg, info, isViewOnce, nil)
+	if payInfo != nil && len(converted.Parts) > 0 {
+		msgconv.ApplyPaymentInfo(converted.Parts[0], payInfo)
+	}
 	wrapped := &bridgev2.BackfillMessage{
-		ConvertedMessage: wa.Main.MsgConv.ToMatrix(ctx, portal, wa.Client, intent, msg, info, isViewOnce, nil),
+		ConvertedMessage: converted,
 		Sender:           wa.makeEventSender(info.Sender),
 		ID:               waid.MakeMessageID(info.Chat, info.Sender, info.ID),
 		TxnID:            networkid.TransactionID(waid.MakeMessageID(info.Chat, info.Sender, info.ID)),
@@ -448,3 +737,55 @@ func (wa *WhatsAppClient) convertHistorySyncMessage(
 	}
 	return wrapped, mediaReq
 }
+
+type paymentStatusUpdate struct {
+	evt     *events.Message
+	payInfo *waWeb.PaymentInfo
+}
+
+// queuePaymentStatusUpdate edits the notice of an already bridged payment message when history sync
+// includes its current status. WhatsApp doesn't send payment status changes as regular messages,
+// so this is the only place where they can be seen.
+func (wa *WhatsAppClient) queuePaymentStatusUpdate(ctx context.Context, evt *events.Message, payInfo *waWeb.PaymentInfo) {
+	msgID := waid.MakeMessageID(evt.Info.Chat, evt.Info.Sender, evt.Info.ID)
+	existing, err := wa.Main.Bridge.DB.Message.GetFirstPartByID(ctx, wa.UserLogin.ID, msgID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("message_id", string(msgID)).Msg("Failed to get payment message to update status")
+		return
+	} else if existing == nil {
+		return
+	}
+	wa.UserLogin.QueueRemoteEvent(&simplevent.Message[*paymentStatusUpdate]{
+		EventMeta: simplevent.EventMeta{
+			Type: bridgev2.RemoteEventEdit,
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("action", "update payment status").Str("message_id", string(msgID))
+			},
+			PortalKey: existing.Room,
+			Sender:    wa.makeEventSender(evt.Info.Sender),
+			Timestamp: evt.Info.Timestamp,
+		},
+		Data:            &paymentStatusUpdate{evt: evt, payInfo: payInfo},
+		TargetMessage:   msgID,
+		ConvertEditFunc: wa.convertPaymentStatusUpdate,
+	})
+}
+
+func (wa *WhatsAppClient) convertPaymentStatusUpdate(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, existing []*database.Message, update *paymentStatusUpdate) (*bridgev2.ConvertedEdit, error) {
+	converted := wa.Main.MsgConv.ToMatrix(ctx, portal, wa.Client, intent, update.evt.Message, &update.evt.Info, false, nil)
+	if len(converted.Parts) == 0 || !msgconv.ApplyPaymentInfo(converted.Parts[0], update.payInfo) {
+		return nil, fmt.Errorf("%w: message is not a payment", bridgev2.ErrIgnoringRemoteEvent)
+	}
+	part := converted.Parts[0]
+	meta := existing[0].Metadata.(*waid.MessageMetadata)
+	newStatus := part.DBMetadata.(*waid.MessageMetadata).PaymentStatus
+	if newStatus == "" || newStatus == meta.PaymentStatus {
+		return nil, fmt.Errorf("%w: payment status didn't change", bridgev2.ErrIgnoringRemoteEvent)
+	}
+	meta.PaymentStatus = newStatus
+	// Only the payment status is updated, the rest of the existing metadata is kept as-is
+	part.DBMetadata = nil
+	return &bridgev2.ConvertedEdit{
+		ModifiedParts: []*bridgev2.ConvertedEditPart{part.ToEditPart(existing[0])},
+	}, nil
+}
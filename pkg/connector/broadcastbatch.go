@@ -0,0 +1,89 @@
+package connector
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/event"
+)
+
+// broadcastBatchWindow is how long to wait for more copies of an outgoing broadcast list message
+// before posting the summary notice.
+const broadcastBatchWindow = 10 * time.Second
+
+type broadcastBatch struct {
+	listJID    types.JID
+	preview    string
+	recipients []types.JID
+}
+
+// trackBroadcastCopy collects the copies of an outgoing broadcast list message. Sending to a list
+// from the phone delivers one copy per recipient to linked devices. Instead of bridging each copy
+// into the DM portal of its recipient, the copies are aggregated into a single notice. Lists don't
+// have portals (see getPortalKeyByMessageSource), so the notice is sent to the management room.
+//
+// Returns false if the copy couldn't be aggregated and should be bridged normally.
+func (wa *WhatsAppClient) trackBroadcastCopy(info types.MessageInfo, msgType string, msg *waE2E.Message) bool {
+	if wa.UserLogin.User.ManagementRoom == "" {
+		return false
+	}
+	wa.broadcastBatchLock.Lock()
+	defer wa.broadcastBatchLock.Unlock()
+	if wa.broadcastBatches == nil {
+		wa.broadcastBatches = make(map[types.MessageID]*broadcastBatch)
+	}
+	batch, ok := wa.broadcastBatches[info.ID]
+	if !ok {
+		batch = &broadcastBatch{listJID: info.Chat, preview: broadcastPreview(msgType, msg)}
+		wa.broadcastBatches[info.ID] = batch
+		time.AfterFunc(broadcastBatchWindow, func() {
+			wa.flushBroadcastBatch(info.ID)
+		})
+	}
+	batch.recipients = append(batch.recipients, info.BroadcastListOwner.ToNonAD())
+	return true
+}
+
+func broadcastPreview(msgType string, msg *waE2E.Message) string {
+	text := cmp.Or(msg.GetConversation(), msg.GetExtendedTextMessage().GetText())
+	if text == "" {
+		return msgType
+	}
+	return fmt.Sprintf("%q", text)
+}
+
+func (wa *WhatsAppClient) flushBroadcastBatch(id types.MessageID) {
+	wa.broadcastBatchLock.Lock()
+	batch, ok := wa.broadcastBatches[id]
+	delete(wa.broadcastBatches, id)
+	wa.broadcastBatchLock.Unlock()
+	if !ok || len(batch.recipients) == 0 {
+		return
+	}
+	recipients := make([]string, len(batch.recipients))
+	for i, jid := range batch.recipients {
+		recipients[i] = "+" + jid.User
+	}
+	message := fmt.Sprintf(
+		"%d copies of your broadcast list message (%s) were delivered: %s",
+		len(batch.recipients), batch.preview, strings.Join(recipients, ", "),
+	)
+	ctx := wa.UserLogin.Log.WithContext(context.Background())
+	_, err := wa.Main.Bridge.Bot.SendMessage(ctx, wa.UserLogin.User.ManagementRoom, event.EventMessage, &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    message,
+		},
+	}, nil)
+	if err != nil {
+		wa.UserLogin.Log.Warn().Err(err).
+			Str("message_id", id).
+			Stringer("list_jid", batch.listJID).
+			Msg("Failed to send broadcast list delivery notice")
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"go.mau.fi/util/ffmpeg"
 	"go.mau.fi/util/jsontime"
 	"go.mau.fi/util/ptr"
-
+	"go.mau.fi/whatsmeow/types"
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/event"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
 )
 
 var WhatsAppGeneralCaps = &bridgev2.NetworkGeneralCapabilities{
@@ -22,7 +24,7 @@ func (wa *WhatsAppConnector) GetCapabilities() *bridgev2.NetworkGeneralCapabilit
 }
 
 func (wa *WhatsAppConnector) GetBridgeInfoVersion() (info, caps int) {
-	return 1, 1
+	return 1, 2
 }
 
 const WAMaxFileSize = 2000 * 1024 * 1024
@@ -148,6 +150,57 @@ var whatsappCaps = &event.RoomFeatures{
 	TypingNotifications: true,
 }
 
+func deriveCaps(idSuffix string, modify func(caps *event.RoomFeatures)) *event.RoomFeatures {
+	caps := *whatsappCaps
+	caps.ID += idSuffix
+	modify(&caps)
+	return &caps
+}
+
+// Only admins can post in channels, other followers can just react.
+var newsletterCaps = deriveCaps("+newsletter", func(caps *event.RoomFeatures) {
+	caps.Formatting = nil
+	caps.File = nil
+	caps.MaxTextLength = 0
+	caps.LocationMessage = event.CapLevelRejected
+	caps.Poll = event.CapLevelRejected
+	caps.Reply = event.CapLevelRejected
+	caps.Edit = event.CapLevelRejected
+	caps.EditMaxCount = 0
+	caps.EditMaxAge = nil
+	caps.Delete = event.CapLevelRejected
+	caps.DeleteMaxAge = nil
+	caps.ReadReceipts = false
+	caps.TypingNotifications = false
+})
+
+var newsletterAdminCaps = deriveCaps("+newsletter_admin", func(caps *event.RoomFeatures) {
+	caps.Reply = event.CapLevelRejected
+	caps.ReadReceipts = false
+	caps.TypingNotifications = false
+})
+
+var statusBroadcastCaps = deriveCaps("+status", func(caps *event.RoomFeatures) {
+	caps.Poll = event.CapLevelRejected
+	caps.Edit = event.CapLevelRejected
+	caps.EditMaxCount = 0
+	caps.EditMaxAge = nil
+	caps.Reaction = event.CapLevelRejected
+	caps.ReactionCount = 0
+	caps.TypingNotifications = false
+})
+
 func (wa *WhatsAppClient) GetCapabilities(ctx context.Context, portal *bridgev2.Portal) *event.RoomFeatures {
-	return whatsappCaps
+	jid, _ := waid.ParsePortalID(portal.ID)
+	switch {
+	case jid == types.StatusBroadcastJID:
+		return statusBroadcastCaps
+	case jid.Server == types.NewsletterServer:
+		if canPostInNewsletter(types.NewsletterRole(portal.Metadata.(*waid.PortalMetadata).NewsletterRole)) {
+			return newsletterAdminCaps
+		}
+		return newsletterCaps
+	default:
+		return whatsappCaps
+	}
 }
@@ -0,0 +1,51 @@
+package connector
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/event"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+// ChatCategory is a finer-grained chat type than the Matrix room type. The room type must stay one of the
+// standard values for Matrix compatibility, so the category is exposed in a separate state event.
+type ChatCategory string
+
+const (
+	ChatCategoryDirect          ChatCategory = "direct"
+	ChatCategoryGroup           ChatCategory = "group"
+	ChatCategoryCommunity       ChatCategory = "community"
+	ChatCategoryNewsletter      ChatCategory = "newsletter"
+	ChatCategoryBroadcastList   ChatCategory = "broadcast_list"
+	ChatCategoryStatusBroadcast ChatCategory = "status_broadcast"
+)
+
+var StateChatCategory = event.Type{Type: "fi.mau.whatsapp.chat_category", Class: event.StateEventType}
+
+type ChatCategoryEventContent struct {
+	Category ChatCategory `json:"category"`
+}
+
+// updateChatCategory sends the chat category state event if it has changed.
+// The category is only stored after the state event is sent, so rooms that didn't exist yet get it on the next resync.
+func updateChatCategory(category ChatCategory) func(context.Context, *bridgev2.Portal) bool {
+	return func(ctx context.Context, portal *bridgev2.Portal) bool {
+		meta := portal.Metadata.(*waid.PortalMetadata)
+		if portal.MXID == "" || meta.ChatCategory == string(category) {
+			return false
+		}
+		_, err := portal.Bridge.Bot.SendState(ctx, portal.MXID, StateChatCategory, "", &event.Content{
+			Parsed: &ChatCategoryEventContent{Category: category},
+		}, time.Now())
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Str("chat_category", string(category)).Msg("Failed to send chat category state event")
+			return false
+		}
+		meta.ChatCategory = string(category)
+		return true
+	}
+}
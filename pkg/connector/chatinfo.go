@@ -16,6 +16,7 @@ import (
 	"maunium.net/go/mautrix/bridgev2/database"
 	"maunium.net/go/mautrix/bridgev2/networkid"
 	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 
 	"go.mau.fi/mautrix-whatsapp/pkg/connector/wadb"
 	"go.mau.fi/mautrix-whatsapp/pkg/waid"
@@ -45,6 +46,13 @@ func (wa *WhatsAppClient) getChatInfo(ctx context.Context, portalJID types.JID,
 			return nil, err
 		}
 		wrapped = wa.wrapGroupInfo(info)
+		wa.storeLIDMappings(info.Participants)
+		if info.IsJoinApprovalRequired {
+			wa.addPendingGroupMembers(ctx, info.JID, wrapped.Members)
+		}
+		if isCommunityAnnouncementGroup(info) {
+			wa.addCommunityMembers(ctx, info.LinkedParentJID, wrapped.Members)
+		}
 		wrapped.ExtraUpdates = bridgev2.MergeExtraUpdaters(wrapped.ExtraUpdates, updatePortalLastSyncAt)
 	case types.NewsletterServer:
 		info, err := wa.Client.GetNewsletterInfo(portalJID)
@@ -52,6 +60,7 @@ func (wa *WhatsAppClient) getChatInfo(ctx context.Context, portalJID types.JID,
 			return nil, err
 		}
 		wrapped = wa.wrapNewsletterInfo(info)
+		wrapped.ExtraUpdates = bridgev2.MergeExtraUpdaters(wrapped.ExtraUpdates, updatePortalLastSyncAt)
 	default:
 		return nil, fmt.Errorf("unsupported server %s", portalJID.Server)
 	}
@@ -64,10 +73,46 @@ func (wa *WhatsAppClient) getChatInfo(ctx context.Context, portalJID types.JID,
 	if conv != nil {
 		wa.applyHistoryInfo(wrapped, conv)
 	}
+	if portalJID == wa.JID.ToNonAD() && wrapped.Disappear == nil {
+		// The self-chat doesn't get a timer from anywhere else, so fall back to the default timer
+		if timer := wa.getDefaultDisappearingTimer(); timer > 0 {
+			wrapped.Disappear = &database.DisappearingSetting{
+				Type:  database.DisappearingTypeAfterSend,
+				Timer: timer,
+			}
+		}
+	}
 	wa.applyChatSettings(ctx, portalJID, wrapped)
+	wrapped.ExtraUpdates = bridgev2.MergeExtraUpdaters(wrapped.ExtraUpdates, reapplyPortalEncryption)
 	return wrapped, nil
 }
 
+// reapplyPortalEncryption enables encryption in portal rooms where the user has requested it
+// with the set-encryption command, e.g. if the room was recreated after that.
+func reapplyPortalEncryption(ctx context.Context, portal *bridgev2.Portal) bool {
+	meta := portal.Metadata.(*waid.PortalMetadata)
+	if !meta.Encrypted || portal.MXID == "" || meta.EncryptedRoomID == portal.MXID {
+		return false
+	}
+	err := enablePortalEncryption(ctx, portal)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to re-enable encryption in portal room")
+		return false
+	}
+	return true
+}
+
+func enablePortalEncryption(ctx context.Context, portal *bridgev2.Portal) error {
+	_, err := portal.Bridge.Bot.SendState(ctx, portal.MXID, event.StateEncryption, "", &event.Content{
+		Parsed: &event.EncryptionEventContent{Algorithm: id.AlgorithmMegolmV1},
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+	portal.Metadata.(*waid.PortalMetadata).EncryptedRoomID = portal.MXID
+	return nil
+}
+
 func updatePortalLastSyncAt(_ context.Context, portal *bridgev2.Portal) bool {
 	meta := portal.Metadata.(*waid.PortalMetadata)
 	forceSave := time.Since(meta.LastSync.Time) > 24*time.Hour
@@ -86,10 +131,59 @@ func updateDisappearingTimerSetAt(ts int64) bridgev2.ExtraUpdater[*bridgev2.Port
 	}
 }
 
+// updateNewsletterSubscriberCount stores the subscriber count in the portal metadata.
+// The portal is only saved if the count changed meaningfully to avoid unnecessary database writes.
+func updateNewsletterSubscriberCount(count int) bridgev2.ExtraUpdater[*bridgev2.Portal] {
+	return func(_ context.Context, portal *bridgev2.Portal) bool {
+		meta := portal.Metadata.(*waid.PortalMetadata)
+		diff := count - meta.SubscriberCount
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff == 0 || (diff < 10 && diff*100 < meta.SubscriberCount) {
+			return false
+		}
+		meta.SubscriberCount = count
+		return true
+	}
+}
+
+// updateNewsletterRole stores the user's own role in a newsletter in the portal metadata.
+func updateNewsletterRole(role types.NewsletterRole) bridgev2.ExtraUpdater[*bridgev2.Portal] {
+	return func(_ context.Context, portal *bridgev2.Portal) bool {
+		meta := portal.Metadata.(*waid.PortalMetadata)
+		if meta.NewsletterRole == string(role) {
+			return false
+		}
+		meta.NewsletterRole = string(role)
+		return true
+	}
+}
+
+func newsletterRolePowerLevel(role types.NewsletterRole) int {
+	switch role {
+	case types.NewsletterRoleAdmin:
+		return adminPL
+	case types.NewsletterRoleOwner:
+		return superAdminPL
+	default:
+		return defaultPL
+	}
+}
+
+// applyChatSettings fills the user-local portal info (mute and tag) from the chat settings store.
+//
+// If the store fails or doesn't have the chat, any info already filled from the history sync
+// or the chat metadata is kept. A nil UserLocal is simply skipped by bridgev2, so the rest of
+// the chat info is still applied and the portal gets created with the default settings.
 func (wa *WhatsAppClient) applyChatSettings(ctx context.Context, chatID types.JID, info *bridgev2.ChatInfo) {
 	chat, err := wa.GetStore().ChatSettings.GetChatSettings(chatID)
 	if err != nil {
-		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to get chat settings")
+		zerolog.Ctx(ctx).Warn().Err(err).
+			Bool("has_fallback_info", info.UserLocal != nil).
+			Msg("Failed to get chat settings")
+		return
+	} else if !chat.Found && info.UserLocal != nil {
 		return
 	}
 	info.UserLocal = &bridgev2.UserLocalPortalInfo{
@@ -117,7 +211,7 @@ func (wa *WhatsAppClient) applyHistoryInfo(info *bridgev2.ChatInfo, conv *wadb.C
 	}
 	if info.Disappear == nil && ptr.Val(conv.EphemeralExpiration) > 0 {
 		info.Disappear = &database.DisappearingSetting{
-			Type:  database.DisappearingTypeAfterRead,
+			Type:  database.DisappearingTypeAfterSend,
 			Timer: time.Duration(*conv.EphemeralExpiration) * time.Second,
 		}
 		if conv.EphemeralSettingTimestamp != nil {
@@ -126,15 +220,23 @@ func (wa *WhatsAppClient) applyHistoryInfo(info *bridgev2.ChatInfo, conv *wadb.C
 	}
 }
 
+// Default names and topics for special chats, can be overridden with the chat_names config section.
 const StatusBroadcastTopic = "WhatsApp status updates from your contacts"
 const StatusBroadcastName = "WhatsApp Status Broadcast"
 const BroadcastTopic = "WhatsApp broadcast list"
 const UnnamedBroadcastName = "Unnamed broadcast list"
 const PrivateChatTopic = "WhatsApp private chat"
 
+func (wa *WhatsAppClient) chatNameParams() *ChatNameParams {
+	return &ChatNameParams{
+		AccountName: wa.GetStore().PushName,
+		Phone:       "+" + wa.JID.User,
+	}
+}
+
 func (wa *WhatsAppClient) wrapDMInfo(jid types.JID) *bridgev2.ChatInfo {
 	info := &bridgev2.ChatInfo{
-		Topic: ptr.Ptr(PrivateChatTopic),
+		Topic: ptr.Ptr(wa.Main.Config.ChatNames.FormatPrivateChatTopic(wa.chatNameParams())),
 		Members: &bridgev2.ChatMemberList{
 			IsFull:           true,
 			TotalMemberCount: 2,
@@ -145,7 +247,8 @@ func (wa *WhatsAppClient) wrapDMInfo(jid types.JID) *bridgev2.ChatInfo {
 			},
 			PowerLevels: nil,
 		},
-		Type: ptr.Ptr(database.RoomTypeDM),
+		Type:         ptr.Ptr(database.RoomTypeDM),
+		ExtraUpdates: updateChatCategory(ChatCategoryDirect),
 	}
 	if jid == wa.JID.ToNonAD() {
 		// For chats with self, force-split the members so the user's own ghost is always in the room.
@@ -166,17 +269,18 @@ func (wa *WhatsAppClient) wrapStatusBroadcastInfo() *bridgev2.ChatInfo {
 		userLocal.Tag = ptr.Ptr(wa.Main.Config.StatusBroadcastTag)
 	}
 	return &bridgev2.ChatInfo{
-		Name:  ptr.Ptr(StatusBroadcastName),
-		Topic: ptr.Ptr(StatusBroadcastTopic),
+		Name:  ptr.Ptr(wa.Main.Config.ChatNames.FormatStatusBroadcastName(wa.chatNameParams())),
+		Topic: ptr.Ptr(wa.Main.Config.ChatNames.FormatStatusBroadcastTopic(wa.chatNameParams())),
 		Members: &bridgev2.ChatMemberList{
 			IsFull: false,
 			MemberMap: map[networkid.UserID]bridgev2.ChatMember{
 				waid.MakeUserID(wa.JID): {EventSender: wa.makeEventSender(wa.JID)},
 			},
 		},
-		Type:        ptr.Ptr(database.RoomTypeDefault),
-		UserLocal:   userLocal,
-		CanBackfill: false,
+		Type:         ptr.Ptr(database.RoomTypeDefault),
+		UserLocal:    userLocal,
+		CanBackfill:  false,
+		ExtraUpdates: updateChatCategory(ChatCategoryStatusBroadcast),
 	}
 }
 
@@ -187,45 +291,142 @@ const (
 	defaultPL    = 0
 )
 
-func (wa *WhatsAppClient) wrapGroupInfo(info *types.GroupInfo) *bridgev2.ChatInfo {
-	sendEventPL := defaultPL
-	if info.IsAnnounce {
+// isCommunityAnnouncementGroup checks if the group is the default announcement group of a community.
+// All community members are automatically in the announcement group, but only admins can post there.
+func isCommunityAnnouncementGroup(info *types.GroupInfo) bool {
+	return info.IsDefaultSubGroup && !info.LinkedParentJID.IsEmpty()
+}
+
+func (wa *WhatsAppClient) addCommunityMembers(ctx context.Context, communityJID types.JID, members *bridgev2.ChatMemberList) {
+	participants, err := wa.Client.GetLinkedGroupsParticipants(communityJID)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).
+			Stringer("community_jid", communityJID).
+			Msg("Failed to get community participants for announcement group")
+		return
+	}
+	for _, jid := range participants {
+		if jid.Server != types.DefaultUserServer {
+			continue
+		}
+		userID := waid.MakeUserID(jid)
+		if _, exists := members.MemberMap[userID]; exists {
+			continue
+		}
+		members.MemberMap[userID] = bridgev2.ChatMember{
+			EventSender: wa.makeEventSender(jid),
+			Membership:  event.MembershipJoin,
+			PowerLevel:  ptr.Ptr(defaultPL),
+		}
+	}
+	members.TotalMemberCount = max(members.TotalMemberCount, len(members.MemberMap))
+}
+
+// joinApprovalInvitePL returns the invite power level for a group. When WhatsApp requires admin
+// approval for new members, only admins can add people on Matrix too.
+func joinApprovalInvitePL(required bool) int {
+	if required {
+		return adminPL
+	}
+	return defaultPL
+}
+
+// groupSettingPowerLevels returns the power levels needed to send messages and to change the group
+// info based on the announce ("send messages") and locked ("edit group info") settings of a group.
+// Community announcement groups are always admin-only.
+func groupSettingPowerLevels(announce, locked, communityAnnouncement bool) (sendEventPL, metaChangePL int) {
+	sendEventPL, metaChangePL = defaultPL, defaultPL
+	if announce || communityAnnouncement {
 		sendEventPL = adminPL
 	}
-	metaChangePL := defaultPL
-	if info.IsLocked {
+	if locked || communityAnnouncement {
 		metaChangePL = adminPL
 	}
-	wrapped := &bridgev2.ChatInfo{
-		Name:  ptr.Ptr(info.Name),
-		Topic: ptr.Ptr(info.Topic),
-		Members: &bridgev2.ChatMemberList{
-			IsFull:           !info.IsIncognito,
-			TotalMemberCount: len(info.Participants),
-			MemberMap:        make(map[networkid.UserID]bridgev2.ChatMember, len(info.Participants)),
-			PowerLevels: &bridgev2.PowerLevelOverrides{
-				EventsDefault: &sendEventPL,
-				StateDefault:  ptr.Ptr(nobodyPL),
-				Ban:           ptr.Ptr(nobodyPL),
-				// TODO allow invites if bridge config says to allow them, or maybe if relay mode is enabled?
-				Events: map[event.Type]int{
-					event.StateRoomName:   metaChangePL,
-					event.StateRoomAvatar: metaChangePL,
-					event.StateTopic:      metaChangePL,
-					event.EventReaction:   defaultPL,
-					event.EventRedaction:  defaultPL,
-					// TODO always allow poll responses
-				},
+	return
+}
+
+func updateGroupSettings(announce, locked, communityAnnouncement bool) bridgev2.ExtraUpdater[*bridgev2.Portal] {
+	return func(_ context.Context, portal *bridgev2.Portal) bool {
+		meta := portal.Metadata.(*waid.PortalMetadata)
+		if meta.GroupSettingsKnown && meta.GroupAnnounce == announce && meta.GroupLocked == locked && meta.CommunityAnnouncement == communityAnnouncement {
+			return false
+		}
+		meta.GroupSettingsKnown = true
+		meta.GroupAnnounce = announce
+		meta.GroupLocked = locked
+		meta.CommunityAnnouncement = communityAnnouncement
+		return true
+	}
+}
+
+func updateGroupTopicID(topicID string) bridgev2.ExtraUpdater[*bridgev2.Portal] {
+	return func(_ context.Context, portal *bridgev2.Portal) bool {
+		meta := portal.Metadata.(*waid.PortalMetadata)
+		if meta.TopicID == topicID {
+			return false
+		}
+		meta.TopicID = topicID
+		return true
+	}
+}
+
+// wrapGroupNameAndTopic converts the name and topic of a group. Either may be nil if it didn't change.
+// The topic ID is stored in the portal metadata, so that repeated notifications about the same topic can be ignored.
+func wrapGroupNameAndTopic(name, topic *string, topicID string) *bridgev2.ChatInfo {
+	info := &bridgev2.ChatInfo{
+		Name:  name,
+		Topic: topic,
+	}
+	if topic != nil {
+		info.ExtraUpdates = updateGroupTopicID(topicID)
+	}
+	return info
+}
+
+func (wa *WhatsAppClient) wrapGroupInfo(info *types.GroupInfo) *bridgev2.ChatInfo {
+	sendEventPL, metaChangePL := groupSettingPowerLevels(info.IsAnnounce, info.IsLocked, isCommunityAnnouncementGroup(info))
+	wrapped := wrapGroupNameAndTopic(ptr.Ptr(info.Name), ptr.Ptr(info.Topic), info.TopicID)
+	wrapped.Members = &bridgev2.ChatMemberList{
+		IsFull:           !info.IsIncognito,
+		TotalMemberCount: len(info.Participants),
+		MemberMap:        make(map[networkid.UserID]bridgev2.ChatMember, len(info.Participants)),
+		PowerLevels: &bridgev2.PowerLevelOverrides{
+			EventsDefault: &sendEventPL,
+			StateDefault:  ptr.Ptr(nobodyPL),
+			Ban:           ptr.Ptr(nobodyPL),
+			Invite:        ptr.Ptr(joinApprovalInvitePL(info.IsJoinApprovalRequired)),
+			// TODO allow invites if bridge config says to allow them, or maybe if relay mode is enabled?
+			Events: map[event.Type]int{
+				event.StateRoomName:   metaChangePL,
+				event.StateRoomAvatar: metaChangePL,
+				event.StateTopic:      metaChangePL,
+				event.EventReaction:   defaultPL,
+				event.EventRedaction:  defaultPL,
+				// TODO always allow poll responses
 			},
 		},
-		Disappear: &database.DisappearingSetting{
-			Type:  database.DisappearingTypeAfterRead,
-			Timer: time.Duration(info.DisappearingTimer) * time.Second,
-		},
-		ExtraUpdates: wa.makePortalAvatarFetcher("", types.EmptyJID, time.Time{}),
 	}
+	wrapped.Disappear = &database.DisappearingSetting{
+		Type:  database.DisappearingTypeAfterSend,
+		Timer: time.Duration(info.DisappearingTimer) * time.Second,
+	}
+	wrapped.ExtraUpdates = bridgev2.MergeExtraUpdaters(
+		wrapped.ExtraUpdates,
+		wa.makePortalAvatarFetcher("", types.EmptyJID, time.Time{}),
+		updateGroupSettings(info.IsAnnounce, info.IsLocked, isCommunityAnnouncementGroup(info)),
+	)
 	for _, pcp := range info.Participants {
-		if pcp.JID.Server != types.DefaultUserServer {
+		if pcp.JID.IsEmpty() || pcp.JID.User == "" || pcp.Error != 0 {
+			// Deleted accounts and other unresolvable participants can't be mapped to ghosts,
+			// so skip them without treating the whole member list as incomplete.
+			wa.UserLogin.Log.Debug().
+				Stringer("group_jid", info.JID).
+				Stringer("participant_jid", pcp.JID).
+				Int("participant_error", pcp.Error).
+				Msg("Skipping unresolvable group participant")
+			wrapped.Members.TotalMemberCount--
+			continue
+		} else if pcp.JID.Server != types.DefaultUserServer {
 			continue
 		}
 		member := bridgev2.ChatMember{
@@ -247,25 +448,81 @@ func (wa *WhatsAppClient) wrapGroupInfo(info *types.GroupInfo) *bridgev2.ChatInf
 	}
 	if info.IsParent {
 		wrapped.Type = ptr.Ptr(database.RoomTypeSpace)
+		wrapped.ExtraUpdates = bridgev2.MergeExtraUpdaters(wrapped.ExtraUpdates, updateChatCategory(ChatCategoryCommunity))
 	} else {
 		wrapped.Type = ptr.Ptr(database.RoomTypeDefault)
+		wrapped.ExtraUpdates = bridgev2.MergeExtraUpdaters(wrapped.ExtraUpdates, updateChatCategory(ChatCategoryGroup))
 	}
 	return wrapped
 }
 
-func (wa *WhatsAppClient) wrapGroupInfoChange(evt *events.GroupInfo) *bridgev2.ChatInfoChange {
+// addPendingGroupMembers adds users whose join requests are waiting for admin approval to the member list
+// as invited members. They're not included in the total member count, which only counts joined participants.
+func (wa *WhatsAppClient) addPendingGroupMembers(ctx context.Context, groupJID types.JID, members *bridgev2.ChatMemberList) {
+	requests, err := wa.Client.GetGroupRequestParticipants(groupJID)
+	if err != nil {
+		// Only admins can see join requests, so this is expected to fail for normal members
+		zerolog.Ctx(ctx).Debug().Err(err).Stringer("group_jid", groupJID).Msg("Failed to get pending join requests")
+		return
+	}
+	wa.addJoinRequestMembers(members, requests)
+}
+
+func (wa *WhatsAppClient) addJoinRequestMembers(members *bridgev2.ChatMemberList, requests []types.GroupParticipantRequest) {
+	for _, req := range requests {
+		if req.JID.Server != types.DefaultUserServer {
+			continue
+		}
+		userID := waid.MakeUserID(req.JID)
+		if _, alreadyMember := members.MemberMap[userID]; alreadyMember {
+			continue
+		}
+		members.MemberMap[userID] = bridgev2.ChatMember{
+			EventSender: wa.makeEventSender(req.JID),
+			Membership:  event.MembershipInvite,
+		}
+	}
+}
+
+// joinRequestResultMember returns the new membership of a user whose pending join request was approved or rejected.
+func (wa *WhatsAppClient) joinRequestResultMember(userJID types.JID, action whatsmeow.ParticipantRequestChange) bridgev2.ChatMember {
+	member := bridgev2.ChatMember{
+		EventSender: wa.makeEventSender(userJID),
+	}
+	if action == whatsmeow.ParticipantChangeApprove {
+		member.Membership = event.MembershipJoin
+		member.PowerLevel = ptr.Ptr(defaultPL)
+	} else {
+		member.Membership = event.MembershipLeave
+		member.PrevMembership = event.MembershipInvite
+	}
+	return member
+}
+
+// wrapGroupInfoChange converts a group info change event. The portal metadata is used to fill in
+// the group settings that didn't change and to skip power level and topic updates that wouldn't change anything.
+// It may be nil if the portal doesn't exist yet.
+func (wa *WhatsAppClient) wrapGroupInfoChange(evt *events.GroupInfo, portalMeta *waid.PortalMetadata) *bridgev2.ChatInfoChange {
 	var changes *bridgev2.ChatInfo
-	if evt.Name != nil || evt.Topic != nil || evt.Ephemeral != nil || evt.Unlink != nil || evt.Link != nil {
-		changes = &bridgev2.ChatInfo{}
+	topic := evt.Topic
+	if topic != nil && portalMeta != nil && topic.TopicID != "" && topic.TopicID == portalMeta.TopicID {
+		// The topic is already up to date, e.g. because the change was already received once
+		topic = nil
+	}
+	if evt.Name != nil || topic != nil || evt.Ephemeral != nil || evt.Unlink != nil || evt.Link != nil {
+		var name, topicText *string
+		var topicID string
 		if evt.Name != nil {
-			changes.Name = &evt.Name.Name
+			name = &evt.Name.Name
 		}
-		if evt.Topic != nil {
-			changes.Topic = &evt.Topic.Topic
+		if topic != nil {
+			topicText = &topic.Topic
+			topicID = topic.TopicID
 		}
+		changes = wrapGroupNameAndTopic(name, topicText, topicID)
 		if evt.Ephemeral != nil {
 			changes.Disappear = &database.DisappearingSetting{
-				Type:  database.DisappearingTypeAfterRead,
+				Type:  database.DisappearingTypeAfterSend,
 				Timer: time.Duration(evt.Ephemeral.DisappearingTimer) * time.Second,
 			}
 			if !evt.Ephemeral.IsEphemeral {
@@ -321,23 +578,41 @@ func (wa *WhatsAppClient) wrapGroupInfoChange(evt *events.GroupInfo) *bridgev2.C
 			}
 		}
 	}
+	var settingsChanged bool
+	announce, locked, communityAnnouncement := false, false, false
 	if evt.Announce != nil || evt.Locked != nil {
-		if memberChanges == nil {
-			memberChanges = &bridgev2.ChatMemberList{}
+		settingsKnown := portalMeta != nil && portalMeta.GroupSettingsKnown
+		if settingsKnown {
+			announce, locked, communityAnnouncement = portalMeta.GroupAnnounce, portalMeta.GroupLocked, portalMeta.CommunityAnnouncement
 		}
-		memberChanges.PowerLevels = &bridgev2.PowerLevelOverrides{}
 		if evt.Announce != nil {
-			if evt.Announce.IsAnnounce {
-				memberChanges.PowerLevels.EventsDefault = ptr.Ptr(adminPL)
-			} else {
-				memberChanges.PowerLevels.EventsDefault = ptr.Ptr(defaultPL)
-			}
+			settingsChanged = settingsChanged || !settingsKnown || announce != evt.Announce.IsAnnounce
+			announce = evt.Announce.IsAnnounce
 		}
 		if evt.Locked != nil {
-			metaChangePL := defaultPL
-			if evt.Locked.IsLocked {
-				metaChangePL = adminPL
+			settingsChanged = settingsChanged || !settingsKnown || locked != evt.Locked.IsLocked
+			locked = evt.Locked.IsLocked
+		}
+		if settingsKnown && settingsChanged {
+			if changes == nil {
+				changes = &bridgev2.ChatInfo{}
 			}
+			changes.ExtraUpdates = bridgev2.MergeExtraUpdaters(changes.ExtraUpdates, updateGroupSettings(announce, locked, communityAnnouncement))
+		}
+	}
+	if settingsChanged || evt.MembershipApprovalMode != nil {
+		if memberChanges == nil {
+			memberChanges = &bridgev2.ChatMemberList{}
+		}
+		memberChanges.PowerLevels = &bridgev2.PowerLevelOverrides{}
+		if evt.MembershipApprovalMode != nil {
+			memberChanges.PowerLevels.Invite = ptr.Ptr(joinApprovalInvitePL(evt.MembershipApprovalMode.IsJoinApprovalRequired))
+		}
+		sendEventPL, metaChangePL := groupSettingPowerLevels(announce, locked, communityAnnouncement)
+		if evt.Announce != nil && settingsChanged {
+			memberChanges.PowerLevels.EventsDefault = ptr.Ptr(sendEventPL)
+		}
+		if evt.Locked != nil && settingsChanged {
 			memberChanges.PowerLevels.Events = map[event.Type]int{
 				event.StateRoomName:   metaChangePL,
 				event.StateRoomAvatar: metaChangePL,
@@ -362,11 +637,14 @@ func (wa *WhatsAppClient) makePortalAvatarFetcher(avatarID string, sender types.
 			existingID = ""
 		}
 		var wrappedAvatar *bridgev2.Avatar
-		avatar, err := wa.Client.GetProfilePictureInfo(jid, &whatsmeow.GetProfilePictureParams{
+		avatar, err := wa.getProfilePictureInfo(ctx, jid, &whatsmeow.GetProfilePictureParams{
 			ExistingID:  existingID,
 			IsCommunity: portal.RoomType == database.RoomTypeSpace,
 		})
-		if errors.Is(err, whatsmeow.ErrProfilePictureNotSet) {
+		if errors.Is(err, errProfilePictureRateLimited) {
+			wa.deferAvatar(jid, false)
+			return false
+		} else if errors.Is(err, whatsmeow.ErrProfilePictureNotSet) {
 			wrappedAvatar = &bridgev2.Avatar{
 				ID:     "remove",
 				Remove: true,
@@ -400,15 +678,10 @@ func (wa *WhatsAppClient) makePortalAvatarFetcher(avatarID string, sender types.
 }
 
 func (wa *WhatsAppClient) wrapNewsletterInfo(info *types.NewsletterMetadata) *bridgev2.ChatInfo {
-	ownPowerLevel := defaultPL
+	var ownRole types.NewsletterRole
 	var mutedUntil *time.Time
 	if info.ViewerMeta != nil {
-		switch info.ViewerMeta.Role {
-		case types.NewsletterRoleAdmin:
-			ownPowerLevel = adminPL
-		case types.NewsletterRoleOwner:
-			ownPowerLevel = superAdminPL
-		}
+		ownRole = info.ViewerMeta.Role
 		switch info.ViewerMeta.Mute {
 		case types.NewsletterMuteOn:
 			mutedUntil = &event.MutedForever
@@ -416,6 +689,7 @@ func (wa *WhatsAppClient) wrapNewsletterInfo(info *types.NewsletterMetadata) *br
 			mutedUntil = &bridgev2.Unmuted
 		}
 	}
+	ownPowerLevel := newsletterRolePowerLevel(ownRole)
 	avatar := &bridgev2.Avatar{}
 	if info.ThreadMeta.Picture != nil {
 		avatar.ID = networkid.AvatarID(info.ThreadMeta.Picture.ID)
@@ -467,5 +741,10 @@ func (wa *WhatsAppClient) wrapNewsletterInfo(info *types.NewsletterMetadata) *br
 			},
 		},
 		Type: ptr.Ptr(database.RoomTypeDefault),
+		ExtraUpdates: bridgev2.MergeExtraUpdaters(
+			updateNewsletterSubscriberCount(info.ThreadMeta.SubscriberCount),
+			updateNewsletterRole(ownRole),
+			updateChatCategory(ChatCategoryNewsletter),
+		),
 	}
 }
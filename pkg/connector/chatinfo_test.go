@@ -0,0 +1,241 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/ptr"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/event"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/connector/wadb"
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+var testOwnJID = types.JID{User: "15551234567", Device: 12, Server: types.DefaultUserServer}
+
+func newTestClient() *WhatsAppClient {
+	return &WhatsAppClient{
+		Main: &WhatsAppConnector{
+			Config: Config{
+				PinnedTag:  event.RoomTagFavourite,
+				ArchiveTag: event.RoomTagLowPriority,
+			},
+		},
+		UserLogin: &bridgev2.UserLogin{
+			UserLogin: &database.UserLogin{ID: waid.MakeUserLoginID(testOwnJID)},
+			Log:       zerolog.Nop(),
+		},
+		JID: testOwnJID,
+	}
+}
+
+func TestWrapGroupInfo_UnresolvableParticipants(t *testing.T) {
+	wa := newTestClient()
+	alice := types.JID{User: "15550000001", Server: types.DefaultUserServer}
+	bob := types.JID{User: "15550000002", Server: types.DefaultUserServer}
+	info := &types.GroupInfo{
+		JID: types.JID{User: "120363000000000001", Server: types.GroupServer},
+		Participants: []types.GroupParticipant{
+			{JID: alice, IsAdmin: true},
+			{JID: types.EmptyJID},
+			{JID: types.JID{Server: types.DefaultUserServer}},
+			{JID: types.JID{User: "15550000003", Server: types.DefaultUserServer}, Error: 404},
+			{JID: bob},
+		},
+	}
+	wrapped := wa.wrapGroupInfo(info)
+	members := wrapped.Members
+	if !members.IsFull {
+		t.Error("member list should still be marked as full")
+	}
+	if members.TotalMemberCount != 2 {
+		t.Errorf("TotalMemberCount = %d, expected 2", members.TotalMemberCount)
+	}
+	if len(members.MemberMap) != 2 {
+		t.Fatalf("MemberMap has %d entries, expected 2", len(members.MemberMap))
+	}
+	if _, ok := members.MemberMap[""]; ok {
+		t.Error("MemberMap contains an empty user ID")
+	}
+	if member, ok := members.MemberMap[waid.MakeUserID(alice)]; !ok {
+		t.Error("resolvable admin is missing from MemberMap")
+	} else if member.PowerLevel == nil || *member.PowerLevel != adminPL {
+		t.Errorf("admin power level = %v, expected %d", member.PowerLevel, adminPL)
+	}
+	if member, ok := members.MemberMap[waid.MakeUserID(bob)]; !ok {
+		t.Error("resolvable member is missing from MemberMap")
+	} else if member.Membership != event.MembershipJoin {
+		t.Errorf("member membership = %q, expected join", member.Membership)
+	}
+}
+
+type testChatSettingsStore struct {
+	settings types.LocalChatSettings
+	err      error
+}
+
+func (s *testChatSettingsStore) PutMutedUntil(types.JID, time.Time) error { return nil }
+func (s *testChatSettingsStore) PutPinned(types.JID, bool) error          { return nil }
+func (s *testChatSettingsStore) PutArchived(types.JID, bool) error        { return nil }
+func (s *testChatSettingsStore) GetChatSettings(types.JID) (types.LocalChatSettings, error) {
+	return s.settings, s.err
+}
+
+func newTestClientWithChatSettings(chatSettings store.ChatSettingsStore) *WhatsAppClient {
+	wa := newTestClient()
+	wa.Client = &whatsmeow.Client{Store: &store.Device{ChatSettings: chatSettings}}
+	return wa
+}
+
+func TestApplyChatSettings_StoreError(t *testing.T) {
+	wa := newTestClientWithChatSettings(&testChatSettingsStore{err: errors.New("database is locked")})
+	info := &bridgev2.ChatInfo{Name: ptr.Ptr("Test chat")}
+	wa.applyChatSettings(context.Background(), types.JID{User: "15550000001", Server: types.DefaultUserServer}, info)
+	if info.UserLocal != nil {
+		t.Errorf("UserLocal = %+v, expected nil when chat settings are unavailable", info.UserLocal)
+	}
+	if info.Name == nil || *info.Name != "Test chat" {
+		t.Error("other chat info was lost")
+	}
+}
+
+func TestGetChatInfo_ChatSettingsStoreError(t *testing.T) {
+	wa := newTestClientWithChatSettings(&testChatSettingsStore{err: errors.New("database is locked")})
+	dmJID := types.JID{User: "15550000001", Server: types.DefaultUserServer}
+	muteEnd := time.Now().Add(time.Hour).Truncate(time.Second)
+	conv := &wadb.Conversation{
+		ChatJID:             dmJID,
+		Pinned:              ptr.Ptr(true),
+		MuteEndTime:         muteEnd,
+		EphemeralExpiration: ptr.Ptr(uint32(86400)),
+	}
+	info, err := wa.getChatInfo(context.Background(), dmJID, conv)
+	if err != nil {
+		t.Fatalf("getChatInfo returned error: %v", err)
+	}
+	if info.Members == nil || info.Members.OtherUserID != waid.MakeUserID(dmJID) {
+		t.Error("member list is missing or has the wrong other user")
+	}
+	if info.Topic == nil || *info.Topic == "" {
+		t.Error("topic is missing")
+	}
+	if !info.CanBackfill {
+		t.Error("CanBackfill should be set from the history sync conversation")
+	}
+	if info.Disappear == nil || info.Disappear.Timer != 24*time.Hour {
+		t.Errorf("Disappear = %+v, expected a 24h timer from the history sync conversation", info.Disappear)
+	}
+	if info.UserLocal == nil {
+		t.Fatal("UserLocal from the history sync conversation was dropped")
+	}
+	if info.UserLocal.Tag == nil || *info.UserLocal.Tag != event.RoomTagFavourite {
+		t.Errorf("tag = %v, expected %s", info.UserLocal.Tag, event.RoomTagFavourite)
+	}
+	if info.UserLocal.MutedUntil == nil || !info.UserLocal.MutedUntil.Equal(muteEnd) {
+		t.Errorf("MutedUntil = %v, expected %v", info.UserLocal.MutedUntil, muteEnd)
+	}
+}
+
+func TestApplyChatSettings_Found(t *testing.T) {
+	muteEnd := time.Now().Add(time.Hour)
+	wa := newTestClientWithChatSettings(&testChatSettingsStore{settings: types.LocalChatSettings{
+		Found:      true,
+		MutedUntil: muteEnd,
+		Archived:   true,
+	}})
+	info := &bridgev2.ChatInfo{UserLocal: &bridgev2.UserLocalPortalInfo{Tag: ptr.Ptr(event.RoomTagFavourite)}}
+	wa.applyChatSettings(context.Background(), types.JID{User: "15550000001", Server: types.DefaultUserServer}, info)
+	if info.UserLocal == nil || info.UserLocal.Tag == nil || *info.UserLocal.Tag != event.RoomTagLowPriority {
+		t.Errorf("UserLocal = %+v, expected the archive tag from the chat settings store", info.UserLocal)
+	} else if !info.UserLocal.MutedUntil.Equal(muteEnd) {
+		t.Errorf("MutedUntil = %v, expected %v", info.UserLocal.MutedUntil, muteEnd)
+	}
+}
+
+func TestJoinRequestMembers_PendingToJoined(t *testing.T) {
+	wa := newTestClient()
+	alice := types.JID{User: "15550000001", Server: types.DefaultUserServer}
+	pending := types.JID{User: "15550000002", Server: types.DefaultUserServer}
+	info := &types.GroupInfo{
+		JID:          types.JID{User: "120363000000000001", Server: types.GroupServer},
+		Participants: []types.GroupParticipant{{JID: alice}},
+		GroupMembershipApprovalMode: types.GroupMembershipApprovalMode{
+			IsJoinApprovalRequired: true,
+		},
+	}
+	members := wa.wrapGroupInfo(info).Members
+	wa.addJoinRequestMembers(members, []types.GroupParticipantRequest{
+		{JID: pending, RequestedAt: time.Now()},
+		// A request from someone who's already a participant must not downgrade them to invited
+		{JID: alice, RequestedAt: time.Now()},
+		{JID: types.JID{User: "123456789", Server: types.HiddenUserServer}, RequestedAt: time.Now()},
+	})
+
+	if members.TotalMemberCount != 1 {
+		t.Errorf("TotalMemberCount = %d, expected only the joined participant to be counted", members.TotalMemberCount)
+	}
+	if len(members.MemberMap) != 2 {
+		t.Errorf("MemberMap has %d entries, expected 2", len(members.MemberMap))
+	}
+	if member := members.MemberMap[waid.MakeUserID(alice)]; member.Membership != event.MembershipJoin {
+		t.Errorf("existing participant membership = %q, expected join", member.Membership)
+	}
+	pendingMember, ok := members.MemberMap[waid.MakeUserID(pending)]
+	if !ok {
+		t.Fatal("pending member is missing from MemberMap")
+	} else if pendingMember.Membership != event.MembershipInvite {
+		t.Errorf("pending member membership = %q, expected invite", pendingMember.Membership)
+	}
+
+	approved := wa.joinRequestResultMember(pending, whatsmeow.ParticipantChangeApprove)
+	if approved.Membership != event.MembershipJoin {
+		t.Errorf("approved member membership = %q, expected join", approved.Membership)
+	} else if approved.PowerLevel == nil || *approved.PowerLevel != defaultPL {
+		t.Errorf("approved member power level = %v, expected %d", approved.PowerLevel, defaultPL)
+	} else if approved.Sender != pendingMember.Sender {
+		t.Errorf("approved member sender = %q, expected %q", approved.Sender, pendingMember.Sender)
+	}
+
+	rejected := wa.joinRequestResultMember(pending, whatsmeow.ParticipantChangeReject)
+	if rejected.Membership != event.MembershipLeave || rejected.PrevMembership != event.MembershipInvite {
+		t.Errorf("rejected member membership = %q (prev %q), expected leave from invite", rejected.Membership, rejected.PrevMembership)
+	}
+}
+
+func TestDisappearingTimerType(t *testing.T) {
+	wa := newTestClient()
+	// 604800 seconds is WhatsApp's 7 day disappearing messages option
+	const weekSeconds = 604800
+
+	group := wa.wrapGroupInfo(&types.GroupInfo{
+		JID:            types.JID{User: "120363000000000001", Server: types.GroupServer},
+		GroupEphemeral: types.GroupEphemeral{IsEphemeral: true, DisappearingTimer: weekSeconds},
+	})
+	historyInfo := &bridgev2.ChatInfo{}
+	wa.applyHistoryInfo(historyInfo, &wadb.Conversation{EphemeralExpiration: ptr.Ptr(uint32(weekSeconds))})
+
+	for name, setting := range map[string]*database.DisappearingSetting{
+		"wrapGroupInfo":    group.Disappear,
+		"applyHistoryInfo": historyInfo.Disappear,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if setting == nil {
+				t.Fatal("disappearing setting is missing")
+			}
+			if setting.Type != database.DisappearingTypeAfterSend {
+				t.Errorf("Type = %q, expected %q", setting.Type, database.DisappearingTypeAfterSend)
+			}
+			if setting.Timer != 7*24*time.Hour {
+				t.Errorf("Timer = %s, expected 168h", setting.Timer)
+			}
+		})
+	}
+}
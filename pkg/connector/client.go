@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"strings"
 	"sync"
@@ -77,10 +78,15 @@ func (wa *WhatsAppConnector) LoadUserLogin(_ context.Context, login *bridgev2.Us
 		Main:      wa,
 		UserLogin: login,
 
-		historySyncs:       make(chan *waHistorySync.HistorySync, 64),
-		resyncQueue:        make(map[types.JID]resyncQueueItem),
-		directMediaRetries: make(map[networkid.MessageID]*directMediaRetry),
-		mediaRetryLock:     semaphore.NewWeighted(wa.Config.HistorySync.MediaRequests.MaxAsyncHandle),
+		historySyncs:         make(chan *waHistorySync.HistorySync, 64),
+		resyncQueue:          make(map[types.JID]resyncQueueItem),
+		directMediaRetries:   make(map[networkid.MessageID]*directMediaRetry),
+		groupRecipientCounts: make(map[types.JID]groupRecipientCount),
+		lidMappings:          make(map[types.JID]types.JID),
+		historyRequests:      make(map[types.JID]*historyRequest),
+		undecryptableQueue:   make(map[types.JID][]*queuedUndecryptable),
+		pendingPlaceholders:  make(map[networkid.PortalKey]map[networkid.MessageID]*pendingPlaceholder),
+		mediaRetryLock:       semaphore.NewWeighted(wa.Config.HistorySync.MediaRequests.MaxAsyncHandle),
 	}
 	login.Client = w
 
@@ -136,8 +142,39 @@ type WhatsAppClient struct {
 	mediaRetryLock     *semaphore.Weighted
 	offlineSyncWaiter  chan error
 
+	groupRecipientCounts     map[types.JID]groupRecipientCount
+	groupRecipientCountsLock sync.Mutex
+	lidMappings              map[types.JID]types.JID
+	lidMappingsLock          sync.RWMutex
+	ghostCache               sync.Map // types.JID -> *ghostCacheEntry
+	groupLinkCache           sync.Map // types.JID -> *groupLinkCacheEntry
+	historyRequests          map[types.JID]*historyRequest
+	historyRequestsLock      sync.Mutex
+	undecryptableQueue       map[types.JID][]*queuedUndecryptable
+	undecryptableQueueLock   sync.Mutex
+	pendingPlaceholders      map[networkid.PortalKey]map[networkid.MessageID]*pendingPlaceholder
+	pendingPlaceholdersLock  sync.Mutex
+
+	avatarLimitLock          sync.Mutex
+	lastAvatarQuery          time.Time
+	avatarBackoff            time.Duration
+	avatarBackoffUntil       time.Time
+	deferredAvatars          map[types.JID]bool
+	profilePictureRateLimits atomic.Int64
+
+	deliveryStatusPending   map[networkid.MessageID]*pendingDeliveryStatus
+	deliveryStatusLock      sync.Mutex
+	deliveryStatusFlushLock sync.Mutex
+
+	broadcastBatchLock sync.Mutex
+	broadcastBatches   map[types.MessageID]*broadcastBatch
+
 	lastPhoneOfflineWarning time.Time
 	isNewLogin              bool
+	connNoticeDisconnected  atomic.Bool
+
+	initialConnectStarted  atomic.Bool
+	cancelStaggeredConnect atomic.Pointer[context.CancelFunc]
 }
 
 var (
@@ -211,12 +248,70 @@ func (wa *WhatsAppClient) Connect(ctx context.Context) {
 		wa.UserLogin.BridgeState.Send(state)
 		return
 	}
+	if delay := wa.initialConnectDelay(); delay > 0 {
+		wa.connectStaggered(ctx, delay)
+		return
+	}
+	wa.connect(ctx)
+}
+
+// initialConnectDelay returns a random delay for the first connection of logins loaded on startup,
+// so that large instances don't reconnect every login at the same moment.
+func (wa *WhatsAppClient) initialConnectDelay() time.Duration {
+	window := wa.Main.Config.ConnectStaggerWindow
+	if !wa.initialConnectStarted.CompareAndSwap(false, true) || wa.isNewLogin || window <= 0 {
+		return 0
+	}
+	return rand.N(time.Duration(window) * time.Second)
+}
+
+func (wa *WhatsAppClient) connectStaggered(ctx context.Context, delay time.Duration) {
+	log := zerolog.Ctx(ctx)
+	total := wa.Main.staggeredConnects.Add(1)
+	log.Debug().
+		Stringer("delay", delay).
+		Int64("queued_logins", total).
+		Msg("Delaying initial connection to spread out startup load")
+	wa.UserLogin.BridgeState.Send(status.BridgeState{StateEvent: status.StateConnecting})
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	if oldCancel := wa.cancelStaggeredConnect.Swap(&cancel); oldCancel != nil {
+		(*oldCancel)()
+	}
+	go func() {
+		defer cancel()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			log.Debug().Msg("Staggered connection cancelled before it started")
+			return
+		}
+		wa.cancelStaggeredConnect.CompareAndSwap(&cancel, nil)
+		if wa.Client == nil {
+			return
+		}
+		wa.connect(ctx)
+		log.Info().
+			Int64("connected_logins", wa.Main.staggeredConnectsDone.Add(1)).
+			Int64("queued_logins", wa.Main.staggeredConnects.Load()).
+			Msg("Staggered startup connection attempted")
+	}()
+}
+
+func (wa *WhatsAppClient) connect(ctx context.Context) {
+	// Only logins that are actually being connected are tracked for the health endpoint,
+	// the entry is removed again in Disconnect and when the login is logged out.
+	wa.Main.clients.Store(wa.UserLogin.ID, wa)
 	wa.Main.firstClientConnectOnce.Do(wa.Main.onFirstClientConnect)
 	if err := wa.Main.updateProxy(ctx, wa.Client, false); err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to update proxy")
 	}
 	wa.startLoops()
+	wa.sendConnectionNotice(ctx, true, "Connecting to WhatsApp...")
 	if err := wa.Client.Connect(); err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to connect to WhatsApp")
+		wa.noticeDisconnected("connection failed")
 		state := status.BridgeState{
 			StateEvent: status.StateUnknownError,
 			Error:      WAConnectionFailed,
@@ -323,6 +418,29 @@ func (wa *WhatsAppClient) sendPNData(ctx context.Context, pn string) error {
 	return nil
 }
 
+// logoutSecondaryDevice asks the WhatsApp servers to remove another linked device from the account.
+// whatsmeow can only log out the current device, so this sends the same request for a different JID.
+func (wa *WhatsAppClient) logoutSecondaryDevice(ctx context.Context, device types.JID) error {
+	//lint:ignore SA1019 this is supposed to be dangerous
+	_, err := wa.Client.DangerousInternals().SendIQ(whatsmeow.DangerousInfoQuery{
+		Namespace: "md",
+		Type:      "set",
+		To:        types.ServerJID,
+		Content: []waBinary.Node{{
+			Tag: "remove-companion-device",
+			Attrs: waBinary.Attrs{
+				"jid":    device,
+				"reason": "user_initiated",
+			},
+		}},
+		Context: ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send remove device request: %w", err)
+	}
+	return nil
+}
+
 func (wa *WhatsAppClient) startLoops() {
 	ctx, cancel := context.WithCancel(context.Background())
 	oldStop := wa.stopLoops.Swap(&cancel)
@@ -332,6 +450,8 @@ func (wa *WhatsAppClient) startLoops() {
 	go wa.historySyncLoop(ctx)
 	go wa.ghostResyncLoop(ctx)
 	go wa.disconnectWarningLoop(ctx)
+	go wa.placeholderCleanupLoop(ctx)
+	go wa.deferredAvatarLoop(ctx)
 	if mrc := wa.Main.Config.HistorySync.MediaRequests; mrc.AutoRequestMedia && mrc.RequestMethod == MediaRequestMethodLocalTime {
 		go wa.mediaRequestLoop(ctx)
 	}
@@ -348,12 +468,17 @@ func (wa *WhatsAppClient) GetStore() *store.Device {
 }
 
 func (wa *WhatsAppClient) Disconnect() {
+	if cancelConnect := wa.cancelStaggeredConnect.Swap(nil); cancelConnect != nil {
+		(*cancelConnect)()
+	}
 	if stopHistorySyncLoop := wa.stopLoops.Swap(nil); stopHistorySyncLoop != nil {
 		(*stopHistorySyncLoop)()
 	}
 	if cli := wa.Client; cli != nil {
 		cli.Disconnect()
 	}
+	wa.flushDeliveryStatus()
+	wa.Main.clients.CompareAndDelete(wa.UserLogin.ID, wa)
 }
 
 func (wa *WhatsAppClient) LogoutRemote(ctx context.Context) {
@@ -736,3 +861,49 @@ func sendJSONRequest(ctx context.Context, endpoint string, jsonData string) erro
 
 	return nil
 }
+
+// queryNewsletterSubscribers is the mex query ID for listing the subscribers of a channel.
+// whatsmeow knows the query, but doesn't have a public method for it yet.
+const queryNewsletterSubscribers = "9800646650009898"
+
+type newsletterSubscriber struct {
+	JID          types.JID            `json:"id"`
+	Role         types.NewsletterRole `json:"role"`
+	SubscribedAt jsontime.UnixString  `json:"subscribe_time"`
+}
+
+type respNewsletterSubscribers struct {
+	Newsletter struct {
+		Subscribers struct {
+			Edges []struct {
+				Node *newsletterSubscriber `json:"node"`
+			} `json:"edges"`
+		} `json:"subscribers"`
+	} `json:"xwa2_newsletter_subscribers"`
+}
+
+// getNewsletterSubscribers fetches up to count subscribers of a channel. Only channel admins are allowed to do this.
+func (wa *WhatsAppClient) getNewsletterSubscribers(ctx context.Context, jid types.JID, count int) ([]*newsletterSubscriber, error) {
+	//lint:ignore SA1019 this is supposed to be dangerous
+	data, err := wa.Client.DangerousInternals().SendMexIQ(ctx, queryNewsletterSubscribers, map[string]any{
+		"input": map[string]any{
+			"newsletter_id": jid.String(),
+			"count":         count,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscribers: %w", err)
+	}
+	var resp respNewsletterSubscribers
+	err = json.Unmarshal(data, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse subscriber list: %w", err)
+	}
+	subscribers := make([]*newsletterSubscriber, 0, len(resp.Newsletter.Subscribers.Edges))
+	for _, edge := range resp.Newsletter.Subscribers.Edges {
+		if edge.Node != nil && !edge.Node.JID.IsEmpty() {
+			subscribers = append(subscribers, edge.Node)
+		}
+	}
+	return subscribers, nil
+}
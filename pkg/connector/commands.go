@@ -17,18 +17,52 @@
 package connector
 
 import (
-	"maunium.net/go/mautrix/bridgev2/commands"
-
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/util/exfmt"
 	"go.mau.fi/util/jsontime"
+	"go.mau.fi/util/ptr"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/commands"
+	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/bridgev2/matrix"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/bridgev2/simplevent"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
 )
 
 var (
-	HelpSectionInvites = commands.HelpSection{Name: "Group invites", Order: 25}
-	HelpSectionGroups  = commands.HelpSection{Name: "Groups", Order: 30}
+	HelpSectionInvites  = commands.HelpSection{Name: "Group invites", Order: 25}
+	HelpSectionGroups   = commands.HelpSection{Name: "Groups", Order: 30}
+	HelpSectionProfile  = commands.HelpSection{Name: "Profile", Order: 35}
+	HelpSectionChannels = commands.HelpSection{Name: "Channels", Order: 40}
+	HelpSectionPortals  = commands.HelpSection{Name: "Portals", Order: 45}
 )
 
 var cmdAccept = &commands.FullHandler{
@@ -36,7 +70,8 @@ var cmdAccept = &commands.FullHandler{
 	Name: "accept",
 	Help: commands.HelpMeta{
 		Section:     HelpSectionInvites,
-		Description: "Accept a group invite. This can only be used in reply to a group invite message.",
+		Description: "Accept a group invite, either in reply to a group invite message, by passing the group JID or by passing an invite link.",
+		Args:        "[_group JID_ | _invite link_]",
 	},
 	RequiresLogin:  true,
 	RequiresPortal: true,
@@ -62,9 +97,517 @@ var cmdTestSyncTimer = &commands.FullHandler{
 	RequiresLogin: true,
 }
 
+var cmdSetProfilePicture = &commands.FullHandler{
+	Func: fnSetProfilePicture,
+	Name: "set-profile-picture",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "Set your WhatsApp profile picture. Reply to an image or pass an mxc:// URI.",
+		Args:        "[_mxc URI_]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdRemoveProfilePicture = &commands.FullHandler{
+	Func: fnRemoveProfilePicture,
+	Name: "remove-profile-picture",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "Remove your WhatsApp profile picture.",
+	},
+	RequiresLogin: true,
+}
+
+var cmdSetAbout = &commands.FullHandler{
+	Func: fnSetAbout,
+	Name: "set-about",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "Set your WhatsApp about text, or clear it with `--clear`.",
+		Args:        "<_text_ | --clear>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdGetAbout = &commands.FullHandler{
+	Func: fnGetAbout,
+	Name: "get-about",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "View your WhatsApp about text.",
+	},
+	RequiresLogin: true,
+}
+
+var cmdQR = &commands.FullHandler{
+	Func:    fnQR,
+	Name:    "qr",
+	Aliases: []string{"relink"},
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAuth,
+		Description: "Re-link your existing WhatsApp login by scanning a new QR code. Portals and message history are preserved.",
+	},
+	RequiresLogin: true,
+}
+
+var cmdGetNewsletterInvite = &commands.FullHandler{
+	Func: fnGetNewsletterInvite,
+	Name: "get-newsletter-invite",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionChannels,
+		Description: "Get the invite link of the current channel. The link is sent to your management room.",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdPortalID = &commands.FullHandler{
+	Func: fnPortalID,
+	Name: "portal-id",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Show the WhatsApp JID and other identifiers of the current portal.",
+	},
+	RequiresPortal: true,
+}
+
+var cmdMigrateNumber = &commands.FullHandler{
+	Func: fnMigrateNumber,
+	Name: "migrate-number",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Move the private chat with a contact who changed their phone number to the new number.",
+		Args:        "<_old phone_> <_new phone_>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdMessageStatus = &commands.FullHandler{
+	Func: fnMessageStatus,
+	Name: "message-status",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Check whether a message you sent has been delivered and read on WhatsApp. Reply to the message or pass its event ID.",
+		Args:        "[_event ID_]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdMessageInfo = &commands.FullHandler{
+	Func: fnMessageInfo,
+	Name: "message-info",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Show who has received and read a message you sent. Reply to the message when using this command.",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdLink = &commands.FullHandler{
+	Func: fnLink,
+	Name: "link",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Get a shareable matrix.to link for the current portal, creating a room alias if necessary. Pass `--public` to also make the room publicly joinable.",
+		Args:        "[--public]",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdSetEncryption = &commands.FullHandler{
+	Func: fnSetEncryption,
+	Name: "set-encryption",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Enable or disable Matrix end-to-end encryption for the current portal.",
+		Args:        "<on|off>",
+	},
+	RequiresPortal: true,
+}
+
+var cmdSetGroupJoinApproval = &commands.FullHandler{
+	Func: fnSetGroupJoinApproval,
+	Name: "set-group-join-approval",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroups,
+		Description: "Choose whether new members need admin approval to join the current group.",
+		Args:        "<on|off>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdApproveMember = &commands.FullHandler{
+	Func: func(ce *commands.Event) {
+		fnHandleJoinRequest(ce, whatsmeow.ParticipantChangeApprove)
+	},
+	Name: "approve-member",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroups,
+		Description: "Approve a request to join the current group.",
+		Args:        "<_phone number_ | _Matrix user ID_>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdRejectMember = &commands.FullHandler{
+	Func: func(ce *commands.Event) {
+		fnHandleJoinRequest(ce, whatsmeow.ParticipantChangeReject)
+	},
+	Name: "reject-member",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroups,
+		Description: "Reject a request to join the current group.",
+		Args:        "<_phone number_ | _Matrix user ID_>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdChatFilter = &commands.FullHandler{
+	Func: fnChatFilter,
+	Name: "chat-filter",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAdmin,
+		Description: "View or change which WhatsApp chats get portals. Changes are not saved to the config file.",
+		Args:        "[types <_category_...|all> | mode <allow|deny> | add <_JID pattern_> | remove <_JID pattern_>]",
+	},
+	RequiresAdmin: true,
+}
+
+var cmdGetLinkedDevices = &commands.FullHandler{
+	Func: fnGetLinkedDevices,
+	Name: "get-linked-devices",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAuth,
+		Description: "List the devices linked to your WhatsApp account.",
+	},
+	RequiresLogin: true,
+}
+
+var cmdUnlinkDevice = &commands.FullHandler{
+	Func: fnUnlinkDevice,
+	Name: "unlink-device",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAuth,
+		Description: "Log out a device linked to your WhatsApp account. Use `get-linked-devices` to find device IDs.",
+		Args:        "<_device ID_> [--force]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdPortalMappings = &commands.FullHandler{
+	Func: fnPortalMappings,
+	Name: "portal-mappings",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAdmin,
+		Description: "List the portals of a login with their WhatsApp JIDs and Matrix room IDs.",
+		Args:        "[--type <dm|group|newsletter|broadcast>] [--login <_login ID_>] [_page_]",
+	},
+	RequiresAdmin: true,
+}
+
+var cmdStickers = &commands.FullHandler{
+	Func: fnStickers,
+	Name: "stickers",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "List your recent WhatsApp stickers, or send one of them to the current portal.",
+		Args:        "[_page_ | send <_number_>]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdRequestHistory = &commands.FullHandler{
+	Func: fnRequestHistory,
+	Name: "request-history",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionChats,
+		Description: "Ask your phone for older messages in the current chat and bridge the ones that are missing.",
+		Args:        "<days>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdSetGroupEphemeralDefault = &commands.FullHandler{
+	Func: fnSetGroupEphemeralDefault,
+	Name: "set-group-ephemeral-default",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroups,
+		Description: "Set the disappearing message timer of every group in the current community.",
+		Args:        "<off|24h|7d|90d>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdResetBackfill = &commands.FullHandler{
+	Func: fnResetBackfill,
+	Name: "reset-backfill",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionChats,
+		Description: "Clear the backfill state of the current chat so that history is backfilled again.",
+		Args:        "--confirm",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdPortalSettings = &commands.FullHandler{
+	Func: fnPortalSettings,
+	Name: "portal-settings",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "View or change bridge settings of the current portal.",
+		Args:        "[set <_key_> <_value_>]",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdResend = &commands.FullHandler{
+	Func: fnResend,
+	Name: "resend",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Retry bridging a WhatsApp message that failed to bridge, e.g. because the media couldn't be downloaded. Reply to the message or pass its event ID or WhatsApp message ID.",
+		Args:        "[_event ID_ | _message ID_]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdExportNewsletterSubscribers = &commands.FullHandler{
+	Func: fnExportNewsletterSubscribers,
+	Name: "export-newsletter-subscribers",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionChannels,
+		Description: "Export the subscriber list of the current channel as a CSV file. Only available for channel admins. The file is sent to your management room.",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdDisappearing = &commands.FullHandler{
+	Func: fnDisappearing,
+	Name: "disappearing",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "View or change the disappearing message timer of the current chat.",
+		Args:        "[off|24h|7d|90d]",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdSetGroupPictureOnlyAdmins = &commands.FullHandler{
+	Func: fnSetGroupPictureOnlyAdmins,
+	Name: "set-group-picture-only-admins",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroups,
+		Description: "Choose whether only admins can change the group picture. WhatsApp applies the same restriction to the group name and description.",
+		Args:        "<on|off>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdSearch = &commands.FullHandler{
+	Func: fnSearch,
+	Name: "search",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Search the messages bridged in the current chat. Only messages stored while message search is enabled in the bridge config can be found.",
+		Args:        "[--page <number>] <_query_>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdConvertGroupToCommunity = &commands.FullHandler{
+	Func: fnConvertGroupToCommunity,
+	Name: "convert-group-to-community",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroups,
+		Description: "Create a community from the current group. The group is linked into the new community, which can't be undone.",
+		Args:        "--confirm",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdGetStatusPrivacy = &commands.FullHandler{
+	Func: fnGetStatusPrivacy,
+	Name: "get-status-privacy",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "View who your WhatsApp status updates are shared with.",
+	},
+	RequiresLogin: true,
+}
+
+var cmdGetGroupLink = &commands.FullHandler{
+	Func: fnGetGroupLink,
+	Name: "get-group-link",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionInvites,
+		Description: "Get the existing invite link of the current group without resetting it.",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdSyncContact = &commands.FullHandler{
+	Func: fnSyncContact,
+	Name: "sync-contact",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "Refresh the name and avatar of a single WhatsApp user.",
+		Args:        "<_phone number_ | _Matrix user ID_>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdSendStatus = &commands.FullHandler{
+	Func: fnSendStatus,
+	Name: "send-status",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "Post a WhatsApp status update. Pass text, or reply to an image or video (or pass an mxc:// URI) to post a media status.",
+		Args:        "<_text_ | _mxc:// URI_> [--caption <_text_>]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdDeleteStatus = &commands.FullHandler{
+	Func: fnDeleteStatus,
+	Name: "delete-status",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "Delete a WhatsApp status update you posted. Pass the WhatsApp message ID or Matrix event ID, or reply to the status.",
+		Args:        "[_message ID_]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdDevices = &commands.FullHandler{
+	Func: fnDevices,
+	Name: "devices",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionAuth,
+		Description: "List the devices linked to your WhatsApp account, or log out one of them.",
+		Args:        "[logout <_index_> [--confirm]]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdListPortals = &commands.FullHandler{
+	Func: fnListPortals,
+	Name: "list-portals",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "List your bridged WhatsApp chats, grouped by type. `--active` only lists chats with messages in the last 24 hours.",
+		Args:        "[--type <_dm|group|newsletter|broadcast_>] [--active]",
+	},
+	RequiresLogin: true,
+}
+
+var cmdRecreatePortal = &commands.FullHandler{
+	Func: fnRecreatePortal,
+	Name: "recreate-portal",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionPortals,
+		Description: "Replace the current portal room with a new one created from fresh chat info. The old room is tombstoned.",
+		Args:        "--confirm",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdCopyGroup = &commands.FullHandler{
+	Func: fnCopyGroup,
+	Name: "copy-group",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroups,
+		Description: "Create a new WhatsApp group with the same members as the current group. The current group is left unchanged.",
+		Args:        "[--name <_new name_>]",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdGetProfile = &commands.FullHandler{
+	Func: fnGetProfile,
+	Name: "get-profile",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "View your own WhatsApp profile as WhatsApp shows it to your contacts.",
+	},
+	RequiresLogin: true,
+}
+
+var cmdInviteToGroup = &commands.FullHandler{
+	Func: fnInviteToGroup,
+	Name: "invite-to-group",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroups,
+		Description: "Add a WhatsApp user to the current group. Inviting their Matrix user or ghost to the room does the same.",
+		Args:        "<_phone number_ | _Matrix user ID_>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdExportContacts = &commands.FullHandler{
+	Func: fnExportContacts,
+	Name: "export-contacts",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionProfile,
+		Description: "Export the WhatsApp users you have direct chats with as a vCard file. The file is sent to your management room.",
+	},
+	RequiresLogin: true,
+}
+
+// getGroupInviteMessage finds the latest invite message to the given group in the current portal's receiver.
+func getGroupInviteMessage(ce *commands.Event, groupJID types.JID) (*database.Message, error) {
+	connector, ok := ce.Bridge.Network.(*WhatsAppConnector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected network connector type")
+	}
+	msgID, partID, err := connector.DB.GroupInvite.GetLatest(ce.Ctx, ce.Portal.Receiver, groupJID)
+	if err != nil || msgID == "" {
+		return nil, err
+	}
+	return ce.Bridge.DB.Message.GetPartByID(ce.Ctx, ce.Portal.Receiver, msgID, partID)
+}
+
 func fnAccept(ce *commands.Event) {
+	if len(ce.Args) > 0 && strings.HasPrefix(ce.Args[0], whatsmeow.InviteLinkPrefix) {
+		fnAcceptInviteLink(ce, ce.Args[0])
+		return
+	}
+	if len(ce.ReplyTo) == 0 && len(ce.Args) > 0 {
+		groupJID, err := types.ParseJID(ce.Args[0])
+		if err != nil || groupJID.Server != types.GroupServer {
+			ce.Reply("Invalid group JID")
+			return
+		}
+		message, err := getGroupInviteMessage(ce, groupJID)
+		if err != nil {
+			ce.Log.Err(err).Stringer("group_jid", groupJID).Msg("Failed to find group invite message")
+			ce.Reply("Failed to find group invite")
+			return
+		} else if message == nil {
+			ce.Reply("No invite to that group was found in this chat")
+			return
+		}
+		ce.ReplyTo = message.MXID
+	}
 	if len(ce.ReplyTo) == 0 {
-		ce.Reply("You must reply to a group invite message when using this command.")
+		ce.Reply("You must reply to a group invite message or pass the group JID when using this command.")
 	} else if message, err := ce.Bridge.DB.Message.GetPartByMXID(ce.Ctx, ce.ReplyTo); err != nil {
 		ce.Log.Err(err).Stringer("reply_to_mxid", ce.ReplyTo).Msg("Failed to get reply target event to handle !wa accept command")
 		ce.Reply("Failed to get reply event")
@@ -73,13 +616,17 @@ func fnAccept(ce *commands.Event) {
 		ce.Reply("Reply event not found")
 	} else if meta := message.Metadata.(*waid.MessageMetadata).GroupInvite; meta == nil {
 		ce.Reply("That doesn't look like a group invite message.")
+	} else if meta.IsExpired() {
+		ce.Reply("That group invite expired at %s", time.Unix(meta.Expiration, 0).UTC().Format(time.RFC1123))
 	} else if meta.Inviter.User == waid.ParseUserLoginID(ce.Portal.Receiver, 0).User {
 		ce.Reply("You can't accept your own invites")
 	} else if login := ce.Bridge.GetCachedUserLoginByID(ce.Portal.Receiver); login == nil {
 		ce.Reply("Login not found")
 	} else if !login.Client.IsLoggedIn() {
 		ce.Reply("Not logged in")
-	} else if err = login.Client.(*WhatsAppClient).Client.JoinGroupWithInvite(meta.JID, meta.Inviter, meta.Code, meta.Expiration); err != nil {
+	} else if meta.IsCommunity {
+		replyCommunityJoinResult(ce, login.Client.(*WhatsAppClient), meta)
+	} else if err = login.Client.(*WhatsAppClient).acceptGroupInvite(meta); err != nil {
 		ce.Log.Err(err).Msg("Failed to accept group invite")
 		ce.Reply("Failed to accept group invite: %v", err)
 	} else {
@@ -87,9 +634,71 @@ func fnAccept(ce *commands.Event) {
 	}
 }
 
-func fnListGroups(ce *commands.Event) {
-	if login := ce.User.GetDefaultLogin(); login == nil {
-		ce.Reply("No WhatsApp account found. Please use !wa login to connect your WhatsApp account.")
+// fnAcceptInviteLink joins a group using a chat.whatsapp.com link. If the group requires admin approval,
+// joining only sends a join request, which admins can handle with the approve-member command.
+func fnAcceptInviteLink(ce *commands.Event, link string) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	info, err := wa.Client.GetGroupInfoFromLink(link)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to resolve group invite link")
+		ce.Reply("Failed to resolve invite link: %v", err)
+		return
+	}
+	groupJID, err := wa.Client.JoinGroupWithLink(link)
+	if err != nil {
+		ce.Log.Err(err).Stringer("group_jid", info.JID).Msg("Failed to join group with invite link")
+		ce.Reply("Failed to join group: %v", err)
+		return
+	}
+	ce.Log.Info().
+		Stringer("group_jid", groupJID).
+		Bool("join_approval_required", info.IsJoinApprovalRequired).
+		Msg("Used group invite link")
+	if info.IsJoinApprovalRequired {
+		ce.Reply(
+			"Sent a request to join **%s**. A group admin must approve it before you can see messages, "+
+				"the portal will be created once the request is approved.",
+			info.Name,
+		)
+	} else {
+		ce.Reply("Successfully joined **%s**, the portal should be created momentarily", info.Name)
+	}
+}
+
+func replyCommunityJoinResult(ce *commands.Event, wa *WhatsAppClient, meta *waid.GroupInviteMeta) {
+	result, err := wa.acceptCommunityInvite(ce.Ctx, meta)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to accept community invite")
+		ce.Reply("Failed to accept community invite: %v", err)
+		return
+	}
+	var out strings.Builder
+	out.WriteString("Successfully joined the community, the space should be created momentarily.")
+	if result.SubGroupErr != nil {
+		_, _ = fmt.Fprintf(&out, "\n\nHowever, fetching the groups in the community failed: %v", result.SubGroupErr)
+		ce.Reply(out.String())
+		return
+	}
+	writeGroups := func(title string, groups []*types.GroupLinkTarget) {
+		if len(groups) == 0 {
+			return
+		}
+		_, _ = fmt.Fprintf(&out, "\n\n%s:\n", title)
+		for _, group := range groups {
+			_, _ = fmt.Fprintf(&out, "\n* %s (`%s`)", group.Name, group.JID)
+		}
+	}
+	writeGroups("Joined groups", result.Joined)
+	writeGroups("Groups that must be joined from a WhatsApp client", result.NotJoined)
+	ce.Reply(out.String())
+}
+
+func fnListGroups(ce *commands.Event) {
+	if login := ce.User.GetDefaultLogin(); login == nil {
+		ce.Reply("No WhatsApp account found. Please use !wa login to connect your WhatsApp account.")
 	} else if !login.Client.IsLoggedIn() {
 		ce.Reply("Not logged in")
 	} else {
@@ -148,3 +757,2678 @@ func fnTestSyncTimer(ce *commands.Event) {
 		}
 	}
 }
+
+func getLoggedInClient(ce *commands.Event) *WhatsAppClient {
+	login := ce.User.GetDefaultLogin()
+	if login == nil {
+		ce.Reply("No WhatsApp account found. Please use !wa login to connect your WhatsApp account.")
+		return nil
+	} else if !login.Client.IsLoggedIn() {
+		ce.Reply("Not logged in")
+		return nil
+	}
+	return login.Client.(*WhatsAppClient)
+}
+
+func fnQR(ce *commands.Event) {
+	login := ce.User.GetDefaultLogin()
+	if login == nil {
+		ce.Reply("No WhatsApp account found. Please use !wa login to connect your WhatsApp account.")
+		return
+	}
+	// The old device stays connected until the new QR code is scanned, see WALogin.Wait
+	ce.Reply("Scan the QR code below with the WhatsApp account +%s. Your existing portals will be kept.", waid.ParseUserLoginID(login.ID, 0).User)
+	ce.Args = []string{LoginFlowIDQR}
+	commands.CommandLogin.Func(ce)
+}
+
+// parseUserArg parses a command argument that's either a phone number or the Matrix ID of a WhatsApp ghost.
+func parseUserArg(ce *commands.Event, arg string) (types.JID, bool) {
+	if strings.HasPrefix(arg, "@") {
+		ghost, err := ce.Bridge.GetGhostByMXID(ce.Ctx, id.UserID(arg))
+		if err != nil {
+			ce.Log.Err(err).Str("user_id", arg).Msg("Failed to get ghost by Matrix ID")
+			return types.EmptyJID, false
+		} else if ghost == nil {
+			return types.EmptyJID, false
+		}
+		jid := waid.ParseUserID(ghost.ID)
+		return jid, jid.Server == types.DefaultUserServer
+	}
+	return parsePhoneArg(arg)
+}
+
+func fnSetGroupJoinApproval(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	groupJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || groupJID.Server != types.GroupServer {
+		ce.Reply("This command can only be used in group portals")
+		return
+	} else if len(ce.Args) != 1 || (ce.Args[0] != "on" && ce.Args[0] != "off") {
+		ce.Reply("**Usage:** `$cmdprefix set-group-join-approval <on|off>`")
+		return
+	}
+	required := ce.Args[0] == "on"
+	info, err := wa.Client.GetGroupInfo(groupJID)
+	if err != nil {
+		ce.Log.Warn().Err(err).Msg("Failed to get group info before changing join approval mode")
+	} else if info.IsIncognito {
+		ce.Log.Warn().
+			Stringer("group_jid", groupJID).
+			Bool("join_approval_required", required).
+			Msg("Changing join approval mode of an incognito group")
+	}
+	err = wa.Client.SetGroupJoinApprovalMode(groupJID, required)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to set group join approval mode")
+		ce.Reply("Failed to change join approval mode: %v", err)
+		return
+	}
+	wa.groupLinkCache.Delete(groupJID)
+	wa.UserLogin.QueueRemoteEvent(&simplevent.ChatInfoChange{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventChatInfoChange,
+			PortalKey: ce.Portal.PortalKey,
+			Timestamp: time.Now(),
+		},
+		ChatInfoChange: &bridgev2.ChatInfoChange{
+			MemberChanges: &bridgev2.ChatMemberList{
+				PowerLevels: &bridgev2.PowerLevelOverrides{
+					Invite: ptr.Ptr(joinApprovalInvitePL(required)),
+				},
+			},
+		},
+	})
+	if required {
+		ce.Reply("New members now need admin approval to join this group")
+	} else {
+		ce.Reply("Anyone with an invite link can now join this group without approval")
+	}
+}
+
+func fnHandleJoinRequest(ce *commands.Event, action whatsmeow.ParticipantRequestChange) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	groupJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || groupJID.Server != types.GroupServer {
+		ce.Reply("This command can only be used in group portals")
+		return
+	} else if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix %s-member <phone number or Matrix user ID>`", action)
+		return
+	}
+	userJID, ok := parseUserArg(ce, ce.Args[0])
+	if !ok {
+		ce.Reply("Invalid phone number or WhatsApp user")
+		return
+	}
+	results, err := wa.Client.UpdateGroupRequestParticipants(groupJID, []types.JID{userJID}, action)
+	if err != nil {
+		ce.Log.Err(err).Stringer("user_jid", userJID).Str("action", string(action)).Msg("Failed to update join request")
+		ce.Reply("Failed to %s join request: %v", action, err)
+		return
+	}
+	for _, result := range results {
+		if result.Error != 0 {
+			ce.Reply("Failed to %s join request of +%s (error %d). They may not have a pending request.", action, userJID.User, result.Error)
+			return
+		}
+	}
+	// Pending members are bridged as invites, so update the membership right away
+	// instead of waiting for WhatsApp to send the participant change.
+	member := wa.joinRequestResultMember(userJID, action)
+	wa.UserLogin.QueueRemoteEvent(&simplevent.ChatInfoChange{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventChatInfoChange,
+			PortalKey: ce.Portal.PortalKey,
+			Sender:    wa.makeEventSender(wa.JID),
+			Timestamp: time.Now(),
+		},
+		ChatInfoChange: &bridgev2.ChatInfoChange{
+			MemberChanges: &bridgev2.ChatMemberList{
+				MemberMap: map[networkid.UserID]bridgev2.ChatMember{
+					waid.MakeUserID(userJID): member,
+				},
+			},
+		},
+	})
+	if action == whatsmeow.ParticipantChangeApprove {
+		ce.Reply("Approved join request of +%s", userJID.User)
+	} else {
+		ce.Reply("Rejected join request of +%s", userJID.User)
+	}
+}
+
+func fnGetNewsletterInvite(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	} else if len(ce.Args) > 0 {
+		if strings.ToLower(ce.Args[0]) == "--revoke" {
+			ce.Reply("Revoking channel invite links isn't supported by the bridge, reset the link in the WhatsApp app instead")
+		} else {
+			ce.Reply("**Usage:** `$cmdprefix get-newsletter-invite`")
+		}
+		return
+	}
+	jid, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || jid.Server != types.NewsletterServer {
+		ce.Reply("This command can only be used in channel portals")
+		return
+	}
+	info, err := wa.Client.GetNewsletterInfo(jid)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get newsletter info")
+		ce.Reply("Failed to get channel info: %v", err)
+		return
+	} else if info.ViewerMeta == nil || (info.ViewerMeta.Role != types.NewsletterRoleAdmin && info.ViewerMeta.Role != types.NewsletterRoleOwner) {
+		ce.Reply("You must be an admin of the channel to get the invite link")
+		return
+	} else if info.ThreadMeta.InviteCode == "" {
+		ce.Reply("The channel doesn't have an invite link")
+		return
+	}
+	link := "https://whatsapp.com/channel/" + info.ThreadMeta.InviteCode
+	if ce.User.ManagementRoom == "" {
+		ce.Reply("You don't have a management room. Please start a direct chat with the bridge bot to receive the invite link.")
+	} else if ce.RoomID == ce.User.ManagementRoom {
+		ce.Reply("Invite link for %s: %s", info.ThreadMeta.Name.Text, link)
+	} else {
+		_, err = ce.Bot.SendMessage(ce.Ctx, ce.User.ManagementRoom, event.EventMessage, &event.Content{
+			Parsed: &event.MessageEventContent{
+				MsgType: event.MsgNotice,
+				Body:    fmt.Sprintf("Invite link for %s: %s", info.ThreadMeta.Name.Text, link),
+			},
+		}, nil)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to send invite link to management room")
+			ce.Reply("Failed to send invite link to your management room")
+		} else {
+			ce.Reply("Sent the invite link to your management room")
+		}
+	}
+}
+
+// maxNewsletterSubscriberExport is the maximum number of subscribers requested when exporting a channel's subscriber list.
+const maxNewsletterSubscriberExport = 10000
+
+func fnExportNewsletterSubscribers(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	jid, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || jid.Server != types.NewsletterServer {
+		ce.Reply("This command can only be used in channel portals")
+		return
+	}
+	info, err := wa.Client.GetNewsletterInfo(jid)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get newsletter info")
+		ce.Reply("Failed to get channel info: %v", err)
+		return
+	} else if info.ViewerMeta == nil || (info.ViewerMeta.Role != types.NewsletterRoleAdmin && info.ViewerMeta.Role != types.NewsletterRoleOwner) {
+		ce.Reply("You must be an admin of the channel to export the subscriber list")
+		return
+	}
+	count := min(max(info.ThreadMeta.SubscriberCount, 1), maxNewsletterSubscriberExport)
+	subscribers, err := wa.getNewsletterSubscribers(ce.Ctx, jid, count)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get newsletter subscribers")
+		ce.Reply("Failed to get channel subscribers: %v", err)
+		return
+	} else if len(subscribers) == 0 {
+		ce.Reply("%s doesn't have any subscribers", info.ThreadMeta.Name.Text)
+		return
+	}
+	var buf bytes.Buffer
+	csvWriter := csv.NewWriter(&buf)
+	_ = csvWriter.Write([]string{"jid", "phone", "role", "subscribed_at"})
+	for _, sub := range subscribers {
+		var phone, subscribedAt string
+		if sub.JID.Server == types.DefaultUserServer {
+			phone = "+" + sub.JID.User
+		}
+		if !sub.SubscribedAt.IsZero() {
+			subscribedAt = sub.SubscribedAt.UTC().Format(time.RFC3339)
+		}
+		_ = csvWriter.Write([]string{sub.JID.String(), phone, string(sub.Role), subscribedAt})
+	}
+	csvWriter.Flush()
+	if err = csvWriter.Error(); err != nil {
+		ce.Reply("Failed to write subscriber list: %v", err)
+		return
+	}
+	// The subscriber list contains phone numbers, so don't post it in the channel room
+	roomID := ce.User.ManagementRoom
+	if roomID == "" {
+		ce.Reply("You don't have a management room. Please start a direct chat with the bridge bot to receive the subscriber list.")
+		return
+	}
+	fileName := fmt.Sprintf("whatsapp-channel-subscribers-%s.csv", time.Now().Format("2006-01-02"))
+	data := buf.Bytes()
+	mxc, file, err := ce.Bot.UploadMedia(ce.Ctx, roomID, data, fileName, "text/csv")
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to upload subscriber export")
+		ce.Reply("Failed to upload subscriber list: %v", err)
+		return
+	}
+	_, err = ce.Bot.SendMessage(ce.Ctx, roomID, event.EventMessage, &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType:  event.MsgFile,
+			Body:     fileName,
+			FileName: fileName,
+			URL:      mxc,
+			File:     file,
+			Info: &event.FileInfo{
+				MimeType: "text/csv",
+				Size:     len(data),
+			},
+		},
+	}, nil)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send subscriber export")
+		ce.Reply("Failed to send subscriber list: %v", err)
+	} else {
+		ce.Reply(
+			"Exported %d of %d subscribers of %s to your management room",
+			len(subscribers), info.ThreadMeta.SubscriberCount, info.ThreadMeta.Name.Text,
+		)
+	}
+}
+
+func getPortalTypeName(jid types.JID) string {
+	switch jid.Server {
+	case types.DefaultUserServer, types.HiddenUserServer:
+		return "direct chat"
+	case types.GroupServer:
+		return "group"
+	case types.NewsletterServer:
+		return "channel"
+	case types.BroadcastServer:
+		if jid == types.StatusBroadcastJID {
+			return "status broadcast"
+		}
+		return "broadcast list"
+	default:
+		return "unknown"
+	}
+}
+
+func fnPortalID(ce *commands.Event) {
+	jid, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil {
+		ce.Reply("Failed to parse portal ID `%s`: %v", ce.Portal.ID, err)
+		return
+	}
+	lines := []string{
+		fmt.Sprintf("* **JID:** `%s`", jid),
+		fmt.Sprintf("* **Type:** %s", getPortalTypeName(jid)),
+	}
+	if jid.Server == types.DefaultUserServer {
+		lines = append(lines, fmt.Sprintf("* **Phone number:** +%s", jid.User))
+	}
+	if ce.Portal.Receiver != "" {
+		lines = append(lines, fmt.Sprintf("* **Receiver:** `%s`", ce.Portal.Receiver))
+	}
+	lines = append(lines, fmt.Sprintf("* **Room ID:** `%s`", ce.Portal.MXID))
+	ce.Reply("%s", strings.Join(lines, "\n"))
+}
+
+func parsePhoneArg(arg string) (types.JID, bool) {
+	phone := strings.TrimLeft(strings.TrimSpace(arg), "+")
+	if phone == "" {
+		return types.EmptyJID, false
+	}
+	for _, char := range phone {
+		if char < '0' || char > '9' {
+			return types.EmptyJID, false
+		}
+	}
+	return types.NewJID(phone, types.DefaultUserServer), true
+}
+
+func fnMigrateNumber(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	} else if len(ce.Args) < 2 {
+		ce.Reply("**Usage:** `$cmdprefix migrate-number <old phone> <new phone>`")
+		return
+	}
+	oldJID, ok := parsePhoneArg(ce.Args[0])
+	newJID, ok2 := parsePhoneArg(ce.Args[1])
+	if !ok || !ok2 {
+		ce.Reply("Phone numbers must be in international format, e.g. +1234567890")
+		return
+	} else if oldJID == newJID {
+		ce.Reply("The old and new phone numbers are the same")
+		return
+	}
+	err := wa.migrateContactNumber(ce.Ctx, oldJID, newJID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to migrate contact number")
+		ce.Reply("Failed to migrate chat: %v", err)
+	} else {
+		ce.Reply("Moved the chat with +%s to +%s", oldJID.User, newJID.User)
+	}
+}
+
+func formatStatusTime(ts *jsontime.Unix) string {
+	if ts == nil || ts.IsZero() {
+		return "no"
+	}
+	return ts.UTC().Format("2006-01-02 15:04:05 MST")
+}
+
+func fnMessageStatus(ce *commands.Event) {
+	eventID := ce.ReplyTo
+	if len(ce.Args) > 0 {
+		eventID = id.EventID(ce.Args[0])
+	}
+	if eventID == "" {
+		ce.Reply("**Usage:** `$cmdprefix message-status <event ID>`, or reply to a message")
+		return
+	}
+	message, err := ce.Bridge.DB.Message.GetPartByMXID(ce.Ctx, eventID)
+	if err != nil {
+		ce.Log.Err(err).Stringer("event_id", eventID).Msg("Failed to get message to check status")
+		ce.Reply("Failed to get message")
+		return
+	} else if message == nil {
+		ce.Reply("Message not found")
+		return
+	} else if message.SenderID != waid.MakeUserID(waid.ParseUserLoginID(ce.User.GetDefaultLogin().ID, 0)) {
+		ce.Reply("Delivery status is only tracked for your own messages")
+		return
+	}
+	meta := message.Metadata.(*waid.MessageMetadata)
+	ce.Reply(
+		"* **Sent:** %s\n* **Delivered:** %s\n* **Read:** %s",
+		message.Timestamp.UTC().Format("2006-01-02 15:04:05 MST"),
+		formatStatusTime(meta.DeliveredAt),
+		formatStatusTime(meta.ReadAt),
+	)
+}
+
+// messageInfoMaxAge is how long receipts are expected to arrive for a message.
+// Older messages without any receipts were most likely sent before receipts were tracked.
+const messageInfoMaxAge = 30 * 24 * time.Hour
+
+func fnMessageInfo(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	} else if ce.ReplyTo == "" {
+		ce.Reply("You must reply to a message when using this command.")
+		return
+	}
+	message, err := ce.Bridge.DB.Message.GetPartByMXID(ce.Ctx, ce.ReplyTo)
+	if err != nil {
+		ce.Log.Err(err).Stringer("reply_to_mxid", ce.ReplyTo).Msg("Failed to get message to show info")
+		ce.Reply("Failed to get message")
+		return
+	} else if message == nil || message.Room != ce.Portal.PortalKey {
+		ce.Reply("Message not found")
+		return
+	} else if message.SenderID != waid.MakeUserID(wa.JID) {
+		ce.Reply("Message info is only available for your own messages")
+		return
+	}
+	meta := message.Metadata.(*waid.MessageMetadata)
+	if meta.DeliveredAt == nil && len(meta.Receipts) == 0 && time.Since(message.Timestamp) > messageInfoMaxAge {
+		ce.Reply("No delivery info is available for this message, it may be too old")
+		return
+	}
+	portalJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil {
+		ce.Reply("Failed to parse portal ID: %v", err)
+		return
+	}
+	var out strings.Builder
+	_, _ = fmt.Fprintf(&out, "* **Sent:** %s\n", message.Timestamp.UTC().Format("2006-01-02 15:04:05 MST"))
+	if portalJID.Server != types.GroupServer {
+		_, _ = fmt.Fprintf(&out, "* **Delivered:** %s\n", formatStatusTime(meta.DeliveredAt))
+		_, _ = fmt.Fprintf(&out, "* **Read:** %s\n", formatStatusTime(meta.ReadAt))
+		ce.Reply("%s", out.String())
+		return
+	}
+	users := make([]string, 0, len(meta.Receipts))
+	for user := range meta.Receipts {
+		users = append(users, user)
+	}
+	slices.Sort(users)
+	var readBy, deliveredTo []string
+	for _, user := range users {
+		receipt := meta.Receipts[user]
+		name := wa.getContactName(types.NewJID(user, types.DefaultUserServer))
+		if receipt.ReadAt != nil {
+			readBy = append(readBy, fmt.Sprintf("  * %s (%s)", name, formatStatusTime(receipt.ReadAt)))
+		} else {
+			deliveredTo = append(deliveredTo, fmt.Sprintf("  * %s (%s)", name, formatStatusTime(receipt.DeliveredAt)))
+		}
+	}
+	_, _ = fmt.Fprintf(&out, "* **Read by %d:**\n", len(readBy))
+	for _, line := range readBy {
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	_, _ = fmt.Fprintf(&out, "* **Delivered to %d:**\n", len(deliveredTo))
+	for _, line := range deliveredTo {
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if recipientCount := wa.getGroupRecipientCount(portalJID); recipientCount > len(users) {
+		_, _ = fmt.Fprintf(&out, "* **Pending:** %d\n", recipientCount-len(users))
+	}
+	ce.Reply("%s", out.String())
+}
+
+func fnLink(ce *commands.Event) {
+	makePublic := len(ce.Args) > 0 && ce.Args[0] == "--public"
+	if len(ce.Args) > 0 && !makePublic {
+		ce.Reply("**Usage:** `$cmdprefix link [--public]`")
+		return
+	}
+	mx, ok := ce.Bridge.Matrix.(*matrix.Connector)
+	if !ok {
+		ce.Reply("Room aliases are not supported with this Matrix connector")
+		return
+	}
+	portalJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil {
+		ce.Reply("Failed to parse portal ID: %v", err)
+		return
+	}
+	if makePublic {
+		pl, err := ce.Bridge.Matrix.GetPowerLevels(ce.Ctx, ce.Portal.MXID)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to get power levels")
+			ce.Reply("Failed to get power levels: %v", err)
+			return
+		} else if pl.GetUserLevel(ce.User.MXID) < pl.GetEventLevel(event.StateJoinRules) {
+			ce.Reply("You don't have permission to change the join rules of this room")
+			return
+		}
+	}
+	var canonical event.CanonicalAliasEventContent
+	err = mx.Bot.StateEvent(ce.Ctx, ce.Portal.MXID, event.StateCanonicalAlias, "", &canonical)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		ce.Log.Err(err).Msg("Failed to get canonical alias of portal")
+		ce.Reply("Failed to get room alias: %v", err)
+		return
+	}
+	alias := canonical.Alias
+	if alias == "" {
+		localpart := "wa-" + portalJID.User
+		if portalJID.Server == types.DefaultUserServer {
+			localpart = "wa-+" + portalJID.User
+		}
+		alias = id.NewRoomAlias(localpart, ce.Bridge.Matrix.ServerName())
+		_, err = mx.Bot.CreateAlias(ce.Ctx, alias, ce.Portal.MXID)
+		if errors.Is(err, mautrix.MRoomInUse) {
+			var resp *mautrix.RespAliasResolve
+			resp, err = mx.Bot.ResolveAlias(ce.Ctx, alias)
+			if err == nil && resp.RoomID != ce.Portal.MXID {
+				ce.Reply("The alias %s already points to another room", alias)
+				return
+			}
+		}
+		if err != nil {
+			ce.Log.Err(err).Stringer("alias", alias).Msg("Failed to create room alias")
+			ce.Reply("Failed to create room alias: %v", err)
+			return
+		}
+		_, err = mx.Bot.SendStateEvent(ce.Ctx, ce.Portal.MXID, event.StateCanonicalAlias, "", &event.CanonicalAliasEventContent{Alias: alias})
+		if err != nil {
+			ce.Log.Warn().Err(err).Stringer("alias", alias).Msg("Failed to set canonical alias")
+		}
+	}
+	if makePublic {
+		_, err = mx.Bot.SendStateEvent(ce.Ctx, ce.Portal.MXID, event.StateJoinRules, "", &event.JoinRulesEventContent{
+			JoinRule: event.JoinRulePublic,
+		})
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to make room public")
+			ce.Reply("Failed to make the room public: %v", err)
+			return
+		}
+		ce.Reply(
+			"%s\n\n**Warning:** anyone with the link can now join the room and read new messages from the WhatsApp %s. "+
+				"Their messages will not be bridged unless they log in to the bridge.",
+			alias.URI().MatrixToURL(), getPortalTypeName(portalJID),
+		)
+	} else {
+		ce.Reply("%s", alias.URI().MatrixToURL())
+	}
+}
+
+func fnSetEncryption(ce *commands.Event) {
+	if len(ce.Args) != 1 || (ce.Args[0] != "on" && ce.Args[0] != "off") {
+		ce.Reply("**Usage:** `$cmdprefix set-encryption <on|off>`")
+		return
+	}
+	mx, ok := ce.Bridge.Matrix.(*matrix.Connector)
+	if !ok {
+		ce.Reply("Encryption is not supported with this Matrix connector")
+		return
+	}
+	var current event.EncryptionEventContent
+	err := mx.Bot.StateEvent(ce.Ctx, ce.Portal.MXID, event.StateEncryption, "", &current)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		ce.Log.Err(err).Msg("Failed to get encryption state of portal")
+		ce.Reply("Failed to check current encryption state: %v", err)
+		return
+	}
+	isEncrypted := current.Algorithm != ""
+	meta := ce.Portal.Metadata.(*waid.PortalMetadata)
+	if ce.Args[0] == "off" {
+		meta.Encrypted = false
+		if err = ce.Portal.Save(ce.Ctx); err != nil {
+			ce.Log.Err(err).Msg("Failed to save portal after disabling encryption")
+		}
+		if isEncrypted {
+			ce.Reply("Encryption can't be disabled in a Matrix room once it has been enabled. " +
+				"The room will stay encrypted, but it won't be re-encrypted if it's recreated.")
+		} else {
+			ce.Reply("Encryption is not enabled in this room")
+		}
+		return
+	} else if mx.Crypto == nil {
+		ce.Reply("Encryption is not enabled on this bridge")
+		return
+	}
+	meta.Encrypted = true
+	if isEncrypted {
+		meta.EncryptedRoomID = ce.Portal.MXID
+	} else if err = enablePortalEncryption(ce.Ctx, ce.Portal); err != nil {
+		ce.Log.Err(err).Msg("Failed to enable encryption in portal")
+		ce.Reply("Failed to enable encryption: %v", err)
+		return
+	}
+	if err = ce.Portal.Save(ce.Ctx); err != nil {
+		ce.Log.Err(err).Msg("Failed to save portal after enabling encryption")
+	}
+	if isEncrypted {
+		ce.Reply("Encryption is already enabled in this room")
+	} else {
+		ce.Reply("Encryption enabled. Note that the bridge bot can still read messages in this room, " +
+			"as it has to decrypt them to send them to WhatsApp.")
+	}
+}
+
+func fnChatFilter(ce *commands.Event) {
+	filter := &ce.Bridge.Network.(*WhatsAppConnector).Config.ChatFilter
+	if len(ce.Args) == 0 {
+		ce.Reply("Current chat filter:\n\n%s", filter.String())
+		return
+	}
+	args := ce.Args[1:]
+	var update func(cf *ChatFilter)
+	switch strings.ToLower(ce.Args[0]) {
+	case "types":
+		if len(args) == 0 {
+			ce.Reply("**Usage:** `$cmdprefix chat-filter types <category...|all>` (categories: %s)", strings.Join(ChatFilterCategories, ", "))
+			return
+		}
+		update = func(cf *ChatFilter) {
+			if len(args) == 1 && args[0] == "all" {
+				cf.Types = nil
+			} else {
+				cf.Types = args
+			}
+		}
+	case "mode":
+		if len(args) != 1 {
+			ce.Reply("**Usage:** `$cmdprefix chat-filter mode <allow|deny>`")
+			return
+		}
+		update = func(cf *ChatFilter) {
+			cf.Mode = args[0]
+		}
+	case "add":
+		if len(args) != 1 {
+			ce.Reply("**Usage:** `$cmdprefix chat-filter add <JID pattern>`")
+			return
+		}
+		update = func(cf *ChatFilter) {
+			if !slices.Contains(cf.JIDs, args[0]) {
+				cf.JIDs = append(cf.JIDs, args[0])
+			}
+		}
+	case "remove":
+		if len(args) != 1 {
+			ce.Reply("**Usage:** `$cmdprefix chat-filter remove <JID pattern>`")
+			return
+		}
+		update = func(cf *ChatFilter) {
+			cf.JIDs = slices.DeleteFunc(slices.Clone(cf.JIDs), func(pattern string) bool {
+				return pattern == args[0]
+			})
+		}
+	default:
+		ce.Reply("**Usage:** `$cmdprefix chat-filter [types <category...|all> | mode <allow|deny> | add <JID pattern> | remove <JID pattern>]`")
+		return
+	}
+	if err := filter.Update(update); err != nil {
+		ce.Reply("Failed to update chat filter: %v", err)
+		return
+	}
+	ce.Reply("Chat filter updated. Existing portals are not affected.\n\n%s", filter.String())
+}
+
+func fnGetLinkedDevices(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	devices, ok := getOwnLinkedDevices(ce, wa)
+	if !ok {
+		return
+	}
+	var out strings.Builder
+	out.WriteString("| # | Device ID | Platform | Registered | Current |\n")
+	out.WriteString("|---|-----------|----------|------------|---------|\n")
+	for i, device := range devices {
+		current := ""
+		if device.Device == wa.JID.Device {
+			current = "✅ this bridge"
+		}
+		_, _ = fmt.Fprintf(&out, "| %d | %d | %s | unknown | %s |\n", i+1, device.Device, linkedDevicePlatform(wa, device), current)
+	}
+	out.WriteString("\nWhatsApp doesn't share the platform or registration time of other devices with linked devices. " +
+		"If you don't recognize a device, log it out from the Linked devices menu on your phone.")
+	ce.Reply(out.String())
+}
+
+// getOwnLinkedDevices fetches the devices of the user's own account, sorted by device ID,
+// which is also the order used for device indexes in the devices command.
+func getOwnLinkedDevices(ce *commands.Event, wa *WhatsAppClient) ([]types.JID, bool) {
+	devices, err := wa.Client.GetUserDevicesContext(ce.Ctx, []types.JID{wa.JID.ToNonAD()})
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get linked devices")
+		ce.Reply("Failed to get linked devices: %v", err)
+		return nil, false
+	}
+	slices.SortFunc(devices, func(a, b types.JID) int {
+		return int(a.Device) - int(b.Device)
+	})
+	return devices, true
+}
+
+func linkedDevicePlatform(wa *WhatsAppClient, device types.JID) string {
+	if device.Device == 0 {
+		return "Primary phone"
+	} else if device.Device == wa.JID.Device {
+		return fmt.Sprintf("%s (%s)", wa.Main.Config.OSName, wa.Main.Config.BrowserName)
+	}
+	return "Linked device"
+}
+
+func fnUnlinkDevice(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	force := slices.Contains(ce.Args, "--force")
+	args := slices.DeleteFunc(slices.Clone(ce.Args), func(arg string) bool { return arg == "--force" })
+	if len(args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix unlink-device <device ID> [--force]`")
+		return
+	}
+	deviceID, err := strconv.ParseUint(args[0], 10, 16)
+	if err != nil {
+		ce.Reply("Invalid device ID %q, use `$cmdprefix get-linked-devices` to list devices", args[0])
+		return
+	} else if deviceID == 0 {
+		ce.Reply("The primary phone can't be unlinked")
+		return
+	}
+	log := ce.Log.With().Uint64("device_id", deviceID).Logger()
+	if uint16(deviceID) == wa.JID.Device {
+		if !force {
+			ce.Reply("Device %d is this bridge. Unlinking it will log out the bridge and stop bridging all chats. "+
+				"Run `$cmdprefix unlink-device %d --force` to confirm.", deviceID, deviceID)
+			return
+		}
+		log.Info().Msg("Unlinking bridge device by user request")
+		ce.Reply("Unlinking this bridge from WhatsApp")
+		wa.UserLogin.Logout(ce.Ctx)
+		return
+	}
+	ownJID := wa.JID.ToNonAD()
+	devices, err := wa.Client.GetUserDevicesContext(ce.Ctx, []types.JID{ownJID})
+	if err != nil {
+		log.Err(err).Msg("Failed to get linked devices before unlinking")
+		ce.Reply("Failed to get linked devices: %v", err)
+		return
+	}
+	target := ownJID
+	target.Device = uint16(deviceID)
+	if !slices.Contains(devices, target) {
+		ce.Reply("Device %d is not linked to your account", deviceID)
+		return
+	}
+	err = wa.logoutSecondaryDevice(ce.Ctx, target)
+	if err != nil {
+		log.Err(err).Msg("Failed to unlink device")
+		ce.Reply("Failed to unlink device: %v", err)
+		return
+	}
+	log.Info().Msg("Unlinked device by user request")
+	devices, err = wa.Client.GetUserDevicesContext(ce.Ctx, []types.JID{ownJID})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get linked devices after unlinking")
+		ce.Reply("Sent unlink request for device %d, but failed to confirm that it was removed", deviceID)
+	} else if slices.Contains(devices, target) {
+		ce.Reply("Sent unlink request for device %d, but it's still listed. It may take a moment to disappear.", deviceID)
+	} else {
+		ce.Reply("Successfully unlinked device %d", deviceID)
+	}
+}
+
+const portalMappingsPageSize = 50
+
+func fnPortalMappings(ce *commands.Event) {
+	usage := "**Usage:** `$cmdprefix portal-mappings [--type <dm|group|newsletter|broadcast>] [--login <login ID>] [page]`"
+	var filterType string
+	var loginID networkid.UserLoginID
+	page := 1
+	for i := 0; i < len(ce.Args); i++ {
+		switch arg := ce.Args[i]; {
+		case (arg == "--type" || arg == "--login") && i+1 < len(ce.Args):
+			i++
+			if arg == "--type" {
+				filterType = ce.Args[i]
+			} else {
+				loginID = networkid.UserLoginID(ce.Args[i])
+			}
+		default:
+			var err error
+			page, err = strconv.Atoi(arg)
+			if err != nil || page < 1 {
+				ce.Reply(usage)
+				return
+			}
+		}
+	}
+	if filterType != "" && !slices.Contains(ChatFilterCategories, filterType) {
+		ce.Reply("Invalid type %q, must be one of %s", filterType, strings.Join(ChatFilterCategories, ", "))
+		return
+	}
+	var login *bridgev2.UserLogin
+	if loginID != "" {
+		var err error
+		login, err = ce.Bridge.GetExistingUserLoginByID(ce.Ctx, loginID)
+		if err != nil {
+			ce.Log.Err(err).Str("login_id", string(loginID)).Msg("Failed to get login")
+			ce.Reply("Failed to get login: %v", err)
+			return
+		} else if login == nil {
+			ce.Reply("Login `%s` not found", loginID)
+			return
+		}
+	} else if login = ce.User.GetDefaultLogin(); login == nil {
+		ce.Reply("You're not logged in, use `--login` to choose a login")
+		return
+	}
+	userPortals, err := ce.Bridge.DB.UserPortal.GetAllForLogin(ce.Ctx, login.UserLogin)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get portals of login")
+		ce.Reply("Failed to get portals: %v", err)
+		return
+	}
+	var lines []string
+	for _, up := range userPortals {
+		jid, err := waid.ParsePortalID(up.Portal.ID)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("* `%s` - **invalid portal ID:** %v", up.Portal.ID, err))
+			continue
+		} else if filterType != "" && chatFilterCategory(jid) != filterType {
+			continue
+		}
+		line := fmt.Sprintf("* `%s` (%s)", jid, getPortalTypeName(jid))
+		portal, err := ce.Bridge.DB.Portal.GetByKey(ce.Ctx, up.Portal)
+		if err != nil {
+			line += fmt.Sprintf(" - failed to get portal: %v", err)
+		} else if portal == nil {
+			line += " - **orphaned:** portal row doesn't exist"
+		} else if portal.MXID == "" {
+			line += " - no Matrix room"
+		} else {
+			line += fmt.Sprintf(" - `%s`", portal.MXID)
+		}
+		if waid.MakePortalID(jid) != up.Portal.ID {
+			line += fmt.Sprintf(" - **ID mismatch:** expected `%s`", waid.MakePortalID(jid))
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		ce.Reply("No portals found")
+		return
+	}
+	slices.Sort(lines)
+	pageCount := (len(lines) + portalMappingsPageSize - 1) / portalMappingsPageSize
+	if page > pageCount {
+		ce.Reply("Page %d doesn't exist, there are %d pages", page, pageCount)
+		return
+	}
+	lines = lines[(page-1)*portalMappingsPageSize : min(page*portalMappingsPageSize, len(lines))]
+	ce.Reply("Portals of `%s` (page %d of %d):\n\n%s", login.ID, page, pageCount, strings.Join(lines, "\n"))
+}
+
+const stickersPageSize = 20
+
+func fnStickers(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	if len(ce.Args) > 0 && ce.Args[0] == "send" {
+		fnSendSticker(ce, wa)
+		return
+	}
+	page := 1
+	if len(ce.Args) > 0 {
+		var err error
+		page, err = strconv.Atoi(ce.Args[0])
+		if err != nil || page < 1 {
+			ce.Reply("**Usage:** `$cmdprefix stickers [page | send <number>]`")
+			return
+		}
+	}
+	total, err := wa.Main.DB.Sticker.Count(ce.Ctx, wa.UserLogin.ID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to count recent stickers")
+		ce.Reply("Failed to get stickers: %v", err)
+		return
+	} else if total == 0 {
+		ce.Reply("No stickers found. Recent stickers are synced from your phone when you log in.")
+		return
+	}
+	pageCount := (total + stickersPageSize - 1) / stickersPageSize
+	if page > pageCount {
+		ce.Reply("Page %d doesn't exist, there are %d pages", page, pageCount)
+		return
+	}
+	offset := (page - 1) * stickersPageSize
+	stickers, err := wa.Main.DB.Sticker.GetRecent(ce.Ctx, wa.UserLogin.ID, stickersPageSize, offset)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get recent stickers")
+		ce.Reply("Failed to get stickers: %v", err)
+		return
+	}
+	lines := make([]string, len(stickers))
+	for i, sticker := range stickers {
+		kind := "sticker"
+		if sticker.IsLottie {
+			kind = "animated sticker"
+		}
+		lines[i] = fmt.Sprintf("%d. %s, %dx%d, last sent %s", offset+i+1, kind, sticker.Width, sticker.Height, sticker.LastSent.UTC().Format("2006-01-02"))
+	}
+	ce.Reply(
+		"Recent stickers (page %d of %d):\n\n%s\n\nUse `$cmdprefix stickers send <number>` in a portal to send one.",
+		page, pageCount, strings.Join(lines, "\n"),
+	)
+}
+
+func fnSendSticker(ce *commands.Event, wa *WhatsAppClient) {
+	if ce.Portal == nil {
+		ce.Reply("Stickers can only be sent in portal rooms")
+		return
+	} else if len(ce.Args) != 2 {
+		ce.Reply("**Usage:** `$cmdprefix stickers send <number>`")
+		return
+	}
+	number, err := strconv.Atoi(ce.Args[1])
+	if err != nil || number < 1 {
+		ce.Reply("Invalid sticker number %q", ce.Args[1])
+		return
+	}
+	chatJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil {
+		ce.Reply("Failed to parse portal ID: %v", err)
+		return
+	}
+	stickers, err := wa.Main.DB.Sticker.GetRecent(ce.Ctx, wa.UserLogin.ID, 1, number-1)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get sticker to send")
+		ce.Reply("Failed to get sticker: %v", err)
+		return
+	} else if len(stickers) == 0 {
+		ce.Reply("Sticker %d not found", number)
+		return
+	}
+	msg := stickers[0].ToMessage()
+	resp, err := wa.Client.SendMessage(ce.Ctx, chatJID, msg)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send sticker")
+		ce.Reply("Failed to send sticker: %v", err)
+		return
+	}
+	// Messages sent by the bridge aren't echoed back, so bridge the sticker to Matrix like an incoming own message.
+	wa.handleWAMessage(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:     chatJID,
+				Sender:   wa.JID.ToNonAD(),
+				IsFromMe: true,
+				IsGroup:  chatJID.Server == types.GroupServer,
+			},
+			ID:        resp.ID,
+			Type:      "media",
+			MediaType: "sticker",
+			Timestamp: resp.Timestamp,
+		},
+		Message: msg,
+	})
+}
+
+func fnRequestHistory(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix request-history <days>`")
+		return
+	}
+	days, err := strconv.Atoi(ce.Args[0])
+	if err != nil || days < 1 {
+		ce.Reply("**Usage:** `$cmdprefix request-history <days>`")
+		return
+	} else if days > historyRequestMaxDays {
+		ce.Reply("You can request at most %d days of history", historyRequestMaxDays)
+		return
+	}
+	chatJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil {
+		ce.Reply("Failed to parse portal ID: %v", err)
+		return
+	}
+	firstMessage, err := ce.Bridge.DB.Message.GetFirstPortalMessage(ce.Ctx, ce.Portal.PortalKey)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get oldest message in portal")
+		ce.Reply("Failed to find the oldest bridged message: %v", err)
+		return
+	} else if firstMessage == nil {
+		ce.Reply("There are no bridged messages in this chat to request history before")
+		return
+	}
+	parsedID, err := waid.ParseMessageID(firstMessage.ID)
+	if err != nil {
+		ce.Reply("The oldest message in this chat can't be used to request history: %v", err)
+		return
+	}
+	anchor := &types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chatJID,
+			Sender:   parsedID.Sender,
+			IsFromMe: parsedID.Sender.User == wa.JID.User,
+		},
+		ID:        parsedID.ID,
+		Timestamp: firstMessage.Timestamp,
+	}
+	err = wa.requestHistory(ce.Ctx, anchor, &historyRequest{
+		cutoff: time.Now().AddDate(0, 0, -days),
+		roomID: ce.RoomID,
+	})
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send history request")
+		ce.Reply("Failed to request history: %v", err)
+		return
+	}
+	ce.Reply(
+		"Requested up to %d days of history before the oldest bridged message. "+
+			"Your phone must be online to respond, and WhatsApp may not return messages that have been deleted from it.",
+		days,
+	)
+}
+
+func fnSetGroupEphemeralDefault(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix set-group-ephemeral-default <off|24h|7d|90d>`")
+		return
+	}
+	timer, ok := whatsmeow.ParseDisappearingTimerString(ce.Args[0])
+	if !ok {
+		ce.Reply("Invalid timer, must be one of `off`, `24h`, `7d` or `90d`")
+		return
+	}
+	communityJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || communityJID.Server != types.GroupServer {
+		ce.Reply("This command can only be used in community portals")
+		return
+	}
+	pl, err := ce.Bridge.Matrix.GetPowerLevels(ce.Ctx, ce.Portal.MXID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get room power levels")
+		ce.Reply("Failed to check your power level: %v", err)
+		return
+	} else if pl.GetUserLevel(ce.User.MXID) < superAdminPL {
+		ce.Reply("Only community owners can change the default disappearing timer")
+		return
+	}
+	info, err := wa.Client.GetGroupInfo(communityJID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get community info")
+		ce.Reply("Failed to get community info: %v", err)
+		return
+	} else if !info.IsParent {
+		ce.Reply("This command can only be used in community portals")
+		return
+	}
+	// whatsmeow doesn't expose a community-level default timer, so set the timer in each linked group.
+	subGroups, err := wa.Client.GetSubGroups(communityJID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get community subgroups")
+		ce.Reply("Failed to get groups in community: %v", err)
+		return
+	}
+	var disappear database.DisappearingSetting
+	if timer > 0 {
+		disappear = database.DisappearingSetting{Type: database.DisappearingTypeAfterSend, Timer: timer}
+	}
+	var failed []string
+	for _, subGroup := range subGroups {
+		err = wa.Client.SetDisappearingTimer(subGroup.JID, timer)
+		if err != nil {
+			ce.Log.Err(err).Stringer("group_jid", subGroup.JID).Msg("Failed to set disappearing timer in subgroup")
+			failed = append(failed, fmt.Sprintf("* %s (`%s`): %v", subGroup.Name, subGroup.JID, err))
+			continue
+		}
+		wa.UserLogin.QueueRemoteEvent(&simplevent.ChatInfoChange{
+			EventMeta: simplevent.EventMeta{
+				Type:      bridgev2.RemoteEventChatInfoChange,
+				PortalKey: wa.makeWAPortalKey(subGroup.JID),
+				Timestamp: time.Now(),
+			},
+			ChatInfoChange: &bridgev2.ChatInfoChange{
+				ChatInfo: &bridgev2.ChatInfo{Disappear: &disappear},
+			},
+		})
+	}
+	succeeded := len(subGroups) - len(failed)
+	if len(failed) > 0 {
+		ce.Reply("Set disappearing timer in %d/%d groups. Failed groups:\n\n%s", succeeded, len(subGroups), strings.Join(failed, "\n"))
+	} else {
+		ce.Reply("Set disappearing timer to %s in all %d groups of the community", ce.Args[0], succeeded)
+	}
+}
+
+func formatDisappearingTimer(timer time.Duration) string {
+	if timer == 0 {
+		return "off"
+	}
+	return exfmt.Duration(timer)
+}
+
+func fnDisappearing(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	jid, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || jid.Server == types.NewsletterServer || jid.Server == types.BroadcastServer {
+		ce.Reply("Disappearing messages can only be changed in direct chats and groups")
+		return
+	}
+	if len(ce.Args) == 0 {
+		current := formatDisappearingTimer(ce.Portal.Disappear.Timer)
+		if setAt := ce.Portal.Metadata.(*waid.PortalMetadata).DisappearingTimerSetAt; setAt > 0 {
+			ce.Reply("Disappearing messages: **%s** (set at %s)", current, time.Unix(setAt, 0).UTC().Format(time.RFC1123))
+		} else {
+			ce.Reply("Disappearing messages: **%s**", current)
+		}
+		return
+	}
+	timer, ok := whatsmeow.ParseDisappearingTimerString(ce.Args[0])
+	if !ok {
+		ce.Reply("Invalid timer, must be one of `off`, `24h`, `7d` or `90d`")
+		return
+	}
+	if jid.Server == types.GroupServer {
+		info, err := wa.Client.GetGroupInfo(jid)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to get group info")
+			ce.Reply("Failed to get group info: %v", err)
+			return
+		}
+		if info.IsLocked && !slices.ContainsFunc(info.Participants, func(pcp types.GroupParticipant) bool {
+			return pcp.JID.User == wa.JID.User && pcp.IsAdmin
+		}) {
+			ce.Reply("Only group admins can change the disappearing timer in this group")
+			return
+		}
+	}
+	err = wa.Client.SetDisappearingTimer(jid, timer)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to set disappearing timer")
+		ce.Reply("Failed to set disappearing timer: %v", err)
+		return
+	}
+	if jid.Server == types.GroupServer {
+		info, err := wa.Client.GetGroupInfo(jid)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to get group info to confirm disappearing timer change")
+			ce.Reply("Disappearing timer was changed, but confirming the change failed: %v", err)
+			return
+		} else if actual := time.Duration(info.DisappearingTimer) * time.Second; actual != timer {
+			ce.Reply("WhatsApp didn't apply the change, the disappearing timer is still %s", formatDisappearingTimer(actual))
+			return
+		}
+	}
+	var disappear database.DisappearingSetting
+	if timer > 0 {
+		disappear = database.DisappearingSetting{Type: database.DisappearingTypeAfterSend, Timer: timer}
+	}
+	now := time.Now()
+	wa.UserLogin.QueueRemoteEvent(&simplevent.ChatInfoChange{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventChatInfoChange,
+			PortalKey: ce.Portal.PortalKey,
+			Sender:    wa.makeEventSender(wa.JID),
+			Timestamp: now,
+		},
+		ChatInfoChange: &bridgev2.ChatInfoChange{
+			ChatInfo: &bridgev2.ChatInfo{
+				Disappear:    &disappear,
+				ExtraUpdates: updateDisappearingTimerSetAt(now.Unix()),
+			},
+		},
+	})
+	ce.Reply("Disappearing messages set to **%s**", formatDisappearingTimer(timer))
+}
+
+func fnSetGroupPictureOnlyAdmins(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix set-group-picture-only-admins <on|off>`")
+		return
+	}
+	locked, ok := parseOnOff(ce.Args[0])
+	if !ok {
+		ce.Reply("Invalid value, must be `on` or `off`")
+		return
+	}
+	jid, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || jid.Server != types.GroupServer {
+		ce.Reply("This command can only be used in group portals")
+		return
+	}
+	info, err := wa.Client.GetGroupInfo(jid)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get group info")
+		ce.Reply("Failed to get group info: %v", err)
+		return
+	} else if !slices.ContainsFunc(info.Participants, func(pcp types.GroupParticipant) bool {
+		return pcp.JID.User == wa.JID.User && pcp.IsAdmin
+	}) {
+		ce.Reply("Only group admins can change who can edit the group picture")
+		return
+	} else if info.IsLocked == locked {
+		ce.Reply("The group picture can already be changed by %s", formatGroupEditors(locked))
+		return
+	}
+	// WhatsApp doesn't have a separate setting for the picture, locking the group restricts the name and description too.
+	err = wa.Client.SetGroupLocked(jid, locked)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to change group locked setting")
+		ce.Reply("Failed to change group setting: %v", err)
+		return
+	}
+	ce.Log.Info().Bool("locked", locked).Stringer("group_jid", jid).Msg("Changed group locked setting")
+	wa.UserLogin.QueueRemoteEvent(&simplevent.ChatInfoChange{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventChatInfoChange,
+			PortalKey: ce.Portal.PortalKey,
+			Sender:    wa.makeEventSender(wa.JID),
+			Timestamp: time.Now(),
+		},
+		ChatInfoChange: wa.wrapGroupInfoChange(&events.GroupInfo{
+			JID:    jid,
+			Locked: &types.GroupLocked{IsLocked: locked},
+		}, wa.getExistingPortalMetadata(jid)),
+	})
+	ce.Reply("The group picture, name and description can now be changed by %s", formatGroupEditors(locked))
+}
+
+func formatGroupEditors(locked bool) string {
+	if locked {
+		return "admins"
+	}
+	return "all members"
+}
+
+func fnConvertGroupToCommunity(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	groupJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || groupJID.Server != types.GroupServer {
+		ce.Reply("This command can only be used in group portals")
+		return
+	}
+	pl, err := ce.Bridge.Matrix.GetPowerLevels(ce.Ctx, ce.Portal.MXID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get room power levels")
+		ce.Reply("Failed to check your power level: %v", err)
+		return
+	} else if pl.GetUserLevel(ce.User.MXID) < superAdminPL {
+		ce.Reply("Only group owners can convert a group into a community")
+		return
+	}
+	info, err := wa.Client.GetGroupInfo(groupJID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get group info")
+		ce.Reply("Failed to get group info: %v", err)
+		return
+	} else if info.IsParent {
+		ce.Reply("This group is already a community")
+		return
+	} else if !info.LinkedParentJID.IsEmpty() {
+		ce.Reply("This group is already a part of a community")
+		return
+	} else if !slices.ContainsFunc(info.Participants, func(pcp types.GroupParticipant) bool {
+		return pcp.JID.User == wa.JID.User && pcp.IsAdmin
+	}) {
+		ce.Reply("You must be an admin of the group on WhatsApp to convert it into a community")
+		return
+	}
+	if len(ce.Args) == 0 || ce.Args[0] != "--confirm" {
+		ce.Reply(
+			"This will create a new community called **%s** and link this group into it. "+
+				"The change can't be undone. Run `$cmdprefix convert-group-to-community --confirm` to continue.",
+			info.Name,
+		)
+		return
+	}
+	// whatsmeow doesn't have a direct conversion API, so do what the official clients do:
+	// create a community with the same name and link the group into it.
+	community, err := wa.Client.CreateGroup(whatsmeow.ReqCreateGroup{
+		Name:        info.Name,
+		GroupParent: types.GroupParent{IsParent: true},
+	})
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to create community")
+		ce.Reply("Failed to create community: %v", err)
+		return
+	}
+	ce.Log.Info().
+		Stringer("group_jid", groupJID).
+		Stringer("community_jid", community.JID).
+		Msg("Created community to convert group")
+	err = wa.Client.LinkGroup(community.JID, groupJID)
+	if err != nil {
+		ce.Log.Err(err).Stringer("community_jid", community.JID).Msg("Failed to link group to new community")
+		ce.Reply("Created the community `%s`, but failed to link this group into it: %v", community.JID, err)
+		return
+	}
+	ce.Reply(
+		"Converted this group into the community **%s** (`%s`). "+
+			"This room is now a group in the community, the community space will be created momentarily.",
+		info.Name, community.JID,
+	)
+}
+
+func formatStatusPrivacyType(privacyType types.StatusPrivacyType) string {
+	switch privacyType {
+	case types.StatusPrivacyTypeContacts:
+		return "all contacts"
+	case types.StatusPrivacyTypeBlacklist:
+		return "all contacts except the users below"
+	case types.StatusPrivacyTypeWhitelist:
+		return "only the users below"
+	default:
+		return string(privacyType)
+	}
+}
+
+func fnGetStatusPrivacy(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	settings, err := wa.Client.GetStatusPrivacy()
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get status privacy settings")
+		ce.Reply("Failed to get status privacy settings: %v", err)
+		return
+	}
+	// The first setting is always the default, the others are only used when selected explicitly in the app
+	current := settings[0]
+	var out strings.Builder
+	_, _ = fmt.Fprintf(&out, "Your status updates are shared with %s", formatStatusPrivacyType(current.Type))
+	if current.Type != types.StatusPrivacyTypeContacts {
+		if len(current.List) == 0 {
+			out.WriteString("\n\n(the list is empty)")
+		} else {
+			out.WriteString(":\n")
+			for _, jid := range current.List {
+				_, _ = fmt.Fprintf(&out, "\n* %s (+%s)", wa.getContactName(jid), jid.User)
+			}
+		}
+	}
+	ce.Reply("%s", out.String())
+}
+
+const groupLinkCacheTTL = 5 * time.Minute
+
+type groupLinkCacheEntry struct {
+	link             string
+	approvalRequired bool
+	expiresAt        time.Time
+}
+
+// getGroupInviteLink gets the current invite link of a group and whether joining with it requires admin approval.
+// Links are cached for a few minutes, as they only change when they're reset.
+func (wa *WhatsAppClient) getGroupInviteLink(jid types.JID) (*groupLinkCacheEntry, error) {
+	if val, ok := wa.groupLinkCache.Load(jid); ok {
+		if entry := val.(*groupLinkCacheEntry); time.Now().Before(entry.expiresAt) {
+			return entry, nil
+		}
+	}
+	link, err := wa.Client.GetGroupInviteLink(jid, false)
+	if err != nil {
+		return nil, err
+	}
+	entry := &groupLinkCacheEntry{link: link, expiresAt: time.Now().Add(groupLinkCacheTTL)}
+	info, err := wa.Client.GetGroupInfo(jid)
+	if err != nil {
+		wa.UserLogin.Log.Warn().Err(err).Stringer("group_jid", jid).Msg("Failed to get group info to check join approval mode")
+	} else {
+		entry.approvalRequired = info.IsJoinApprovalRequired
+	}
+	wa.groupLinkCache.Store(jid, entry)
+	return entry, nil
+}
+
+func fnGetGroupLink(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	groupJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || groupJID.Server != types.GroupServer {
+		ce.Reply("This command can only be used in group portals")
+		return
+	}
+	entry, err := wa.getGroupInviteLink(groupJID)
+	if errors.Is(err, whatsmeow.ErrGroupInviteLinkUnauthorized) {
+		ce.Reply("Only group admins can get the invite link")
+		return
+	} else if err != nil {
+		ce.Log.Err(err).Msg("Failed to get group invite link")
+		ce.Reply("Failed to get group invite link: %v", err)
+		return
+	}
+	if entry.approvalRequired {
+		ce.Reply(
+			"Invite link for this group: [%s](%s)\n\n"+
+				"New members need admin approval to join. Joining with the link sends a request, "+
+				"which can be handled with `$cmdprefix approve-member` or `$cmdprefix reject-member`.",
+			entry.link, entry.link,
+		)
+	} else {
+		ce.Reply("Invite link for this group: [%s](%s)", entry.link, entry.link)
+	}
+}
+
+func fnSyncContact(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix sync-contact <phone number or Matrix user ID>`")
+		return
+	}
+	jid, ok := parseUserArg(ce, ce.Args[0])
+	if !ok {
+		ce.Reply("Invalid phone number or WhatsApp user")
+		return
+	}
+	resp, err := wa.Client.IsOnWhatsApp([]string{"+" + jid.User})
+	if err != nil {
+		ce.Log.Err(err).Stringer("jid", jid).Msg("Failed to check if user is on WhatsApp")
+		ce.Reply("Failed to check if +%s is on WhatsApp: %v", jid.User, err)
+		return
+	} else if len(resp) == 0 || !resp[0].IsIn {
+		ce.Reply("+%s is not on WhatsApp", jid.User)
+		return
+	}
+	jid = resp[0].JID
+	infos, err := wa.Client.GetUserInfo([]types.JID{jid})
+	if err != nil {
+		ce.Log.Err(err).Stringer("jid", jid).Msg("Failed to get user info")
+		ce.Reply("Failed to get user info: %v", err)
+		return
+	}
+	info := infos[jid]
+	var verifiedName string
+	if info.VerifiedName != nil {
+		verifiedName = info.VerifiedName.Details.GetVerifiedName()
+	}
+	ghost, err := ce.Bridge.GetGhostByID(ce.Ctx, waid.MakeUserID(jid))
+	if err != nil {
+		ce.Log.Err(err).Stringer("jid", jid).Msg("Failed to get ghost")
+		ce.Reply("Failed to get ghost: %v", err)
+		return
+	}
+	oldName, oldAvatarID := ghost.Name, ghost.AvatarID
+	userInfo, err := wa.getUserInfo(ce.Ctx, jid, verifiedName, true)
+	if err != nil {
+		ce.Log.Err(err).Stringer("jid", jid).Msg("Failed to get contact info")
+		ce.Reply("Failed to get contact info: %v", err)
+		return
+	}
+	applyGhostAbout(userInfo, info.Status)
+	applyGhostVerifiedName(userInfo, verifiedName)
+	ghost.UpdateInfo(ce.Ctx, userInfo)
+	var changes []string
+	if ghost.Name != oldName {
+		changes = append(changes, fmt.Sprintf("name changed from `%s` to `%s`", oldName, ghost.Name))
+	}
+	if ghost.AvatarID != oldAvatarID {
+		if ghost.AvatarID == "" || ghost.AvatarID == "remove" {
+			changes = append(changes, "avatar removed")
+		} else {
+			changes = append(changes, "avatar updated")
+		}
+	}
+	if len(changes) == 0 {
+		ce.Reply("Synced +%s, nothing changed", jid.User)
+	} else {
+		ce.Reply("Synced +%s: %s", jid.User, strings.Join(changes, ", "))
+	}
+}
+
+func fnSendStatus(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	args := ce.Args
+	var caption string
+	if idx := slices.Index(args, "--caption"); idx >= 0 {
+		caption = strings.Join(args[idx+1:], " ")
+		args = args[:idx]
+	}
+	var mxc id.ContentURIString
+	var file *event.EncryptedFileInfo
+	var mime string
+	if len(args) > 0 && strings.HasPrefix(args[0], "mxc://") {
+		mxc = id.ContentURIString(args[0])
+		if _, err := mxc.Parse(); err != nil {
+			ce.Reply("Invalid mxc:// URI: %v", err)
+			return
+		}
+	} else if len(args) == 0 && ce.ReplyTo != "" {
+		content, err := getReplyContent(ce)
+		if err != nil {
+			ce.Reply("%v", err)
+			return
+		} else if content.MsgType != event.MsgImage && content.MsgType != event.MsgVideo {
+			ce.Reply("That doesn't look like an image or a video")
+			return
+		}
+		mxc, file = content.URL, content.File
+		if file != nil {
+			mxc = file.URL
+		}
+		mime = content.GetInfo().MimeType
+	} else if len(args) == 0 {
+		ce.Reply("**Usage:** `$cmdprefix send-status <text | mxc:// URI> [--caption <text>]`, or reply to an image or video")
+		return
+	} else if caption != "" {
+		ce.Reply("Captions can only be used with media statuses")
+		return
+	}
+
+	var msg *waE2E.Message
+	if mxc == "" {
+		msg = &waE2E.Message{
+			ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+				Text: ptr.Ptr(strings.Join(args, " ")),
+			},
+		}
+	} else {
+		data, err := ce.Bot.DownloadMedia(ce.Ctx, mxc, file)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to download status media")
+			ce.Reply("Failed to download media: %v", err)
+			return
+		}
+		if mime == "" || mime == "application/octet-stream" {
+			mime = http.DetectContentType(data)
+		}
+		var mediaType whatsmeow.MediaType
+		switch {
+		case strings.HasPrefix(mime, "image/"):
+			mediaType = whatsmeow.MediaImage
+		case strings.HasPrefix(mime, "video/"):
+			mediaType = whatsmeow.MediaVideo
+		default:
+			ce.Reply("Unsupported media type %s, only images and videos can be posted as statuses", mime)
+			return
+		}
+		uploaded, err := wa.Client.Upload(ce.Ctx, data, mediaType)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to upload status media")
+			ce.Reply("Failed to upload media to WhatsApp: %v", err)
+			return
+		}
+		if mediaType == whatsmeow.MediaImage {
+			msg = &waE2E.Message{
+				ImageMessage: &waE2E.ImageMessage{
+					Caption:       ptr.NonZero(caption),
+					URL:           &uploaded.URL,
+					DirectPath:    &uploaded.DirectPath,
+					MediaKey:      uploaded.MediaKey,
+					Mimetype:      &mime,
+					FileEncSHA256: uploaded.FileEncSHA256,
+					FileSHA256:    uploaded.FileSHA256,
+					FileLength:    &uploaded.FileLength,
+				},
+			}
+		} else {
+			msg = &waE2E.Message{
+				VideoMessage: &waE2E.VideoMessage{
+					Caption:       ptr.NonZero(caption),
+					URL:           &uploaded.URL,
+					DirectPath:    &uploaded.DirectPath,
+					MediaKey:      uploaded.MediaKey,
+					Mimetype:      &mime,
+					FileEncSHA256: uploaded.FileEncSHA256,
+					FileSHA256:    uploaded.FileSHA256,
+					FileLength:    &uploaded.FileLength,
+				},
+			}
+		}
+	}
+	resp, err := wa.Client.SendMessage(ce.Ctx, types.StatusBroadcastJID, msg)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send status update")
+		ce.Reply("Failed to post status: %v", err)
+		return
+	}
+	ce.Reply("Posted status update (message ID `%s`)", resp.ID)
+}
+
+func fnDeleteStatus(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	var target string
+	if len(ce.Args) > 0 {
+		target = ce.Args[0]
+	} else if ce.ReplyTo != "" {
+		target = string(ce.ReplyTo)
+	} else {
+		ce.Reply("**Usage:** `$cmdprefix delete-status <message ID>`, or reply to the status")
+		return
+	}
+	msgID := types.MessageID(target)
+	if strings.HasPrefix(target, "$") {
+		message, err := ce.Bridge.DB.Message.GetPartByMXID(ce.Ctx, id.EventID(target))
+		if err != nil {
+			ce.Log.Err(err).Str("event_id", target).Msg("Failed to get status message")
+			ce.Reply("Failed to get message")
+			return
+		} else if message == nil {
+			ce.Reply("Message not found")
+			return
+		}
+		parsed, err := waid.ParseMessageID(message.ID)
+		if err != nil {
+			ce.Reply("Failed to parse message ID: %v", err)
+			return
+		} else if parsed.Chat != types.StatusBroadcastJID {
+			ce.Reply("That message isn't a status update")
+			return
+		} else if parsed.Sender.User != wa.JID.User {
+			ce.Reply("You can only delete your own status updates")
+			return
+		}
+		msgID = parsed.ID
+	}
+	_, err := wa.Client.RevokeMessage(types.StatusBroadcastJID, msgID)
+	if err != nil {
+		ce.Log.Err(err).Str("message_id", msgID).Msg("Failed to delete status update")
+		ce.Reply("Failed to delete status: %v", err)
+		return
+	}
+	// Revocations sent by the bridge aren't echoed back, so remove the bridged status from Matrix too
+	wa.UserLogin.QueueRemoteEvent(&simplevent.MessageRemove{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventMessageRemove,
+			PortalKey: wa.makeWAPortalKey(types.StatusBroadcastJID),
+			Sender:    wa.makeEventSender(wa.JID),
+			Timestamp: time.Now(),
+		},
+		TargetMessage: waid.MakeMessageID(types.StatusBroadcastJID, wa.JID.ToNonAD(), msgID),
+	})
+	ce.Reply("Deleted status update `%s`", msgID)
+}
+
+// fnDevices combines get-linked-devices and unlink-device, but refers to devices by their position in the list
+// and always asks for confirmation before unlinking.
+func fnDevices(ce *commands.Event) {
+	if len(ce.Args) == 0 || ce.Args[0] == "list" {
+		fnGetLinkedDevices(ce)
+		return
+	} else if ce.Args[0] != "logout" || len(ce.Args) < 2 {
+		ce.Reply("**Usage:** `$cmdprefix devices [logout <index> [--confirm]]`")
+		return
+	}
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	devices, ok := getOwnLinkedDevices(ce, wa)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(ce.Args[1])
+	if err != nil || index < 1 || index > len(devices) {
+		ce.Reply("Invalid device index %q, use `$cmdprefix devices` to list devices", ce.Args[1])
+		return
+	}
+	device := devices[index-1]
+	if len(ce.Args) < 3 || ce.Args[2] != "--confirm" {
+		ce.Reply("This will log out device %d (%s) from your WhatsApp account. Run `$cmdprefix devices logout %d --confirm` to continue.",
+			device.Device, linkedDevicePlatform(wa, device), index)
+		return
+	}
+	ce.Args = []string{strconv.Itoa(int(device.Device)), "--force"}
+	fnUnlinkDevice(ce)
+}
+
+const (
+	listPortalsPageSize     = 50
+	listPortalsActiveWindow = 24 * time.Hour
+)
+
+func fnListPortals(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	var filterType string
+	var onlyActive bool
+	for i := 0; i < len(ce.Args); i++ {
+		switch arg := ce.Args[i]; {
+		case arg == "--type" && i+1 < len(ce.Args):
+			i++
+			filterType = ce.Args[i]
+		case arg == "--active":
+			onlyActive = true
+		default:
+			ce.Reply("**Usage:** `$cmdprefix list-portals [--type <dm|group|newsletter|broadcast>] [--active]`")
+			return
+		}
+	}
+	if filterType != "" && !slices.Contains(ChatFilterCategories, filterType) {
+		ce.Reply("Invalid type %q, must be one of %s", filterType, strings.Join(ChatFilterCategories, ", "))
+		return
+	}
+	userPortals, err := ce.Bridge.DB.UserPortal.GetAllForLogin(ce.Ctx, wa.UserLogin.UserLogin)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get portals of login")
+		ce.Reply("Failed to get portals: %v", err)
+		return
+	}
+	activeSince := time.Now().Add(-listPortalsActiveWindow)
+	linesByType := make(map[string][]string)
+	for _, up := range userPortals {
+		jid, err := waid.ParsePortalID(up.Portal.ID)
+		if err != nil {
+			continue
+		}
+		category := chatFilterCategory(jid)
+		if filterType != "" && category != filterType {
+			continue
+		}
+		portal, err := ce.Bridge.GetExistingPortalByKey(ce.Ctx, up.Portal)
+		if err != nil {
+			ce.Log.Err(err).Stringer("portal_key", up.Portal).Msg("Failed to get portal to list")
+			continue
+		} else if portal == nil || portal.MXID == "" {
+			continue
+		}
+		if onlyActive {
+			lastMsg, err := ce.Bridge.DB.Message.GetLastPartAtOrBeforeTime(ce.Ctx, portal.PortalKey, time.Now())
+			if err != nil {
+				ce.Log.Err(err).Stringer("portal_key", portal.PortalKey).Msg("Failed to get last message in portal")
+				continue
+			} else if lastMsg == nil || lastMsg.Timestamp.Before(activeSince) {
+				continue
+			}
+		}
+		name := portal.Name
+		if name == "" && category == "dm" {
+			name = wa.getContactName(jid)
+		} else if name == "" {
+			name = jid.String()
+		}
+		linesByType[category] = append(linesByType[category], fmt.Sprintf("[%s](%s)", name, portal.MXID.URI().MatrixToURL()))
+	}
+	var out strings.Builder
+	var count int
+	for _, category := range ChatFilterCategories {
+		categoryLines := linesByType[category]
+		if len(categoryLines) == 0 {
+			continue
+		}
+		slices.SortFunc(categoryLines, func(a, b string) int {
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		})
+		_, _ = fmt.Fprintf(&out, "#### %s (%d)\n", chatFilterCategoryNames[category], len(categoryLines))
+		for _, line := range categoryLines {
+			if count > 0 && count%listPortalsPageSize == 0 {
+				ce.Reply("%s", out.String())
+				out.Reset()
+			}
+			out.WriteString("* " + line + "\n")
+			count++
+		}
+	}
+	if count == 0 {
+		ce.Reply("No portals found")
+		return
+	}
+	ce.Reply("%s", out.String())
+}
+
+var chatFilterCategoryNames = map[string]string{
+	"dm":         "Direct chats",
+	"group":      "Groups",
+	"newsletter": "Channels",
+	"broadcast":  "Broadcast lists",
+}
+
+func fnRecreatePortal(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	} else if ce.Portal.Receiver != "" && ce.Portal.Receiver != wa.UserLogin.ID {
+		ce.Reply("This portal belongs to another WhatsApp account")
+		return
+	} else if len(ce.Args) == 0 || ce.Args[0] != "--confirm" {
+		ce.Reply("This will create a new room for this chat and tombstone the current one. " +
+			"Messages in the current room stay there, but won't be copied to the new room. " +
+			"Run `$cmdprefix recreate-portal --confirm` to continue.")
+		return
+	}
+	info, err := wa.GetChatInfo(ce.Ctx, ce.Portal)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get chat info to recreate portal")
+		ce.Reply("Failed to get chat info: %v", err)
+		return
+	}
+	oldRoomID := ce.Portal.MXID
+	meta := ce.Portal.Metadata.(*waid.PortalMetadata)
+	oldCategory := meta.ChatCategory
+	// Clear the category so the state event is sent again in the new room
+	meta.ChatCategory = ""
+	err = ce.Portal.RemoveMXID(ce.Ctx)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to remove room ID from portal")
+		ce.Reply("Failed to detach the current room: %v", err)
+		return
+	}
+	err = ce.Portal.CreateMatrixRoom(ce.Ctx, wa.UserLogin, info)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to create new portal room")
+		if ce.Portal.MXID == "" {
+			// Reattach the old room so the portal isn't left without one
+			ce.Portal.MXID = oldRoomID
+			meta.ChatCategory = oldCategory
+			if saveErr := ce.Portal.Save(ce.Ctx); saveErr != nil {
+				ce.Log.Err(saveErr).Msg("Failed to restore old room ID after failing to recreate portal")
+			}
+		}
+		ce.Reply("Failed to create new room: %v", err)
+		return
+	}
+	_, err = ce.Bot.SendState(ce.Ctx, oldRoomID, event.StateTombstone, "", &event.Content{
+		Parsed: &event.TombstoneEventContent{
+			Body:            "This room has been replaced",
+			ReplacementRoom: ce.Portal.MXID,
+		},
+	}, time.Now())
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send tombstone to old portal room")
+	}
+	ce.Log.Info().
+		Stringer("old_room_id", oldRoomID).
+		Stringer("new_room_id", ce.Portal.MXID).
+		Msg("Recreated portal room by user request")
+	ce.Reply("Recreated portal: [%s](%s)", ce.Portal.MXID, ce.Portal.MXID.URI().MatrixToURL())
+}
+
+func fnCopyGroup(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	groupJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil {
+		ce.Reply("Failed to parse portal ID: %v", err)
+		return
+	} else if groupJID.Server != types.GroupServer {
+		ce.Reply("This command can only be used in group portals")
+		return
+	}
+	var name string
+	if len(ce.Args) > 0 {
+		if ce.Args[0] != "--name" || len(ce.Args) < 2 {
+			ce.Reply("**Usage:** `$cmdprefix copy-group [--name <new name>]`")
+			return
+		}
+		name = strings.Join(ce.Args[1:], " ")
+	}
+	info, err := wa.Client.GetGroupInfo(groupJID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get group info to copy group")
+		ce.Reply("Failed to get group info: %v", err)
+		return
+	} else if info.IsParent {
+		ce.Reply("Communities can't be copied")
+		return
+	}
+	if name == "" {
+		name = info.Name
+	}
+	var warnings []string
+	phones := make([]string, 0, len(info.Participants))
+	for _, pcp := range info.Participants {
+		if pcp.JID.User == wa.JID.User {
+			continue
+		} else if pcp.JID.Server != types.DefaultUserServer {
+			warnings = append(warnings, fmt.Sprintf("* `%s`: phone number unknown", pcp.JID))
+			continue
+		}
+		phones = append(phones, "+"+pcp.JID.User)
+	}
+	var participants []types.JID
+	if len(phones) > 0 {
+		resp, err := wa.Client.IsOnWhatsApp(phones)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to check if group members are on WhatsApp")
+			ce.Reply("Failed to check if group members are still on WhatsApp: %v", err)
+			return
+		}
+		for _, item := range resp {
+			if item.IsIn {
+				participants = append(participants, item.JID)
+			} else {
+				warnings = append(warnings, fmt.Sprintf("* %s: no longer on WhatsApp", item.Query))
+			}
+		}
+	}
+	newGroup, err := wa.Client.CreateGroup(whatsmeow.ReqCreateGroup{
+		Name:         name,
+		Participants: participants,
+	})
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to create copy of group")
+		ce.Reply("Failed to create group: %v", err)
+		return
+	}
+	ce.Log.Info().
+		Stringer("group_jid", groupJID).
+		Stringer("new_group_jid", newGroup.JID).
+		Int("participant_count", len(participants)).
+		Msg("Created copy of group")
+	for _, pcp := range newGroup.Participants {
+		if pcp.Error != 0 {
+			warnings = append(warnings, fmt.Sprintf("* %s: couldn't be added (error %d)", wa.getContactName(pcp.JID), pcp.Error))
+		}
+	}
+	portal, err := ce.Bridge.GetPortalByKey(ce.Ctx, wa.makeWAPortalKey(newGroup.JID))
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get portal for new group")
+		ce.Reply("Created the group `%s`, but failed to get its portal: %v", newGroup.JID, err)
+		return
+	}
+	err = portal.CreateMatrixRoom(ce.Ctx, wa.UserLogin, wa.wrapGroupInfo(newGroup))
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to create portal room for new group")
+		ce.Reply("Created the group `%s`, but failed to create its portal room: %v", newGroup.JID, err)
+		return
+	}
+	out := fmt.Sprintf("Created [%s](%s) with %d members", name, portal.MXID.URI().MatrixToURL(), len(participants))
+	if len(warnings) > 0 {
+		out += "\n\nSome members weren't copied:\n\n" + strings.Join(warnings, "\n")
+	}
+	ce.Reply("%s", out)
+}
+
+func fnGetProfile(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	ownJID := wa.JID.ToNonAD()
+	infos, err := wa.Client.GetUserInfo([]types.JID{ownJID})
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get own user info")
+		ce.Reply("Failed to get your profile: %v", err)
+		return
+	}
+	info := infos[ownJID]
+	lines := []string{
+		fmt.Sprintf("* **Phone number:** +%s", ownJID.User),
+		fmt.Sprintf("* **Push name:** %s", cmp.Or(wa.GetStore().PushName, "_not set_")),
+	}
+	if info.VerifiedName != nil {
+		lines = append(lines, fmt.Sprintf("* **Verified business name:** %s", info.VerifiedName.Details.GetVerifiedName()))
+	}
+	if info.Status != "" {
+		lines = append(lines, fmt.Sprintf("* **About:** %s", info.Status))
+	} else {
+		lines = append(lines, "* **About:** _not set_")
+	}
+	pic, err := wa.getProfilePictureInfo(ce.Ctx, ownJID, &whatsmeow.GetProfilePictureParams{})
+	switch {
+	case errors.Is(err, whatsmeow.ErrProfilePictureNotSet):
+		lines = append(lines, "* **Profile picture:** _not set_")
+	case errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized):
+		lines = append(lines, "* **Profile picture:** _hidden by your privacy settings_")
+	case err != nil:
+		ce.Log.Err(err).Msg("Failed to get own profile picture info")
+		lines = append(lines, fmt.Sprintf("* **Profile picture:** _failed to fetch: %v_", err))
+	case pic == nil:
+		lines = append(lines, "* **Profile picture:** _not set_")
+	default:
+		lines = append(lines, fmt.Sprintf("* **Profile picture:** [%s](%s)", pic.ID, pic.URL))
+	}
+	lines = append(lines, fmt.Sprintf("* **Linked devices:** %d", len(info.Devices)))
+	ce.Reply("Your WhatsApp profile:\n\n%s", strings.Join(lines, "\n"))
+}
+
+func fnInviteToGroup(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	groupJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil || groupJID.Server != types.GroupServer {
+		ce.Reply("This command can only be used in group portals")
+		return
+	} else if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix invite-to-group <phone number or Matrix user ID>`")
+		return
+	}
+	pl, err := ce.Bridge.Matrix.GetPowerLevels(ce.Ctx, ce.Portal.MXID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get power levels")
+		ce.Reply("Failed to get power levels: %v", err)
+		return
+	} else if pl.GetUserLevel(ce.User.MXID) < pl.Invite() {
+		ce.Reply("You don't have permission to invite people to this group")
+		return
+	}
+	var userJID types.JID
+	var ok bool
+	if strings.HasPrefix(ce.Args[0], "@") {
+		if user, _ := ce.Bridge.GetExistingUserByMXID(ce.Ctx, id.UserID(ce.Args[0])); user != nil {
+			if login := user.GetDefaultLogin(); login != nil {
+				userJID, ok = waid.ParseUserLoginID(login.ID, 0), true
+			}
+		}
+	}
+	if !ok {
+		userJID, ok = parseUserArg(ce, ce.Args[0])
+	}
+	if !ok {
+		ce.Reply("Invalid phone number or WhatsApp user")
+		return
+	}
+	err = wa.addGroupParticipant(groupJID, userJID)
+	if err != nil {
+		ce.Log.Err(err).Stringer("user_jid", userJID).Msg("Failed to add user to group")
+		ce.Reply("%s", err.Error())
+		return
+	}
+	ce.Reply("Added +%s to the group", userJID.User)
+}
+
+func fnResetBackfill(ce *commands.Event) {
+	login := ce.User.GetDefaultLogin()
+	if ce.Portal.Receiver != "" {
+		login = ce.Bridge.GetCachedUserLoginByID(ce.Portal.Receiver)
+		if login == nil || login.UserMXID != ce.User.MXID {
+			ce.Reply("This portal belongs to another WhatsApp account")
+			return
+		}
+	} else if login == nil {
+		ce.Reply("No WhatsApp account found. Please use !wa login to connect your WhatsApp account.")
+		return
+	}
+	if len(ce.Args) == 0 || ce.Args[0] != "--confirm" {
+		ce.Reply("This will make the bridge backfill the history of this chat again. " +
+			"Messages that were already bridged may end up duplicated if they can't be matched to the existing events. " +
+			"Run `$cmdprefix reset-backfill --confirm` to continue.")
+		return
+	}
+	err := ce.Bridge.DB.BackfillTask.Delete(ce.Ctx, ce.Portal.PortalKey)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to delete backfill task")
+		ce.Reply("Failed to reset backfill state: %v", err)
+		return
+	}
+	ce.Portal.Metadata.(*waid.PortalMetadata).LastSync = jsontime.Unix{}
+	err = ce.Portal.Save(ce.Ctx)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to save portal after resetting backfill state")
+		ce.Reply("Failed to reset backfill state: %v", err)
+		return
+	}
+	if ce.Bridge.Config.Backfill.Queue.Enabled {
+		err = ce.Bridge.DB.BackfillTask.EnsureExists(ce.Ctx, ce.Portal.PortalKey, login.ID)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to recreate backfill task")
+			ce.Reply("Backfill state was cleared, but recreating the backfill task failed: %v", err)
+			return
+		}
+		ce.Bridge.WakeupBackfillQueue()
+	}
+	ce.Log.Info().
+		Object("portal_key", ce.Portal.PortalKey).
+		Str("login_id", string(login.ID)).
+		Msg("Reset portal backfill state")
+	ce.Reply("Backfill state cleared, the chat will be backfilled again on the next sync")
+}
+
+func formatOnOff(val bool) string {
+	if val {
+		return "on"
+	}
+	return "off"
+}
+
+func parseOnOff(val string) (bool, bool) {
+	switch strings.ToLower(val) {
+	case "on", "true", "yes", "enabled":
+		return true, true
+	case "off", "false", "no", "disabled":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+func fnPortalSettings(ce *commands.Event) {
+	meta := ce.Portal.Metadata.(*waid.PortalMetadata)
+	if len(ce.Args) == 0 {
+		relayMode := formatOnOff(!meta.RelayDisabled)
+		if ce.Portal.RelayLoginID != "" {
+			relayMode += fmt.Sprintf(" (relay login: %s)", ce.Portal.RelayLoginID)
+		}
+		maxBackfill := "default"
+		if meta.MaxBackfillMessages > 0 {
+			maxBackfill = strconv.Itoa(meta.MaxBackfillMessages)
+		}
+		ce.Reply(
+			"```\nrelay_mode:            %s\nencryption:            %s\nauto_backfill:         %s\nmax_backfill_messages: %s\n```\n\n"+
+				"Use `$cmdprefix portal-settings set <key> <value>` to change a setting.",
+			relayMode, formatOnOff(meta.Encrypted), formatOnOff(!meta.BackfillDisabled), maxBackfill,
+		)
+		return
+	} else if len(ce.Args) != 3 || ce.Args[0] != "set" {
+		ce.Reply("**Usage:** `$cmdprefix portal-settings [set <key> <value>]`")
+		return
+	}
+	key, value := strings.ToLower(ce.Args[1]), ce.Args[2]
+	var oldValue, newValue string
+	switch key {
+	case "encryption":
+		ce.Log.Info().
+			Stringer("user_id", ce.User.MXID).
+			Str("setting", key).
+			Bool("old_value", meta.Encrypted).
+			Str("new_value", value).
+			Msg("Changing portal setting")
+		ce.Args = []string{value}
+		fnSetEncryption(ce)
+		return
+	case "relay_mode":
+		enabled, ok := parseOnOff(value)
+		if !ok {
+			ce.Reply("Invalid value for `relay_mode`, must be `on` or `off`")
+			return
+		}
+		oldValue, newValue = formatOnOff(!meta.RelayDisabled), formatOnOff(enabled)
+		meta.RelayDisabled = !enabled
+	case "auto_backfill":
+		enabled, ok := parseOnOff(value)
+		if !ok {
+			ce.Reply("Invalid value for `auto_backfill`, must be `on` or `off`")
+			return
+		}
+		oldValue, newValue = formatOnOff(!meta.BackfillDisabled), formatOnOff(enabled)
+		meta.BackfillDisabled = !enabled
+	case "max_backfill_messages":
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			ce.Reply("Invalid value for `max_backfill_messages`, must be a non-negative number (0 uses the bridge default)")
+			return
+		}
+		oldValue, newValue = strconv.Itoa(meta.MaxBackfillMessages), strconv.Itoa(limit)
+		meta.MaxBackfillMessages = limit
+	default:
+		ce.Reply("Unknown setting `%s`. Available settings: `relay_mode`, `encryption`, `auto_backfill`, `max_backfill_messages`", key)
+		return
+	}
+	err := ce.Portal.Save(ce.Ctx)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to save portal settings")
+		ce.Reply("Failed to save setting: %v", err)
+		return
+	}
+	ce.Log.Info().
+		Stringer("user_id", ce.User.MXID).
+		Str("setting", key).
+		Str("old_value", oldValue).
+		Str("new_value", newValue).
+		Msg("Changed portal setting")
+	ce.Reply("Changed `%s` from `%s` to `%s`", key, oldValue, newValue)
+}
+
+func getResendTarget(ce *commands.Event, wa *WhatsAppClient) (*database.Message, error) {
+	if len(ce.Args) == 0 {
+		return ce.Bridge.DB.Message.GetPartByMXID(ce.Ctx, ce.ReplyTo)
+	} else if strings.HasPrefix(ce.Args[0], "$") {
+		return ce.Bridge.DB.Message.GetPartByMXID(ce.Ctx, id.EventID(ce.Args[0]))
+	} else if _, err := waid.ParseMessageID(networkid.MessageID(ce.Args[0])); err == nil {
+		return ce.Bridge.DB.Message.GetPartByID(ce.Ctx, wa.UserLogin.ID, networkid.MessageID(ce.Args[0]), "")
+	} else if ce.Portal == nil {
+		return nil, nil
+	}
+	// Plain WhatsApp message IDs don't include the sender, so try the possible senders in the current chat
+	chatJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil {
+		return nil, err
+	}
+	senders := []types.JID{wa.JID.ToNonAD()}
+	if chatJID.Server == types.DefaultUserServer {
+		senders = append(senders, chatJID)
+	}
+	for _, sender := range senders {
+		msgID := waid.MakeMessageID(chatJID, sender, ce.Args[0])
+		message, err := ce.Bridge.DB.Message.GetPartByID(ce.Ctx, wa.UserLogin.ID, msgID, "")
+		if err != nil || message != nil {
+			return message, err
+		}
+	}
+	return nil, nil
+}
+
+func fnResend(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	} else if len(ce.Args) == 0 && ce.ReplyTo == "" {
+		ce.Reply("**Usage:** `$cmdprefix resend <event ID | message ID>`, or reply to a message")
+		return
+	}
+	message, err := getResendTarget(ce, wa)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get message to resend")
+		ce.Reply("Failed to get message")
+		return
+	} else if message == nil || (message.Room.Receiver != "" && message.Room.Receiver != wa.UserLogin.ID) {
+		ce.Reply("Message not found")
+		return
+	}
+	meta := message.Metadata.(*waid.MessageMetadata)
+	log := ce.Log.With().
+		Str("message_id", string(message.ID)).
+		Stringer("event_id", message.MXID).
+		Str("original_error", string(meta.Error)).
+		Logger()
+	switch meta.Error {
+	case waid.MsgErrMediaNotFound:
+		log.Info().Msg("Retrying download of media that failed to bridge")
+		err = wa.resendFailedMedia(message)
+		if err != nil {
+			log.Err(err).Msg("Failed to resend media")
+			ce.Reply("Failed to resend message: %v", err)
+		} else {
+			ce.Reply("Retrying media download, the message will be updated if it succeeds")
+		}
+	case waid.MsgErrDecryptionFailed:
+		parsedID, err := waid.ParseMessageID(message.ID)
+		if err != nil {
+			ce.Reply("Failed to parse message ID: %v", err)
+			return
+		}
+		log.Info().Msg("Requesting undecryptable message from phone")
+		err = wa.requestUnavailableMessage(ce.Ctx, parsedID.Chat, parsedID.Sender, parsedID.ID)
+		if err != nil {
+			log.Err(err).Msg("Failed to request undecryptable message from phone")
+			ce.Reply("Failed to request message from your phone: %v", err)
+		} else {
+			ce.Reply("Requested the message from your phone, it will be updated if the phone responds")
+		}
+	default:
+		ce.Reply("That message was bridged successfully, there's nothing to resend")
+	}
+}
+
+const searchResultsPerPage = 10
+const searchSnippetLength = 100
+
+// searchSnippet returns a part of the text around the first match of the (lowercased) query.
+func searchSnippet(text, query string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= searchSnippetLength {
+		return text
+	}
+	matchIndex := strings.Index(strings.ToLower(text), query)
+	runes := []rune(text)
+	start := max(utf8.RuneCountInString(text[:max(matchIndex, 0)])-searchSnippetLength/3, 0)
+	end := min(start+searchSnippetLength, len(runes))
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// markdownEscaper escapes user-controlled text that is inserted into markdown command replies.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "~", `\~`, "!", `\!`, "&", `\&`,
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+const (
+	searchMessagesWhere = `
+		WHERE bridge_id=$1 AND room_id=$2 AND room_receiver=$3 AND LOWER(%s) LIKE '%%' || $4 || '%%' ESCAPE '\'
+	`
+	countSearchMessagesQuery = `SELECT COUNT(*) FROM message ` + searchMessagesWhere
+	searchMessagesQuery      = `
+		SELECT rowid, bridge_id, id, part_id, mxid, room_id, room_receiver, sender_id, sender_mxid,
+		       timestamp, edit_count, double_puppeted, thread_root_id, reply_to_id, reply_to_part_id, metadata
+		FROM message
+	` + searchMessagesWhere + `
+		ORDER BY timestamp DESC, part_id DESC LIMIT $5 OFFSET $6
+	`
+)
+
+// searchPortalMessages finds messages whose stored search text contains the given lowercase query.
+// It returns the total number of matches and the messages on the requested page, newest first.
+func searchPortalMessages(ctx context.Context, db *database.Database, portal networkid.PortalKey, query string, page int) (int, []*database.Message, error) {
+	searchText := "json_extract(metadata, '$.search_text')"
+	if db.Dialect == dbutil.Postgres {
+		searchText = "metadata->>'search_text'"
+	}
+	args := []any{db.BridgeID, portal.ID, portal.Receiver, likeEscaper.Replace(query)}
+	var total int
+	err := db.QueryRow(ctx, fmt.Sprintf(countSearchMessagesQuery, searchText), args...).Scan(&total)
+	if err != nil || total == 0 {
+		return 0, nil, err
+	}
+	args = append(args, searchResultsPerPage, (page-1)*searchResultsPerPage)
+	messages, err := db.Message.QueryMany(ctx, fmt.Sprintf(searchMessagesQuery, searchText), args...)
+	return total, messages, err
+}
+
+func fnSearch(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	} else if !wa.Main.Config.MessageSearch {
+		ce.Reply("Message search is not enabled on this bridge")
+		return
+	} else if ce.Portal.Receiver != "" && ce.Portal.Receiver != wa.UserLogin.ID {
+		ce.Reply("This portal belongs to another WhatsApp account")
+		return
+	}
+	args := ce.Args
+	page := 1
+	if len(args) >= 2 && args[0] == "--page" {
+		var err error
+		page, err = strconv.Atoi(args[1])
+		if err != nil || page < 1 {
+			ce.Reply("Invalid page number")
+			return
+		}
+		args = args[2:]
+	}
+	query := strings.ToLower(strings.Join(args, " "))
+	if query == "" {
+		ce.Reply("**Usage:** `$cmdprefix search [--page <number>] <query>`")
+		return
+	}
+	total, matches, err := searchPortalMessages(ce.Ctx, ce.Bridge.DB, ce.Portal.PortalKey, query, page)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to search messages")
+		ce.Reply("Failed to search messages: %v", err)
+		return
+	} else if total == 0 {
+		ce.Reply("No messages found")
+		return
+	}
+	pageCount := (total + searchResultsPerPage - 1) / searchResultsPerPage
+	if page > pageCount {
+		ce.Reply("There are only %d pages of results", pageCount)
+		return
+	}
+	var out strings.Builder
+	_, _ = fmt.Fprintf(&out, "Found %d messages (page %d of %d):\n\n", total, page, pageCount)
+	for _, msg := range matches {
+		link := ce.Portal.MXID.EventURI(msg.MXID, ce.Bridge.Matrix.ServerName()).MatrixToURL()
+		senderName := string(msg.SenderID)
+		if msg.SenderID != "" {
+			senderName = wa.getContactName(waid.ParseUserID(msg.SenderID))
+		}
+		_, _ = fmt.Fprintf(
+			&out, "* [%s](%s) %s: %s\n",
+			msg.Timestamp.UTC().Format("2006-01-02 15:04"), link, markdownEscaper.Replace(senderName),
+			markdownEscaper.Replace(searchSnippet(msg.Metadata.(*waid.MessageMetadata).SearchText, query)),
+		)
+	}
+	if page < pageCount {
+		_, _ = fmt.Fprintf(&out, "\nUse `%s search --page %d %s` to see more results.", ce.Bridge.Config.CommandPrefix, page+1, strings.Join(args, " "))
+	}
+	ce.Reply("%s", out.String())
+}
+
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`)
+
+// getLoginContactGhostsQuery finds the ghosts of everyone the user login has a direct chat portal with.
+const getLoginContactGhostsQuery = `
+	SELECT bridge_id, id, name, avatar_id, avatar_hash, avatar_mxc,
+	       name_set, avatar_set, contact_info_set, is_bot, identifiers, metadata
+	FROM ghost
+	WHERE bridge_id=$1 AND id IN (
+		SELECT other_user_id FROM portal WHERE bridge_id=$1 AND receiver=$2 AND other_user_id IS NOT NULL
+	)
+`
+
+func fnExportContacts(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	// The contact list contains phone numbers, so don't post it in portal rooms
+	roomID := ce.User.ManagementRoom
+	if roomID == "" {
+		ce.Reply("You don't have a management room. Please start a direct chat with the bridge bot to receive the contact list.")
+		return
+	}
+	db := ce.Bridge.DB
+	ghosts, err := db.Ghost.QueryMany(ce.Ctx, getLoginContactGhostsQuery, db.BridgeID, wa.UserLogin.ID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to get contacts to export")
+		ce.Reply("Failed to get contacts: %v", err)
+		return
+	}
+	names := make(map[types.JID]string, len(ghosts))
+	jids := make([]types.JID, 0, len(ghosts))
+	for _, ghost := range ghosts {
+		jid := waid.ParseUserID(ghost.ID)
+		if jid.Server == types.DefaultUserServer {
+			jids = append(jids, jid)
+			names[jid] = ghost.Name
+		}
+	}
+	slices.SortFunc(jids, func(a, b types.JID) int {
+		return strings.Compare(a.User, b.User)
+	})
+	var buf strings.Builder
+	for _, jid := range jids {
+		name := names[jid]
+		if name == "" {
+			name = "+" + jid.User
+		}
+		buf.WriteString("BEGIN:VCARD\r\nVERSION:3.0\r\n")
+		_, _ = fmt.Fprintf(&buf, "FN:%s\r\n", vCardEscaper.Replace(name))
+		_, _ = fmt.Fprintf(&buf, "TEL;TYPE=CELL;waid=%s:+%s\r\n", jid.User, jid.User)
+		buf.WriteString("END:VCARD\r\n")
+	}
+	fileName := fmt.Sprintf("whatsapp-contacts-%s.vcf", time.Now().Format("2006-01-02"))
+	data := []byte(buf.String())
+	mxc, file, err := ce.Bot.UploadMedia(ce.Ctx, roomID, data, fileName, "text/vcard")
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to upload contact export")
+		ce.Reply("Failed to upload contact file: %v", err)
+		return
+	}
+	_, err = ce.Bot.SendMessage(ce.Ctx, roomID, event.EventMessage, &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType:  event.MsgFile,
+			Body:     fileName,
+			FileName: fileName,
+			URL:      mxc,
+			File:     file,
+			Info: &event.FileInfo{
+				MimeType: "text/vcard",
+				Size:     len(data),
+			},
+		},
+	}, nil)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send contact export")
+		ce.Reply("Failed to send contact file: %v", err)
+	} else {
+		ce.Reply("Exported %d contacts to your management room", len(jids))
+	}
+}
+
+// maxProfilePictureSize is the maximum width and height of profile pictures uploaded to WhatsApp.
+const maxProfilePictureSize = 640
+
+// minProfilePictureSize is the minimum width and height of profile pictures accepted by WhatsApp.
+const minProfilePictureSize = 192
+
+// maxProfilePictureSourcePixels is the maximum number of pixels in images that will be decoded for
+// profile pictures, so that small files with huge dimensions can't exhaust memory.
+const maxProfilePictureSourcePixels = 50_000_000
+
+func fnSetProfilePicture(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	var data []byte
+	var err error
+	if len(ce.Args) > 0 {
+		mxc := id.ContentURIString(ce.Args[0])
+		if _, err = mxc.Parse(); err != nil {
+			ce.Reply("Invalid mxc:// URI: %v", err)
+			return
+		}
+		data, err = ce.Bot.DownloadMedia(ce.Ctx, mxc, nil)
+	} else if ce.ReplyTo != "" {
+		mxc, file, replyErr := getReplyImage(ce)
+		if replyErr != nil {
+			ce.Reply("%v", replyErr)
+			return
+		}
+		data, err = ce.Bot.DownloadMedia(ce.Ctx, mxc, file)
+	} else {
+		ce.Reply("**Usage:** `$cmdprefix set-profile-picture [mxc:// URI]`, or reply to an image")
+		return
+	}
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to download profile picture")
+		ce.Reply("Failed to download image: %v", err)
+		return
+	}
+	data, cropped, err := convertProfilePicture(data)
+	if err != nil {
+		ce.Reply("Failed to convert image: %v", err)
+		return
+	}
+	pictureID, err := wa.Client.SetGroupPhoto(wa.JID.ToNonAD(), data)
+	if errors.Is(err, whatsmeow.ErrIQBadRequest) || errors.Is(err, whatsmeow.ErrIQNotAcceptable) {
+		ce.Log.Err(err).Msg("WhatsApp rejected profile picture")
+		ce.Reply("WhatsApp rejected the image. Make sure it's a regular photo that's at least %dx%d pixels.", minProfilePictureSize, minProfilePictureSize)
+		return
+	} else if err != nil {
+		ce.Log.Err(err).Msg("Failed to set profile picture")
+		ce.Reply("Failed to set profile picture: %v", err)
+		return
+	}
+	ce.Log.Debug().Str("picture_id", pictureID).Msg("Updated WhatsApp profile picture")
+	if cropped {
+		ce.Reply("Successfully updated your WhatsApp profile picture (ID `%s`). The image was cropped to a square.", pictureID)
+	} else {
+		ce.Reply("Successfully updated your WhatsApp profile picture (ID `%s`)", pictureID)
+	}
+}
+
+func fnRemoveProfilePicture(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	_, err := wa.Client.SetGroupPhoto(wa.JID.ToNonAD(), nil)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to remove profile picture")
+		ce.Reply("Failed to remove profile picture: %v", err)
+		return
+	}
+	ce.Reply("Successfully removed your WhatsApp profile picture")
+}
+
+// maxAboutLength is the maximum length of the about text in WhatsApp.
+const maxAboutLength = 139
+
+func fnSetAbout(ce *commands.Event) {
+	wa := getLoggedInClient(ce)
+	if wa == nil {
+		return
+	}
+	about := strings.TrimSpace(ce.RawArgs)
+	if about == "" {
+		ce.Reply("**Usage:** `$cmdprefix set-about <text | --clear>`")
+		return
+	} else if about == "--clear" {
+		about = ""
+	} else if length := utf8.RuneCountInString(about); length > maxAboutLength {
+		ce.Reply("About text is too long (%d characters, maximum is %d)", length, maxAboutLength)
+		return
+	}
+	err := wa.Client.SetStatusMessage(about)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to set about text")
+		ce.Reply("Failed to set about text: %v", err)
+		return
+	}
+	meta := wa.UserLogin.Metadata.(*waid.UserLoginMetadata)
+	oldAbout := meta.About
+	meta.About = about
+	err = wa.UserLogin.Save(ce.Ctx)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to save about text")
+	}
+	if about == "" {
+		ce.Reply("Cleared about text")
+	} else if oldAbout == "" {
+		ce.Reply("Set about text to %q", about)
+	} else {
+		ce.Reply("Changed about text from %q to %q", oldAbout, about)
+	}
+}
+
+func fnGetAbout(ce *commands.Event) {
+	login := ce.User.GetDefaultLogin()
+	if login == nil {
+		ce.Reply("No WhatsApp account found. Please use !wa login to connect your WhatsApp account.")
+	} else if about := login.Metadata.(*waid.UserLoginMetadata).About; about == "" {
+		ce.Reply("No about text has been set through the bridge")
+	} else {
+		ce.Reply("Your about text is %q", about)
+	}
+}
+
+func getReplyContent(ce *commands.Event) (*event.MessageEventContent, error) {
+	mx, ok := ce.Bridge.Matrix.(*matrix.Connector)
+	if !ok {
+		return nil, fmt.Errorf("fetching reply events is not supported")
+	}
+	evt, err := mx.Bot.GetEvent(ce.Ctx, ce.RoomID, ce.ReplyTo)
+	if err != nil {
+		ce.Log.Err(err).Stringer("reply_to_mxid", ce.ReplyTo).Msg("Failed to get reply target event")
+		return nil, fmt.Errorf("failed to get reply event")
+	}
+	_ = evt.Content.ParseRaw(evt.Type)
+	content, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if evt.Type == event.EventEncrypted {
+		return nil, fmt.Errorf("replying to encrypted media is not supported, please pass the mxc:// URI instead")
+	} else if !ok {
+		return nil, fmt.Errorf("that doesn't look like a message")
+	}
+	return content, nil
+}
+
+func getReplyImage(ce *commands.Event) (id.ContentURIString, *event.EncryptedFileInfo, error) {
+	content, err := getReplyContent(ce)
+	if err != nil {
+		return "", nil, err
+	} else if content.MsgType != event.MsgImage {
+		return "", nil, fmt.Errorf("that doesn't look like an image")
+	}
+	if content.File != nil {
+		return content.File.URL, content.File, nil
+	}
+	return content.URL, nil, nil
+}
+
+func convertProfilePicture(data []byte) ([]byte, bool, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode image: %w", err)
+	} else if min(cfg.Width, cfg.Height) < minProfilePictureSize {
+		return nil, false, fmt.Errorf("image is too small (%dx%d), it must be at least %dx%d pixels", cfg.Width, cfg.Height, minProfilePictureSize, minProfilePictureSize)
+	} else if cfg.Width*cfg.Height > maxProfilePictureSourcePixels {
+		return nil, false, fmt.Errorf("image is too large (%dx%d)", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode image: %w", err)
+	}
+	// WhatsApp profile pictures are square, so crop the center of the image
+	bounds := src.Bounds()
+	size := min(bounds.Dx(), bounds.Dy())
+	if size < minProfilePictureSize {
+		return nil, false, fmt.Errorf("image is too small (%dx%d), it must be at least %dx%d pixels", bounds.Dx(), bounds.Dy(), minProfilePictureSize, minProfilePictureSize)
+	}
+	crop := image.Rect(0, 0, size, size).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-size)/2,
+		bounds.Min.Y+(bounds.Dy()-size)/2,
+	))
+	targetSize := min(size, maxProfilePictureSize)
+	dst := image.NewRGBA(image.Rect(0, 0, targetSize, targetSize))
+	draw.CatmullRom.Scale(dst, dst.Rect, src, crop, draw.Over, nil)
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), bounds.Dx() != bounds.Dy(), nil
+}
@@ -1,20 +1,40 @@
 package connector
 
 import (
+	"cmp"
 	_ "embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"slices"
 	"strings"
+	"sync"
 	"text/template"
 
 	up "go.mau.fi/util/configupgrade"
+	"go.mau.fi/whatsmeow/proto/waCompanionReg"
 	"go.mau.fi/whatsmeow/types"
 	"gopkg.in/yaml.v3"
 	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
 
 	"go.mau.fi/mautrix-whatsapp/pkg/msgconv"
 )
 
 type MediaRequestMethod string
 
+const (
+	GroupReadReceiptsPerParticipant = "per_participant"
+	GroupReadReceiptsAggregate      = "aggregate"
+)
+
+const (
+	ConnectionNoticesOff         = "off"
+	ConnectionNoticesDisconnects = "disconnects"
+	ConnectionNoticesAll         = "all"
+)
+
 const (
 	MediaRequestMethodImmediate MediaRequestMethod = "immediate"
 	MediaRequestMethodLocalTime MediaRequestMethod = "local_time"
@@ -33,8 +53,16 @@ type Config struct {
 
 	DisplaynameTemplate string `yaml:"displayname_template"`
 
+	RelayMode           bool   `yaml:"relay_mode"`
+	RelayPrefixTemplate string `yaml:"relay_prefix_template"`
+
+	ChatNames ChatNameTemplates `yaml:"chat_names"`
+
 	CallStartNotices            bool          `yaml:"call_start_notices"`
 	IdentityChangeNotices       bool          `yaml:"identity_change_notices"`
+	GroupJoinNotices            bool          `yaml:"group_join_notices"`
+	DisappearingJoinNotices     bool          `yaml:"disappearing_join_notices"`
+	IgnoreOwnDeviceEchoes       bool          `yaml:"ignore_own_device_echoes"`
 	SendPresenceOnTyping        bool          `yaml:"send_presence_on_typing"`
 	EnableStatusBroadcast       bool          `yaml:"enable_status_broadcast"`
 	DisableStatusBroadcastSend  bool          `yaml:"disable_status_broadcast_send"`
@@ -48,13 +76,27 @@ type Config struct {
 	DisableViewOnce             bool          `yaml:"disable_view_once"`
 	ForceActiveDeliveryReceipts bool          `yaml:"force_active_delivery_receipts"`
 	DirectMediaAutoRequest      bool          `yaml:"direct_media_auto_request"`
+	SendTimeout                 int           `yaml:"send_timeout"`
+	RevokeWindow                int           `yaml:"revoke_window"`
+	GhostCacheTTL               int           `yaml:"ghost_cache_ttl"`
+	ConnectStaggerWindow        int           `yaml:"connect_stagger_window"`
+	HealthDownThreshold         int           `yaml:"health_down_threshold"`
+	MessageSearch               bool          `yaml:"message_search"`
+	GroupReadReceipts           string        `yaml:"group_read_receipts"`
+	ConnectionNotices           string        `yaml:"connection_notices"`
+	FFmpegPath                  string        `yaml:"ffmpeg_path"`
+	MediaMaxConcurrent          int           `yaml:"media_max_concurrent_transfers"`
+	MediaStreamThresholdMB      int           `yaml:"media_stream_threshold_mb"`
 
 	AnimatedSticker msgconv.AnimatedStickerConfig `yaml:"animated_sticker"`
 
+	ChatFilter ChatFilter `yaml:"chat_filter"`
+
 	HistorySync struct {
-		MaxInitialConversations int  `yaml:"max_initial_conversations"`
-		RequestFullSync         bool `yaml:"request_full_sync"`
-		FullSyncConfig          struct {
+		MaxInitialConversations   int  `yaml:"max_initial_conversations"`
+		MaxInitialConversationAge int  `yaml:"max_initial_conversation_age"`
+		RequestFullSync           bool `yaml:"request_full_sync"`
+		FullSyncConfig            struct {
 			DaysLimit    uint32 `yaml:"days_limit"`
 			SizeLimit    uint32 `yaml:"size_mb_limit"`
 			StorageQuota uint32 `yaml:"storage_quota_mb"`
@@ -68,7 +110,8 @@ type Config struct {
 		} `yaml:"media_requests"`
 	} `yaml:"history_sync"`
 
-	displaynameTemplate *template.Template `yaml:"-"`
+	displaynameTemplate *template.Template     `yaml:"-"`
+	relayPrefixTemplate *htmltemplate.Template `yaml:"-"`
 }
 
 type umConfig Config
@@ -84,7 +127,202 @@ func (c *Config) UnmarshalYAML(node *yaml.Node) error {
 func (c *Config) PostProcess() error {
 	var err error
 	c.displaynameTemplate, err = template.New("displayname").Parse(c.DisplaynameTemplate)
-	return err
+	if err != nil {
+		return err
+	}
+	c.relayPrefixTemplate, err = htmltemplate.New("relay_prefix").Parse(c.RelayPrefixTemplate)
+	if err != nil {
+		return err
+	}
+	if err = c.ChatFilter.validate(); err != nil {
+		return err
+	}
+	return c.ChatNames.parse()
+}
+
+const (
+	ChatFilterModeAllow = "allow"
+	ChatFilterModeDeny  = "deny"
+)
+
+// ChatFilterCategories are the chat categories that can be listed in chat_filter.types.
+var ChatFilterCategories = []string{"dm", "group", "newsletter", "broadcast"}
+
+// ChatFilter decides which WhatsApp chats are allowed to have portals.
+// It can be changed at runtime with the chat-filter command, so all access goes through the methods.
+type ChatFilter struct {
+	Types []string `yaml:"types"`
+	Mode  string   `yaml:"mode"`
+	JIDs  []string `yaml:"jids"`
+
+	lock sync.RWMutex `yaml:"-"`
+}
+
+func chatFilterCategory(jid types.JID) string {
+	switch jid.Server {
+	case types.DefaultUserServer, types.HiddenUserServer:
+		return "dm"
+	case types.GroupServer:
+		return "group"
+	case types.NewsletterServer:
+		return "newsletter"
+	case types.BroadcastServer:
+		return "broadcast"
+	default:
+		return ""
+	}
+}
+
+func (cf *ChatFilter) validate() error {
+	for _, category := range cf.Types {
+		if !slices.Contains(ChatFilterCategories, category) {
+			return fmt.Errorf("invalid chat_filter.types entry %q", category)
+		}
+	}
+	for _, pattern := range cf.JIDs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid chat_filter.jids pattern %q: %w", pattern, err)
+		}
+	}
+	switch cf.Mode {
+	case "":
+		cf.Mode = ChatFilterModeDeny
+	case ChatFilterModeAllow, ChatFilterModeDeny:
+	default:
+		return fmt.Errorf("invalid chat_filter.mode %q", cf.Mode)
+	}
+	return nil
+}
+
+// Allows returns true if the given chat should be bridged.
+func (cf *ChatFilter) Allows(jid types.JID) bool {
+	cf.lock.RLock()
+	defer cf.lock.RUnlock()
+	if len(cf.Types) > 0 && !slices.Contains(cf.Types, chatFilterCategory(jid)) {
+		return false
+	}
+	jidStr := jid.ToNonAD().String()
+	matched := slices.ContainsFunc(cf.JIDs, func(pattern string) bool {
+		ok, _ := path.Match(pattern, jidStr)
+		return ok
+	})
+	if cf.Mode == ChatFilterModeAllow {
+		return matched
+	}
+	return !matched
+}
+
+// Update applies a change to the filter and validates the result, reverting the change if it's invalid.
+func (cf *ChatFilter) Update(fn func(cf *ChatFilter)) error {
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+	oldTypes, oldMode, oldJIDs := slices.Clone(cf.Types), cf.Mode, slices.Clone(cf.JIDs)
+	fn(cf)
+	if err := cf.validate(); err != nil {
+		cf.Types, cf.Mode, cf.JIDs = oldTypes, oldMode, oldJIDs
+		return err
+	}
+	return nil
+}
+
+// String returns a human-readable summary of the filter.
+func (cf *ChatFilter) String() string {
+	cf.lock.RLock()
+	defer cf.lock.RUnlock()
+	categories := "all"
+	if len(cf.Types) > 0 {
+		categories = strings.Join(cf.Types, ", ")
+	}
+	jids := "none"
+	if len(cf.JIDs) > 0 {
+		jids = "`" + strings.Join(cf.JIDs, "`, `") + "`"
+	}
+	return fmt.Sprintf("* Chat types: %s\n* JID list mode: %s\n* JID patterns: %s", categories, cf.Mode, jids)
+}
+
+type ChatNameTemplates struct {
+	StatusBroadcastName  string `yaml:"status_broadcast_name"`
+	StatusBroadcastTopic string `yaml:"status_broadcast_topic"`
+	BroadcastTopic       string `yaml:"broadcast_topic"`
+	UnnamedBroadcastName string `yaml:"unnamed_broadcast_name"`
+	PrivateChatTopic     string `yaml:"private_chat_topic"`
+
+	statusBroadcastName  *template.Template `yaml:"-"`
+	statusBroadcastTopic *template.Template `yaml:"-"`
+	broadcastTopic       *template.Template `yaml:"-"`
+	unnamedBroadcastName *template.Template `yaml:"-"`
+	privateChatTopic     *template.Template `yaml:"-"`
+}
+
+type ChatNameParams struct {
+	// The push name of the bridge account
+	AccountName string
+	// The phone number of the bridge account (international format)
+	Phone string
+}
+
+func parseChatNameTemplate(name, value, defaultValue string) (*template.Template, error) {
+	if value == "" {
+		value = defaultValue
+	}
+	tpl, err := template.New(name).Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chat_names.%s: %w", name, err)
+	}
+	return tpl, nil
+}
+
+func (cnt *ChatNameTemplates) parse() (err error) {
+	cnt.statusBroadcastName, err = parseChatNameTemplate("status_broadcast_name", cnt.StatusBroadcastName, StatusBroadcastName)
+	if err != nil {
+		return
+	}
+	cnt.statusBroadcastTopic, err = parseChatNameTemplate("status_broadcast_topic", cnt.StatusBroadcastTopic, StatusBroadcastTopic)
+	if err != nil {
+		return
+	}
+	cnt.broadcastTopic, err = parseChatNameTemplate("broadcast_topic", cnt.BroadcastTopic, BroadcastTopic)
+	if err != nil {
+		return
+	}
+	cnt.unnamedBroadcastName, err = parseChatNameTemplate("unnamed_broadcast_name", cnt.UnnamedBroadcastName, UnnamedBroadcastName)
+	if err != nil {
+		return
+	}
+	cnt.privateChatTopic, err = parseChatNameTemplate("private_chat_topic", cnt.PrivateChatTopic, PrivateChatTopic)
+	return
+}
+
+func executeChatNameTemplate(tpl *template.Template, fallback string, params *ChatNameParams) string {
+	if tpl == nil {
+		return fallback
+	}
+	var buf strings.Builder
+	err := tpl.Execute(&buf, params)
+	if err != nil {
+		return fallback
+	}
+	return buf.String()
+}
+
+func (cnt *ChatNameTemplates) FormatStatusBroadcastName(params *ChatNameParams) string {
+	return executeChatNameTemplate(cnt.statusBroadcastName, StatusBroadcastName, params)
+}
+
+func (cnt *ChatNameTemplates) FormatStatusBroadcastTopic(params *ChatNameParams) string {
+	return executeChatNameTemplate(cnt.statusBroadcastTopic, StatusBroadcastTopic, params)
+}
+
+func (cnt *ChatNameTemplates) FormatBroadcastTopic(params *ChatNameParams) string {
+	return executeChatNameTemplate(cnt.broadcastTopic, BroadcastTopic, params)
+}
+
+func (cnt *ChatNameTemplates) FormatUnnamedBroadcastName(params *ChatNameParams) string {
+	return executeChatNameTemplate(cnt.unnamedBroadcastName, UnnamedBroadcastName, params)
+}
+
+func (cnt *ChatNameTemplates) FormatPrivateChatTopic(params *ChatNameParams) string {
+	return executeChatNameTemplate(cnt.privateChatTopic, PrivateChatTopic, params)
 }
 
 func upgradeConfig(helper up.Helper) {
@@ -96,9 +334,20 @@ func upgradeConfig(helper up.Helper) {
 	helper.Copy(up.Bool, "proxy_only_login")
 
 	helper.Copy(up.Str, "displayname_template")
+	helper.Copy(up.Bool, "relay_mode")
+	helper.Copy(up.Str, "relay_prefix_template")
+
+	helper.Copy(up.Str, "chat_names", "status_broadcast_name")
+	helper.Copy(up.Str, "chat_names", "status_broadcast_topic")
+	helper.Copy(up.Str, "chat_names", "broadcast_topic")
+	helper.Copy(up.Str, "chat_names", "unnamed_broadcast_name")
+	helper.Copy(up.Str, "chat_names", "private_chat_topic")
 
 	helper.Copy(up.Bool, "call_start_notices")
 	helper.Copy(up.Bool, "identity_change_notices")
+	helper.Copy(up.Bool, "group_join_notices")
+	helper.Copy(up.Bool, "disappearing_join_notices")
+	helper.Copy(up.Bool, "ignore_own_device_echoes")
 	helper.Copy(up.Bool, "send_presence_on_typing")
 	helper.Copy(up.Bool, "enable_status_broadcast")
 	helper.Copy(up.Bool, "disable_status_broadcast_send")
@@ -112,13 +361,29 @@ func upgradeConfig(helper up.Helper) {
 	helper.Copy(up.Bool, "disable_view_once")
 	helper.Copy(up.Bool, "force_active_delivery_receipts")
 	helper.Copy(up.Bool, "direct_media_auto_request")
+	helper.Copy(up.Int, "send_timeout")
+	helper.Copy(up.Int, "revoke_window")
+	helper.Copy(up.Int, "ghost_cache_ttl")
+	helper.Copy(up.Int, "connect_stagger_window")
+	helper.Copy(up.Int, "health_down_threshold")
+	helper.Copy(up.Bool, "message_search")
+	helper.Copy(up.Str, "group_read_receipts")
+	helper.Copy(up.Str, "connection_notices")
+	helper.Copy(up.Str, "ffmpeg_path")
+	helper.Copy(up.Int, "media_max_concurrent_transfers")
+	helper.Copy(up.Int, "media_stream_threshold_mb")
 
 	helper.Copy(up.Str, "animated_sticker", "target")
 	helper.Copy(up.Int, "animated_sticker", "args", "width")
 	helper.Copy(up.Int, "animated_sticker", "args", "height")
 	helper.Copy(up.Int, "animated_sticker", "args", "fps")
 
+	helper.Copy(up.List, "chat_filter", "types")
+	helper.Copy(up.Str, "chat_filter", "mode")
+	helper.Copy(up.List, "chat_filter", "jids")
+
 	helper.Copy(up.Int, "history_sync", "max_initial_conversations")
+	helper.Copy(up.Int, "history_sync", "max_initial_conversation_age")
 	helper.Copy(up.Bool, "history_sync", "request_full_sync")
 	helper.Copy(up.Int|up.Null, "history_sync", "full_sync_config", "days_limit")
 	helper.Copy(up.Int|up.Null, "history_sync", "full_sync_config", "size_mb_limit")
@@ -132,6 +397,13 @@ func upgradeConfig(helper up.Helper) {
 type DisplaynameParams struct {
 	types.ContactInfo
 	Phone string
+	// Verified WhatsApp Business name
+	VerifiedName string
+	// Name in the contact list of the logged-in user, same as FullName
+	ContactName string
+	// The first non-empty name in the order VerifiedName, BusinessName, PushName, Phone.
+	// Contact names are not included, as ghosts are shared between all users of the bridge.
+	DisplayName string
 
 	// Deprecated legacy fields
 	JID    string
@@ -141,11 +413,15 @@ type DisplaynameParams struct {
 	Short  string
 }
 
-func (c *Config) FormatDisplayname(jid types.JID, contact types.ContactInfo) string {
+func (c *Config) FormatDisplayname(jid types.JID, contact types.ContactInfo, verifiedName string) string {
+	phone := "+" + jid.User
 	var nameBuf strings.Builder
 	err := c.displaynameTemplate.Execute(&nameBuf, &DisplaynameParams{
-		ContactInfo: contact,
-		Phone:       "+" + jid.User,
+		ContactInfo:  contact,
+		Phone:        phone,
+		VerifiedName: verifiedName,
+		ContactName:  contact.FullName,
+		DisplayName:  cmp.Or(verifiedName, contact.BusinessName, contact.PushName, phone),
 
 		// Deprecated legacy fields
 		JID:    "+" + jid.User,
@@ -155,17 +431,94 @@ func (c *Config) FormatDisplayname(jid types.JID, contact types.ContactInfo) str
 		Short:  contact.FirstName,
 	})
 	if err != nil {
-		panic(err)
+		// The template is checked in ValidateConfig, so this should only happen with unusual contact data
+		return cmp.Or(verifiedName, contact.BusinessName, contact.PushName, phone)
 	}
 	return nameBuf.String()
 }
 
+// maxDisplaynameLength is the maximum length of Matrix displaynames.
+const maxDisplaynameLength = 255
+
+func (c *Config) validateDisplaynameTemplate() error {
+	if c.displaynameTemplate == nil {
+		return fmt.Errorf("displayname_template wasn't parsed")
+	}
+	contact := types.ContactInfo{
+		Found:        true,
+		FirstName:    "Alice",
+		FullName:     "Alice Example",
+		PushName:     "Alice",
+		BusinessName: "Example Business",
+	}
+	var nameBuf strings.Builder
+	err := c.displaynameTemplate.Execute(&nameBuf, &DisplaynameParams{
+		ContactInfo:  contact,
+		Phone:        "+12345678900",
+		VerifiedName: "Example Business",
+		ContactName:  contact.FullName,
+		DisplayName:  contact.BusinessName,
+
+		JID:    "+12345678900",
+		Notify: contact.PushName,
+		VName:  contact.BusinessName,
+		Name:   contact.FullName,
+		Short:  contact.FirstName,
+	})
+	if err != nil {
+		return fmt.Errorf("displayname_template failed to render: %w", err)
+	} else if nameBuf.Len() > maxDisplaynameLength {
+		return fmt.Errorf("displayname_template renders names longer than %d characters (%d with example data)", maxDisplaynameLength, nameBuf.Len())
+	}
+	return nil
+}
+
+// ValidateConfig checks config fields that can't be validated while parsing the config,
+// so that misconfigurations are reported at startup instead of failing later.
+func (wa *WhatsAppConnector) ValidateConfig() error {
+	var errs []error
+	if err := wa.Config.validateDisplaynameTemplate(); err != nil {
+		errs = append(errs, err)
+	}
+	fsc := wa.Config.HistorySync.FullSyncConfig
+	setCount := 0
+	for _, val := range []uint32{fsc.DaysLimit, fsc.SizeLimit, fsc.StorageQuota} {
+		if val > 0 {
+			setCount++
+		}
+	}
+	if setCount != 0 && setCount != 3 {
+		errs = append(errs, fmt.Errorf("history_sync.full_sync_config must either have days_limit, size_mb_limit and storage_quota_mb all set or all zero"))
+	}
+	if _, ok := waCompanionReg.DeviceProps_PlatformType_value[strings.ToUpper(wa.Config.BrowserName)]; !ok {
+		errs = append(errs, fmt.Errorf("browser_name %q is not a valid WhatsApp platform type (e.g. unknown, chrome, firefox, safari, edge, desktop)", wa.Config.BrowserName))
+	}
+	if wa.Config.OSName == "" {
+		errs = append(errs, fmt.Errorf("os_name must not be empty"))
+	}
+	return errors.Join(errs...)
+}
+
+type RelayPrefixParams struct {
+	// The Matrix displayname of the sender, or the user ID if they don't have one
+	DisplayName string
+	UserID      id.UserID
+}
+
+func (c *Config) FormatRelayPrefix(params *RelayPrefixParams) (string, error) {
+	var prefixBuf strings.Builder
+	err := c.relayPrefixTemplate.Execute(&prefixBuf, params)
+	return prefixBuf.String(), err
+}
+
 func (wa *WhatsAppConnector) GetConfig() (string, any, up.Upgrader) {
 	return ExampleConfig, &wa.Config, &up.StructUpgrader{
 		SimpleUpgrader: up.SimpleUpgrader(upgradeConfig),
 		Blocks: [][]string{
 			{"proxy"},
 			{"displayname_template"},
+			{"relay_mode"},
+			{"chat_names"},
 			{"call_start_notices"},
 			{"history_sync"},
 		},
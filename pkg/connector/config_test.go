@@ -0,0 +1,53 @@
+package connector
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestFormatDisplayname(t *testing.T) {
+	jid := types.JID{User: "15550000001", Server: types.DefaultUserServer}
+	full := types.ContactInfo{
+		Found:        true,
+		FirstName:    "Alice",
+		FullName:     "Alice Example",
+		PushName:     "Ali",
+		BusinessName: "Example Shop",
+	}
+	pushOnly := types.ContactInfo{Found: true, PushName: "Ali"}
+
+	tests := []struct {
+		name         string
+		template     string
+		contact      types.ContactInfo
+		verifiedName string
+		expect       string
+	}{
+		{"DefaultBusiness", "{{or .BusinessName .PushName .Phone}} (WA)", full, "", "Example Shop (WA)"},
+		{"DefaultPushName", "{{or .BusinessName .PushName .Phone}} (WA)", pushOnly, "", "Ali (WA)"},
+		{"DefaultPhone", "{{or .BusinessName .PushName .Phone}} (WA)", types.ContactInfo{}, "", "+15550000001 (WA)"},
+		{"DisplayNamePrefersVerified", "{{.DisplayName}}", full, "Example Shop Ltd", "Example Shop Ltd"},
+		{"DisplayNameBusiness", "{{.DisplayName}}", full, "", "Example Shop"},
+		{"DisplayNamePushName", "{{.DisplayName}}", pushOnly, "", "Ali"},
+		{"DisplayNamePhone", "{{.DisplayName}}", types.ContactInfo{}, "", "+15550000001"},
+		{"DisplayNameSkipsContactName", "{{.DisplayName}}", types.ContactInfo{Found: true, FullName: "Alice Example"}, "", "+15550000001"},
+		{"VerifiedName", "{{.VerifiedName}}", full, "Example Shop Ltd", "Example Shop Ltd"},
+		{"VerifiedNameMissing", "{{or .VerifiedName .PushName}}", full, "", "Ali"},
+		{"ContactName", "{{.ContactName}}", full, "", "Alice Example"},
+		{"ContactNameMatchesFullName", "{{.ContactName}}|{{.FullName}}", full, "", "Alice Example|Alice Example"},
+		{"AllFields", "{{.ContactName}} / {{.PushName}} / {{.BusinessName}} / {{.VerifiedName}} / {{.Phone}}", full, "Example Shop Ltd", "Alice Example / Ali / Example Shop / Example Shop Ltd / +15550000001"},
+		{"LegacyFields", "{{.Notify}} {{.VName}} {{.Name}} {{.Short}} {{.JID}}", full, "", "Ali Example Shop Alice Example Alice +15550000001"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &Config{DisplaynameTemplate: test.template}
+			if err := cfg.PostProcess(); err != nil {
+				t.Fatalf("failed to parse template: %v", err)
+			}
+			if got := cfg.FormatDisplayname(jid, test.contact, test.verifiedName); got != test.expect {
+				t.Errorf("FormatDisplayname() = %q, expected %q", got, test.expect)
+			}
+		})
+	}
+}
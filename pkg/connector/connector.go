@@ -18,10 +18,12 @@ package connector
 
 import (
 	"context"
+	"os/exec"
 	"strings"
 	"sync"
 	"sync/atomic"
 
+	"go.mau.fi/util/ffmpeg"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waCompanionReg"
 	"go.mau.fi/whatsmeow/store"
@@ -30,6 +32,8 @@ import (
 	"google.golang.org/protobuf/proto"
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/bridgev2/commands"
+	"maunium.net/go/mautrix/bridgev2/matrix"
+	"maunium.net/go/mautrix/event"
 
 	"go.mau.fi/mautrix-whatsapp/pkg/connector/wadb"
 	"go.mau.fi/mautrix-whatsapp/pkg/msgconv"
@@ -43,6 +47,9 @@ type WhatsAppConnector struct {
 	DB          *wadb.Database
 
 	firstClientConnectOnce sync.Once
+	staggeredConnects      atomic.Int64
+	staggeredConnectsDone  atomic.Int64
+	clients                sync.Map // networkid.UserLoginID -> *WhatsAppClient
 
 	mediaEditCache         MediaEditCache
 	mediaEditCacheLock     sync.RWMutex
@@ -50,9 +57,10 @@ type WhatsAppConnector struct {
 }
 
 var (
-	_ bridgev2.NetworkConnector      = (*WhatsAppConnector)(nil)
-	_ bridgev2.MaxFileSizeingNetwork = (*WhatsAppConnector)(nil)
-	_ bridgev2.StoppableNetwork      = (*WhatsAppConnector)(nil)
+	_ bridgev2.NetworkConnector        = (*WhatsAppConnector)(nil)
+	_ bridgev2.MaxFileSizeingNetwork   = (*WhatsAppConnector)(nil)
+	_ bridgev2.StoppableNetwork        = (*WhatsAppConnector)(nil)
+	_ bridgev2.ConfigValidatingNetwork = (*WhatsAppConnector)(nil)
 )
 
 func (wa *WhatsAppConnector) SetMaxFileSize(maxSize int64) {
@@ -79,6 +87,11 @@ func (wa *WhatsAppConnector) Init(bridge *bridgev2.Bridge) {
 	wa.MsgConv.DisableViewOnce = wa.Config.DisableViewOnce
 	wa.MsgConv.OldMediaSuffix = "Requesting old media is not enabled on this bridge."
 	wa.MsgConv.FetchURLPreviews = wa.Config.URLPreviews
+	wa.MsgConv.StoreSearchText = wa.Config.MessageSearch
+	wa.MsgConv.SetMediaConcurrency(wa.Config.MediaMaxConcurrent)
+	if wa.Config.MediaStreamThresholdMB > 0 {
+		wa.MsgConv.MediaStreamThreshold = int64(wa.Config.MediaStreamThresholdMB) * 1024 * 1024
+	}
 	if wa.Config.HistorySync.MediaRequests.AutoRequestMedia {
 		if wa.Config.HistorySync.MediaRequests.RequestMethod == MediaRequestMethodImmediate {
 			wa.MsgConv.OldMediaSuffix = "Media will be requested from your phone automatically soon."
@@ -86,12 +99,61 @@ func (wa *WhatsAppConnector) Init(bridge *bridgev2.Bridge) {
 			wa.MsgConv.OldMediaSuffix = "Media will be requested from your phone automatically overnight."
 		}
 	}
+	if wa.Config.FFmpegPath != "" {
+		ffmpegPath, err := exec.LookPath(wa.Config.FFmpegPath)
+		if err != nil {
+			bridge.Log.Warn().Err(err).Msg("Configured ffmpeg binary not found, media conversions that need ffmpeg are disabled")
+		}
+		ffmpeg.SetPath(ffmpegPath)
+	}
 	wa.DB = wadb.New(bridge.ID, bridge.DB.Database, bridge.Log.With().Str("db_section", "whatsapp").Logger())
 	wa.MsgConv.DB = wa.DB
 	wa.Bridge.Commands.(*commands.Processor).AddHandlers(
 		cmdAccept,
 		cmdListGroups,
 		cmdTestSyncTimer,
+		cmdSetProfilePicture,
+		cmdRemoveProfilePicture,
+		cmdSetAbout,
+		cmdGetAbout,
+		cmdQR,
+		cmdGetNewsletterInvite,
+		cmdPortalID,
+		cmdMigrateNumber,
+		cmdMessageStatus,
+		cmdExportContacts,
+		cmdMessageInfo,
+		cmdLink,
+		cmdSetEncryption,
+		cmdApproveMember,
+		cmdRejectMember,
+		cmdSetGroupJoinApproval,
+		cmdChatFilter,
+		cmdGetLinkedDevices,
+		cmdUnlinkDevice,
+		cmdPortalMappings,
+		cmdStickers,
+		cmdRequestHistory,
+		cmdSetGroupEphemeralDefault,
+		cmdResetBackfill,
+		cmdPortalSettings,
+		cmdResend,
+		cmdExportNewsletterSubscribers,
+		cmdDisappearing,
+		cmdSetGroupPictureOnlyAdmins,
+		cmdSearch,
+		cmdConvertGroupToCommunity,
+		cmdGetStatusPrivacy,
+		cmdGetGroupLink,
+		cmdSyncContact,
+		cmdSendStatus,
+		cmdDevices,
+		cmdListPortals,
+		cmdRecreatePortal,
+		cmdCopyGroup,
+		cmdDeleteStatus,
+		cmdGetProfile,
+		cmdInviteToGroup,
 	)
 	wa.mediaEditCache = make(MediaEditCache)
 
@@ -125,6 +187,9 @@ func (wa *WhatsAppConnector) Start(ctx context.Context) error {
 	if err != nil {
 		return bridgev2.DBUpgradeError{Err: err, Section: "whatsapp"}
 	}
+	if mx, ok := wa.Bridge.Matrix.(*matrix.Connector); ok {
+		mx.EventProcessor.On(event.StatePinnedEvents, wa.handleMatrixPinnedEvents)
+	}
 
 	return nil
 }
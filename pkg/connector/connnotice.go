@@ -0,0 +1,52 @@
+package connector
+
+import (
+	"context"
+
+	"maunium.net/go/mautrix/event"
+)
+
+// sendConnectionNotice sends a connection state notice to the management room of the user.
+// Verbose notices are only sent if connection_notices is set to all.
+func (wa *WhatsAppClient) sendConnectionNotice(ctx context.Context, verbose bool, message string) {
+	switch wa.Main.Config.ConnectionNotices {
+	case ConnectionNoticesAll:
+	case ConnectionNoticesDisconnects:
+		if verbose {
+			return
+		}
+	default:
+		return
+	}
+	if wa.UserLogin.User.ManagementRoom == "" {
+		return
+	}
+	_, err := wa.Main.Bridge.Bot.SendMessage(ctx, wa.UserLogin.User.ManagementRoom, event.EventMessage, &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    message,
+		},
+	}, nil)
+	if err != nil {
+		wa.UserLogin.Log.Warn().Err(err).Str("notice", message).Msg("Failed to send connection state notice")
+	}
+}
+
+// noticeDisconnected sends a notice about the connection being lost. Only one notice is sent
+// until the connection is restored, so flapping connections don't spam the management room.
+func (wa *WhatsAppClient) noticeDisconnected(reason string) {
+	if !wa.connNoticeDisconnected.CompareAndSwap(false, true) {
+		return
+	}
+	ctx := wa.UserLogin.Log.WithContext(context.Background())
+	wa.sendConnectionNotice(ctx, false, "Disconnected from WhatsApp ("+reason+"), reconnecting...")
+}
+
+func (wa *WhatsAppClient) noticeConnected() {
+	ctx := wa.UserLogin.Log.WithContext(context.Background())
+	if wa.connNoticeDisconnected.CompareAndSwap(true, false) {
+		wa.sendConnectionNotice(ctx, false, "Reconnected to WhatsApp")
+	} else {
+		wa.sendConnectionNotice(ctx, true, "Connected to WhatsApp")
+	}
+}
@@ -0,0 +1,111 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2024 Tulir Asokan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package connector
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// undecryptableRetryMaxAge is how long undecryptable group messages are kept waiting for a sender key.
+const undecryptableRetryMaxAge = 5 * time.Minute
+
+type queuedUndecryptable struct {
+	info     types.MessageInfo
+	queuedAt time.Time
+}
+
+// queueUndecryptable remembers a group message that couldn't be decrypted,
+// so that it can be requested again once the sender's key arrives.
+func (wa *WhatsAppClient) queueUndecryptable(info types.MessageInfo) {
+	wa.undecryptableQueueLock.Lock()
+	defer wa.undecryptableQueueLock.Unlock()
+	wa.pruneUndecryptableQueue()
+	wa.undecryptableQueue[info.Chat] = append(wa.undecryptableQueue[info.Chat], &queuedUndecryptable{
+		info:     info,
+		queuedAt: time.Now(),
+	})
+}
+
+func (wa *WhatsAppClient) pruneUndecryptableQueue() {
+	cutoff := time.Now().Add(-undecryptableRetryMaxAge)
+	for chat, queue := range wa.undecryptableQueue {
+		i := slices.IndexFunc(queue, func(item *queuedUndecryptable) bool {
+			return item.queuedAt.After(cutoff)
+		})
+		if i < 0 {
+			delete(wa.undecryptableQueue, chat)
+		} else if i > 0 {
+			wa.undecryptableQueue[chat] = queue[i:]
+		}
+	}
+}
+
+// retryUndecryptable asks the primary device to resend the queued messages in a group
+// from the given sender after a sender key distribution message was received from them.
+func (wa *WhatsAppClient) retryUndecryptable(chat, sender types.JID) {
+	wa.undecryptableQueueLock.Lock()
+	wa.pruneUndecryptableQueue()
+	var retry []*queuedUndecryptable
+	queue := wa.undecryptableQueue[chat]
+	remaining := queue[:0]
+	for _, item := range queue {
+		if item.info.Sender.User == sender.User {
+			retry = append(retry, item)
+		} else {
+			remaining = append(remaining, item)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(wa.undecryptableQueue, chat)
+	} else {
+		wa.undecryptableQueue[chat] = remaining
+	}
+	wa.undecryptableQueueLock.Unlock()
+	if len(retry) == 0 {
+		return
+	}
+	log := wa.UserLogin.Log.With().
+		Str("action", "retry undecryptable messages").
+		Stringer("chat_jid", chat).
+		Stringer("sender_jid", sender).
+		Logger()
+	log.Debug().Int("message_count", len(retry)).Msg("Got sender key, requesting undecryptable messages from phone")
+	ctx := log.WithContext(context.Background())
+	for _, item := range retry {
+		err := wa.requestUnavailableMessage(ctx, item.info.Chat, item.info.Sender, item.info.ID)
+		if err != nil {
+			log.Err(err).Str("message_id", item.info.ID).Msg("Failed to request undecryptable message from phone")
+		}
+	}
+}
+
+// requestUnavailableMessage asks the primary device to send a copy of a message that couldn't be decrypted.
+// The response is handled like a normal message and replaces the undecryptable notice.
+func (wa *WhatsAppClient) requestUnavailableMessage(ctx context.Context, chat, sender types.JID, id types.MessageID) error {
+	_, err := wa.Client.SendMessage(
+		ctx,
+		wa.JID.ToNonAD(),
+		wa.Client.BuildUnavailableMessageRequest(chat, sender, id),
+		whatsmeow.SendRequestExtra{Peer: true},
+	)
+	return err
+}
@@ -38,6 +38,12 @@ import (
 	"go.mau.fi/mautrix-whatsapp/pkg/waid"
 )
 
+// getPortalKeyByMessageSource finds the portal for a message.
+//
+// Broadcast lists are asymmetric: WhatsApp delivers a broadcast to each recipient as an individual message,
+// so incoming broadcasts go to the DM portal of the sender, and recipients' replies arrive as normal DMs.
+// Only the echo of an outgoing broadcast is addressed to the list itself, and since lists don't have
+// portals (whatsmeow can't fetch list recipients or send to lists), those echoes are not bridged.
 func (wa *WhatsAppClient) getPortalKeyByMessageSource(ms types.MessageSource) networkid.PortalKey {
 	jid := ms.Chat
 	if ms.IsIncomingBroadcast() {
@@ -56,7 +62,12 @@ type MessageInfoWrapper struct {
 }
 
 func (evt *MessageInfoWrapper) ShouldCreatePortal() bool {
-	return true
+	jid, _ := waid.ParsePortalID(evt.GetPortalKey().ID)
+	if jid.Server == types.BroadcastServer && jid != types.StatusBroadcastJID {
+		// Broadcast list portals can't be created, see getPortalKeyByMessageSource
+		return false
+	}
+	return evt.wa.Main.Config.ChatFilter.Allows(jid)
 }
 
 func (evt *MessageInfoWrapper) GetPortalKey() networkid.PortalKey {
@@ -198,6 +209,7 @@ func (evt *WAMessageEvent) GetType() bridgev2.RemoteEventType {
 func (evt *WAMessageEvent) HandleExisting(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, existing []*database.Message) (bridgev2.UpsertResult, error) {
 	if existing[0].Metadata.(*waid.MessageMetadata).Error == waid.MsgErrDecryptionFailed {
 		evt.wa.trackUndecryptableResolved(evt.MsgEvent)
+		evt.wa.resolvePendingPlaceholder(portal.PortalKey, existing[0].ID)
 		zerolog.Ctx(ctx).Debug().
 			Stringer("existing_mxid", existing[0].MXID).
 			Msg("Received decryptable version of previously undecryptable message")
@@ -265,7 +277,7 @@ func (evt *WAUndecryptableMessage) GetType() bridgev2.RemoteEventType {
 	return bridgev2.RemoteEventMessage
 }
 
-const UndecryptableMessageNotice = "Decrypting message from WhatsApp failed, waiting for sender to re-send... " +
+const UndecryptableMessageNotice = "⚠️ Could not decrypt this message. It may appear later if the key arrives. " +
 	"([learn more](https://faq.whatsapp.com/general/security-and-privacy/seeing-waiting-for-this-message-this-may-take-a-while))"
 
 var undecryptableMessageContent event.MessageEventContent
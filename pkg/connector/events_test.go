@@ -0,0 +1,80 @@
+package connector
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+func TestBroadcastListRouting(t *testing.T) {
+	wa := newTestClient()
+	ownJID := testOwnJID.ToNonAD()
+	alice := types.JID{User: "15550000001", Server: types.DefaultUserServer}
+	bob := types.JID{User: "15550000002", Server: types.DefaultUserServer}
+	list := types.JID{User: "1700000000", Server: types.BroadcastServer}
+	dmPortal := func(jid types.JID) networkid.PortalKey {
+		return networkid.PortalKey{ID: waid.MakePortalID(jid), Receiver: wa.UserLogin.ID}
+	}
+
+	tests := []struct {
+		name         string
+		source       types.MessageSource
+		expectPortal networkid.PortalKey
+		expectCreate bool
+	}{
+		{
+			// Someone else's broadcast is delivered to us as an individual message from them
+			name:         "IncomingBroadcast",
+			source:       types.MessageSource{Chat: list, Sender: alice},
+			expectPortal: dmPortal(alice),
+			expectCreate: true,
+		},
+		{
+			name:         "IncomingBroadcastFromLinkedDevice",
+			source:       types.MessageSource{Chat: list, Sender: types.JID{User: alice.User, Device: 5, Server: types.DefaultUserServer}},
+			expectPortal: dmPortal(alice),
+			expectCreate: true,
+		},
+		{
+			// Recipients of our broadcast reply in their normal DM, never in the list
+			name:         "RecipientReply",
+			source:       types.MessageSource{Chat: bob, Sender: bob},
+			expectPortal: dmPortal(bob),
+			expectCreate: true,
+		},
+		{
+			// The per-recipient copy of our own broadcast belongs in the recipient's DM
+			name:         "OwnBroadcastCopyForRecipient",
+			source:       types.MessageSource{Chat: list, Sender: ownJID, IsFromMe: true, BroadcastListOwner: bob},
+			expectPortal: dmPortal(bob),
+			expectCreate: true,
+		},
+		{
+			// The echo addressed to the list itself has no portal, since lists aren't bridged as rooms
+			name:         "OwnBroadcastListEcho",
+			source:       types.MessageSource{Chat: list, Sender: ownJID, IsFromMe: true},
+			expectPortal: dmPortal(list),
+			expectCreate: false,
+		},
+		{
+			name:         "StatusBroadcast",
+			source:       types.MessageSource{Chat: types.StatusBroadcastJID, Sender: alice},
+			expectPortal: dmPortal(types.StatusBroadcastJID),
+			expectCreate: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wrapper := &MessageInfoWrapper{Info: types.MessageInfo{MessageSource: test.source}, wa: wa}
+			if got := wrapper.GetPortalKey(); got != test.expectPortal {
+				t.Errorf("GetPortalKey() = %+v, expected %+v", got, test.expectPortal)
+			}
+			if got := wrapper.ShouldCreatePortal(); got != test.expectCreate {
+				t.Errorf("ShouldCreatePortal() = %t, expected %t", got, test.expectCreate)
+			}
+		})
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
-	"go.mau.fi/util/variationselector"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
@@ -15,8 +14,10 @@ import (
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/bridgev2/database"
 	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/bridgev2/simplevent"
 	"maunium.net/go/mautrix/event"
 
+	"go.mau.fi/mautrix-whatsapp/pkg/msgconv"
 	"go.mau.fi/mautrix-whatsapp/pkg/waid"
 )
 
@@ -27,6 +28,9 @@ var (
 	_ bridgev2.RedactionHandlingNetworkAPI   = (*WhatsAppClient)(nil)
 	_ bridgev2.ReadReceiptHandlingNetworkAPI = (*WhatsAppClient)(nil)
 	_ bridgev2.PollHandlingNetworkAPI        = (*WhatsAppClient)(nil)
+	_ bridgev2.RoomNameHandlingNetworkAPI    = (*WhatsAppClient)(nil)
+	_ bridgev2.RoomTopicHandlingNetworkAPI   = (*WhatsAppClient)(nil)
+	_ bridgev2.MembershipHandlingNetworkAPI  = (*WhatsAppClient)(nil)
 )
 
 func (wa *WhatsAppClient) HandleMatrixPollStart(ctx context.Context, msg *bridgev2.MatrixPollStart) (*bridgev2.MatrixMessageResponse, error) {
@@ -57,7 +61,14 @@ func (wa *WhatsAppClient) HandleMatrixPollVote(ctx context.Context, msg *bridgev
 }
 
 func (wa *WhatsAppClient) HandleMatrixMessage(ctx context.Context, msg *bridgev2.MatrixMessage) (*bridgev2.MatrixMessageResponse, error) {
-	waMsg, err := wa.Main.MsgConv.ToWhatsApp(ctx, wa.Client, msg.Event, msg.Content, msg.ReplyTo, msg.Portal)
+	if msg.OrigSender != nil && msg.Portal.Metadata.(*waid.PortalMetadata).RelayDisabled {
+		return nil, ErrRelayDisabled
+	}
+	content, err := wa.applyRelayPrefix(msg.Event, msg.OrigSender, msg.Content)
+	if err != nil {
+		return nil, err
+	}
+	waMsg, err := wa.Main.MsgConv.ToWhatsApp(ctx, wa.Client, msg.Event, content, msg.ReplyTo, msg.Portal)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert message: %w", err)
 	}
@@ -67,6 +78,45 @@ func (wa *WhatsAppClient) HandleMatrixMessage(ctx context.Context, msg *bridgev2
 var ErrBroadcastSendDisabled = bridgev2.WrapErrorInStatus(errors.New("sending status messages is disabled")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
 var ErrBroadcastReactionUnsupported = bridgev2.WrapErrorInStatus(errors.New("reacting to status messages is not currently supported")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
 
+var ErrNewsletterSendForbidden = bridgev2.WrapErrorInStatus(errors.New("only channel admins can post messages")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusNoPermission)
+var ErrRevokeWindowExpired = bridgev2.WrapErrorInStatus(errors.New("the message is too old to be deleted for everyone on WhatsApp")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+var ErrRelayDisabled = bridgev2.WrapErrorInStatus(errors.New("relaying is disabled in this chat")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusNoPermission)
+var ErrEditTooOld = bridgev2.WrapErrorInStatus(fmt.Errorf("messages can only be edited within %s on WhatsApp", EditMaxAge)).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+var ErrEditNotOwnMessage = bridgev2.WrapErrorInStatus(errors.New("only your own messages can be edited")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusNoPermission)
+var ErrEditUnsupportedType = bridgev2.WrapErrorInStatus(errors.New("only text messages can be edited on WhatsApp")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+var ErrGroupMetaNotGroup = bridgev2.WrapErrorInStatus(errors.New("only the name and topic of groups can be changed")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+var ErrGroupMetaNoPermission = bridgev2.WrapErrorInStatus(errors.New("only room admins can change the group name and topic")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusNoPermission)
+var ErrInviteNotGroup = bridgev2.WrapErrorInStatus(errors.New("people can only be invited to groups")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+var ErrInviteNoPermission = bridgev2.WrapErrorInStatus(errors.New("you don't have permission to invite people to this group")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusNoPermission)
+var ErrInviteNotWhatsAppUser = bridgev2.WrapErrorInStatus(errors.New("only WhatsApp users can be invited to WhatsApp groups")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+var ErrSendNotConnected = bridgev2.WrapErrorInStatus(errors.New("not connected to WhatsApp, please try again once the bridge has reconnected")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusNetworkError)
+var ErrSendTimeout = bridgev2.WrapErrorInStatus(errors.New("timed out waiting for WhatsApp to acknowledge the message, it may or may not have been sent")).WithErrorAsMessage().WithIsCertain(false).WithSendNotice(true).WithErrorReason(event.MessageStatusNetworkError)
+
+// waitForConnection waits until the client is connected, so that messages sent
+// while the bridge is reconnecting are delayed instead of failing instantly.
+func (wa *WhatsAppClient) waitForConnection(ctx context.Context) error {
+	if wa.Client == nil {
+		return ErrSendNotConnected
+	} else if wa.Client.IsConnected() && wa.Client.IsLoggedIn() {
+		return nil
+	} else if wa.Main.Config.SendTimeout <= 0 {
+		return ErrSendNotConnected
+	}
+	zerolog.Ctx(ctx).Debug().Msg("Client is not connected, waiting for reconnection before sending message")
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if wa.Client.IsConnected() && wa.Client.IsLoggedIn() {
+				return nil
+			}
+		case <-ctx.Done():
+			return ErrSendNotConnected
+		}
+	}
+}
+
 func (wa *WhatsAppClient) handleConvertedMatrixMessage(ctx context.Context, msg *bridgev2.MatrixMessage, waMsg *waE2E.Message) (*bridgev2.MatrixMessageResponse, error) {
 	messageID := wa.Client.GenerateMessageID()
 	chatJID, err := waid.ParsePortalID(msg.Portal.ID)
@@ -75,29 +125,80 @@ func (wa *WhatsAppClient) handleConvertedMatrixMessage(ctx context.Context, msg
 	}
 	if chatJID == types.StatusBroadcastJID && wa.Main.Config.DisableStatusBroadcastSend {
 		return nil, ErrBroadcastSendDisabled
+	} else if chatJID.Server == types.NewsletterServer {
+		if err = wa.checkNewsletterSendPermission(ctx, msg.Portal, chatJID); err != nil {
+			return nil, err
+		}
+	}
+	var timeout time.Duration
+	if wa.Main.Config.SendTimeout > 0 {
+		timeout = time.Duration(wa.Main.Config.SendTimeout) * time.Second
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err = wa.waitForConnection(ctx); err != nil {
+		return nil, err
 	}
 	wrappedMsgID := waid.MakeMessageID(chatJID, wa.JID, messageID)
 	msg.AddPendingToIgnore(networkid.TransactionID(wrappedMsgID))
 	resp, err := wa.Client.SendMessage(ctx, chatJID, waMsg, whatsmeow.SendRequestExtra{
-		ID: messageID,
+		ID:      messageID,
+		Timeout: timeout,
 	})
-	if err != nil {
+	if errors.Is(err, whatsmeow.ErrMessageTimedOut) || errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrSendTimeout
+	} else if err != nil {
 		return nil, err
 	}
+	meta := &waid.MessageMetadata{
+		SenderDeviceID: wa.JID.Device,
+	}
+	if wa.Main.Config.MessageSearch && msg.Content != nil {
+		meta.SearchText = msg.Content.Body
+	}
 	return &bridgev2.MatrixMessageResponse{
 		DB: &database.Message{
 			ID:        wrappedMsgID,
 			SenderID:  waid.MakeUserID(wa.JID),
 			Timestamp: resp.Timestamp,
-			Metadata: &waid.MessageMetadata{
-				SenderDeviceID: wa.JID.Device,
-			},
+			Metadata:  meta,
 		},
 		StreamOrder:   resp.Timestamp.Unix(),
 		RemovePending: networkid.TransactionID(wrappedMsgID),
 	}, nil
 }
 
+// checkNewsletterSendPermission makes sure the user is allowed to post in the given newsletter.
+// If the cached role doesn't allow posting, the role is re-fetched from WhatsApp, so that
+// promotions take effect immediately without waiting for the next resync.
+func (wa *WhatsAppClient) checkNewsletterSendPermission(ctx context.Context, portal *bridgev2.Portal, jid types.JID) error {
+	meta := portal.Metadata.(*waid.PortalMetadata)
+	if canPostInNewsletter(types.NewsletterRole(meta.NewsletterRole)) {
+		return nil
+	}
+	info, err := wa.Client.GetNewsletterInfo(jid)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to fetch newsletter info to check own role")
+		return nil
+	}
+	var role types.NewsletterRole
+	if info.ViewerMeta != nil {
+		role = info.ViewerMeta.Role
+	}
+	if string(role) != meta.NewsletterRole {
+		wa.handleNewsletterRoleChange(jid, role)
+	}
+	if !canPostInNewsletter(role) {
+		return ErrNewsletterSendForbidden
+	}
+	return nil
+}
+
+func canPostInNewsletter(role types.NewsletterRole) bool {
+	return role == types.NewsletterRoleAdmin || role == types.NewsletterRoleOwner
+}
+
 func (wa *WhatsAppClient) PreHandleMatrixReaction(_ context.Context, msg *bridgev2.MatrixReaction) (bridgev2.MatrixReactionPreResponse, error) {
 	portalJID, err := waid.ParsePortalID(msg.Portal.ID)
 	if err != nil {
@@ -105,9 +206,13 @@ func (wa *WhatsAppClient) PreHandleMatrixReaction(_ context.Context, msg *bridge
 	} else if portalJID == types.StatusBroadcastJID {
 		return bridgev2.MatrixReactionPreResponse{}, ErrBroadcastReactionUnsupported
 	}
+	emoji, err := normalizeReactionEmoji(msg.Content.RelatesTo.Key)
+	if err != nil {
+		return bridgev2.MatrixReactionPreResponse{}, err
+	}
 	return bridgev2.MatrixReactionPreResponse{
 		SenderID:     waid.MakeUserID(wa.JID),
-		Emoji:        variationselector.Remove(msg.Content.RelatesTo.Key),
+		Emoji:        emoji,
 		MaxReactions: 1,
 	}, nil
 }
@@ -132,6 +237,9 @@ func (wa *WhatsAppClient) HandleMatrixReaction(ctx context.Context, msg *bridgev
 
 	resp, err := wa.Client.SendMessage(ctx, portalJID, reactionMsg)
 	zerolog.Ctx(ctx).Trace().Any("response", resp).Msg("WhatsApp reaction response")
+	if err == nil && msg.PreHandleResp.Emoji == msgconv.GroupInviteAcceptReaction {
+		wa.acceptGroupInviteByReaction(ctx, msg.TargetMessage)
+	}
 	return &database.Reaction{
 		Metadata: &waid.ReactionMetadata{
 			SenderDeviceID: wa.JID.Device,
@@ -139,6 +247,96 @@ func (wa *WhatsAppClient) HandleMatrixReaction(ctx context.Context, msg *bridgev
 	}, err
 }
 
+var (
+	ErrGroupInviteExpired = errors.New("the group invite has expired")
+	ErrGroupInviteOwn     = errors.New("you can't accept your own invites")
+)
+
+func (wa *WhatsAppClient) acceptGroupInvite(meta *waid.GroupInviteMeta) error {
+	if meta.IsExpired() {
+		return ErrGroupInviteExpired
+	} else if meta.Inviter.User == wa.JID.User {
+		return ErrGroupInviteOwn
+	}
+	return wa.Client.JoinGroupWithInvite(meta.JID, meta.Inviter, meta.Code, meta.Expiration)
+}
+
+// communityJoinResult describes which groups of a community were joined after accepting a community invite.
+type communityJoinResult struct {
+	Joined    []*types.GroupLinkTarget
+	NotJoined []*types.GroupLinkTarget
+	// SubGroupErr is set if the community itself was joined, but its groups couldn't be listed.
+	SubGroupErr error
+}
+
+// acceptCommunityInvite joins a community using an invite and then checks which of its groups
+// the user is now a member of. WhatsApp automatically adds new community members to the
+// announcement group, other groups have to be joined separately from a WhatsApp client.
+func (wa *WhatsAppClient) acceptCommunityInvite(ctx context.Context, meta *waid.GroupInviteMeta) (*communityJoinResult, error) {
+	err := wa.acceptGroupInvite(meta)
+	if err != nil {
+		return nil, err
+	}
+	result := &communityJoinResult{}
+	subGroups, err := wa.Client.GetSubGroups(meta.JID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Stringer("community_jid", meta.JID).Msg("Failed to get community subgroups after joining")
+		result.SubGroupErr = err
+		subGroups = nil
+	}
+	wa.queueCommunityPortalResync(meta.JID)
+	for _, group := range subGroups {
+		_, err = wa.Client.GetGroupInfo(group.JID)
+		if err != nil {
+			result.NotJoined = append(result.NotJoined, group)
+			continue
+		}
+		result.Joined = append(result.Joined, group)
+		wa.queueCommunityPortalResync(group.JID)
+	}
+	return result, nil
+}
+
+func (wa *WhatsAppClient) queueCommunityPortalResync(jid types.JID) {
+	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &simplevent.ChatResync{
+		EventMeta: simplevent.EventMeta{
+			Type: bridgev2.RemoteEventChatResync,
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("sync_reason", "community invite accepted")
+			},
+			PortalKey:    wa.makeWAPortalKey(jid),
+			CreatePortal: true,
+		},
+		GetChatInfoFunc: wa.GetChatInfo,
+	})
+}
+
+func (wa *WhatsAppClient) acceptGroupInviteByReaction(ctx context.Context, target *database.Message) {
+	meta, ok := target.Metadata.(*waid.MessageMetadata)
+	if !ok || meta.GroupInvite == nil {
+		return
+	}
+	log := zerolog.Ctx(ctx).With().Stringer("group_jid", meta.GroupInvite.JID).Logger()
+	if meta.GroupInvite.IsCommunity {
+		result, err := wa.acceptCommunityInvite(log.WithContext(ctx), meta.GroupInvite)
+		if err != nil {
+			log.Err(err).Msg("Failed to accept community invite via reaction")
+		} else {
+			log.Info().
+				Int("joined_group_count", len(result.Joined)).
+				Int("not_joined_group_count", len(result.NotJoined)).
+				Msg("Accepted community invite via reaction")
+		}
+		return
+	}
+	err := wa.acceptGroupInvite(meta.GroupInvite)
+	if err != nil {
+		log.Err(err).Msg("Failed to accept group invite via reaction")
+	} else {
+		log.Info().Msg("Accepted group invite via reaction")
+	}
+}
+
 func (wa *WhatsAppClient) HandleMatrixReactionRemove(ctx context.Context, msg *bridgev2.MatrixReactionRemove) error {
 	messageID, err := waid.ParseMessageID(msg.TargetReaction.MessageID)
 	if err != nil {
@@ -163,6 +361,22 @@ func (wa *WhatsAppClient) HandleMatrixReactionRemove(ctx context.Context, msg *b
 	return err
 }
 
+// checkEditEligibility checks WhatsApp's constraints for edits before sending them:
+// only own text messages can be edited, and only within EditMaxAge of being sent.
+func checkEditEligibility(ownJID types.JID, target *waid.ParsedMessageID, targetMsg *database.Message, newContent *event.MessageEventContent, now time.Time) error {
+	if target.Sender.User != ownJID.User {
+		return ErrEditNotOwnMessage
+	} else if now.Sub(targetMsg.Timestamp) > EditMaxAge {
+		return ErrEditTooOld
+	}
+	switch newContent.MsgType {
+	case event.MsgText, event.MsgNotice, event.MsgEmote:
+		return nil
+	default:
+		return ErrEditUnsupportedType
+	}
+}
+
 func (wa *WhatsAppClient) HandleMatrixEdit(ctx context.Context, edit *bridgev2.MatrixEdit) error {
 	log := zerolog.Ctx(ctx)
 	editID := wa.Client.GenerateMessageID()
@@ -177,7 +391,15 @@ func (wa *WhatsAppClient) HandleMatrixEdit(ctx context.Context, edit *bridgev2.M
 		return err
 	}
 
-	waMsg, err := wa.Main.MsgConv.ToWhatsApp(ctx, wa.Client, edit.Event, edit.Content, nil, edit.Portal)
+	if err = checkEditEligibility(wa.JID, messageID, edit.EditTarget, edit.Content, time.Now()); err != nil {
+		return err
+	}
+
+	content, err := wa.applyRelayPrefix(edit.Event, edit.OrigSender, edit.Content)
+	if err != nil {
+		return err
+	}
+	waMsg, err := wa.Main.MsgConv.ToWhatsApp(ctx, wa.Client, edit.Event, content, nil, edit.Portal)
 	if err != nil {
 		return fmt.Errorf("failed to convert message: %w", err)
 	}
@@ -207,11 +429,25 @@ func (wa *WhatsAppClient) HandleMatrixMessageRemove(ctx context.Context, msg *br
 		return err
 	}
 
+	if revokeWindow := time.Duration(wa.Main.Config.RevokeWindow) * time.Second; revokeWindow > 0 &&
+		messageID.Sender.User == wa.JID.User && time.Since(msg.TargetMessage.Timestamp) > revokeWindow {
+		return ErrRevokeWindowExpired
+	}
+
 	revokeMessage := wa.Client.BuildRevoke(messageID.Chat, messageID.Sender, messageID.ID)
 
 	resp, err := wa.Client.SendMessage(ctx, portalJID, revokeMessage)
 	log.Trace().Any("response", resp).Msg("WhatsApp delete response")
-	return err
+	if err != nil {
+		return err
+	}
+	// Remember the revoke message ID so echoes of it can be ignored
+	msg.TargetMessage.Metadata.(*waid.MessageMetadata).RevokeID = resp.ID
+	err = wa.Main.Bridge.DB.Message.Update(ctx, msg.TargetMessage)
+	if err != nil {
+		log.Err(err).Msg("Failed to save revoke message ID")
+	}
+	return nil
 }
 
 func (wa *WhatsAppClient) HandleMatrixReadReceipt(ctx context.Context, receipt *bridgev2.MatrixReadReceipt) error {
@@ -291,3 +527,125 @@ func (wa *WhatsAppClient) HandleMatrixTyping(ctx context.Context, msg *bridgev2.
 	}
 	return wa.Client.SendChatPresence(portalJID, chatPresence, mediaPresence)
 }
+
+// checkGroupMetaChange checks whether a Matrix room name or topic change can be bridged to WhatsApp.
+func (wa *WhatsAppClient) checkGroupMetaChange(ctx context.Context, portal *bridgev2.Portal, evt *event.Event, origSender *bridgev2.OrigSender) (types.JID, error) {
+	portalJID, err := waid.ParsePortalID(portal.ID)
+	if err != nil {
+		return portalJID, err
+	} else if portalJID.Server != types.GroupServer {
+		return portalJID, ErrGroupMetaNotGroup
+	} else if origSender != nil {
+		return portalJID, ErrGroupMetaNoPermission
+	}
+	pl, err := wa.Main.Bridge.Matrix.GetPowerLevels(ctx, portal.MXID)
+	if err != nil {
+		return portalJID, fmt.Errorf("failed to get power levels: %w", err)
+	} else if pl.GetUserLevel(evt.Sender) < adminPL {
+		return portalJID, ErrGroupMetaNoPermission
+	}
+	return portalJID, nil
+}
+
+func (wa *WhatsAppClient) HandleMatrixRoomName(ctx context.Context, msg *bridgev2.MatrixRoomName) (bool, error) {
+	portalJID, err := wa.checkGroupMetaChange(ctx, msg.Portal, msg.Event, msg.OrigSender)
+	if err != nil {
+		return false, err
+	}
+	err = wa.Client.SetGroupName(portalJID, msg.Content.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to set group name: %w", err)
+	}
+	zerolog.Ctx(ctx).Info().
+		Stringer("user_id", msg.Event.Sender).
+		Str("old_name", msg.Portal.Name).
+		Str("new_name", msg.Content.Name).
+		Msg("Changed group name from Matrix")
+	msg.Portal.Name = msg.Content.Name
+	msg.Portal.NameSet = true
+	return true, nil
+}
+
+func (wa *WhatsAppClient) HandleMatrixRoomTopic(ctx context.Context, msg *bridgev2.MatrixRoomTopic) (bool, error) {
+	portalJID, err := wa.checkGroupMetaChange(ctx, msg.Portal, msg.Event, msg.OrigSender)
+	if err != nil {
+		return false, err
+	}
+	err = wa.Client.SetGroupTopic(portalJID, "", "", msg.Content.Topic)
+	if err != nil {
+		return false, fmt.Errorf("failed to set group topic: %w", err)
+	}
+	zerolog.Ctx(ctx).Info().
+		Stringer("user_id", msg.Event.Sender).
+		Str("old_topic", msg.Portal.Topic).
+		Str("new_topic", msg.Content.Topic).
+		Msg("Changed group topic from Matrix")
+	msg.Portal.Topic = msg.Content.Topic
+	msg.Portal.TopicSet = true
+	return true, nil
+}
+
+func (wa *WhatsAppClient) HandleMatrixMembership(ctx context.Context, msg *bridgev2.MatrixMembershipChange) (bool, error) {
+	if msg.Type != bridgev2.Invite {
+		return false, bridgev2.ErrMembershipNotSupported
+	}
+	portalJID, err := waid.ParsePortalID(msg.Portal.ID)
+	if err != nil {
+		return false, err
+	} else if portalJID.Server != types.GroupServer {
+		return false, ErrInviteNotGroup
+	} else if msg.OrigSender != nil {
+		return false, ErrInviteNoPermission
+	}
+	pl, err := wa.Main.Bridge.Matrix.GetPowerLevels(ctx, msg.Portal.MXID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get power levels: %w", err)
+	} else if pl.GetUserLevel(msg.Event.Sender) < pl.Invite() {
+		return false, ErrInviteNoPermission
+	}
+	var targetJID types.JID
+	switch target := msg.Target.(type) {
+	case *bridgev2.Ghost:
+		targetJID = waid.ParseUserID(target.ID)
+	case *bridgev2.UserLogin:
+		targetJID = waid.ParseUserLoginID(target.ID, 0)
+	}
+	if targetJID.Server != types.DefaultUserServer {
+		return false, ErrInviteNotWhatsAppUser
+	}
+	err = wa.addGroupParticipant(portalJID, targetJID)
+	if err != nil {
+		return false, bridgev2.WrapErrorInStatus(err).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true)
+	}
+	zerolog.Ctx(ctx).Info().
+		Stringer("user_id", msg.Event.Sender).
+		Stringer("target_jid", targetJID).
+		Msg("Added user to group from Matrix invite")
+	return true, nil
+}
+
+// addGroupParticipant adds a single user to a WhatsApp group. WhatsApp reports per-participant
+// failures in the response rather than as an error, so those are converted into errors here.
+func (wa *WhatsAppClient) addGroupParticipant(groupJID, userJID types.JID) error {
+	resp, err := wa.Client.UpdateGroupParticipants(groupJID, []types.JID{userJID}, whatsmeow.ParticipantChangeAdd)
+	if err != nil {
+		return fmt.Errorf("failed to add +%s to the group: %w", userJID.User, err)
+	}
+	for _, participant := range resp {
+		switch participant.Error {
+		case 0:
+		case 403:
+			if participant.AddRequest != nil {
+				return fmt.Errorf("+%s can't be added to groups directly due to their privacy settings, send them an invite link instead", userJID.User)
+			}
+			return fmt.Errorf("+%s can't be added to the group due to their privacy settings", userJID.User)
+		case 408:
+			return fmt.Errorf("+%s recently left the group and can't be added back yet", userJID.User)
+		case 409:
+			return fmt.Errorf("+%s is already in the group", userJID.User)
+		default:
+			return fmt.Errorf("failed to add +%s to the group (error %d)", userJID.User, participant.Error)
+		}
+	}
+	return nil
+}
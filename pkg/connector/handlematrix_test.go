@@ -0,0 +1,57 @@
+package connector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/event"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+func TestCheckEditEligibility(t *testing.T) {
+	ownJID := types.JID{User: "15551234567", Device: 12, Server: types.DefaultUserServer}
+	otherJID := types.JID{User: "15559876543", Server: types.DefaultUserServer}
+	chat := types.JID{User: "15559876543", Server: types.DefaultUserServer}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	ownTarget := &waid.ParsedMessageID{Chat: chat, Sender: ownJID.ToNonAD(), ID: "3EB0AAAA"}
+	otherTarget := &waid.ParsedMessageID{Chat: chat, Sender: otherJID, ID: "3A1BBBBB"}
+	sentAt := func(age time.Duration) *database.Message {
+		return &database.Message{Timestamp: now.Add(-age)}
+	}
+	text := &event.MessageEventContent{MsgType: event.MsgText, Body: "edited"}
+
+	tests := []struct {
+		name    string
+		target  *waid.ParsedMessageID
+		msg     *database.Message
+		content *event.MessageEventContent
+		expect  error
+	}{
+		{"RecentText", ownTarget, sentAt(time.Minute), text, nil},
+		{"Notice", ownTarget, sentAt(time.Minute), &event.MessageEventContent{MsgType: event.MsgNotice}, nil},
+		{"Emote", ownTarget, sentAt(time.Minute), &event.MessageEventContent{MsgType: event.MsgEmote}, nil},
+		{"SentFromOtherOwnDevice", &waid.ParsedMessageID{Chat: chat, Sender: types.JID{User: ownJID.User, Device: 3, Server: types.DefaultUserServer}}, sentAt(time.Minute), text, nil},
+		{"JustInsideWindow", ownTarget, sentAt(EditMaxAge), text, nil},
+		{"JustOutsideWindow", ownTarget, sentAt(EditMaxAge + time.Second), text, ErrEditTooOld},
+		{"VeryOld", ownTarget, sentAt(30 * 24 * time.Hour), text, ErrEditTooOld},
+		{"OtherUsersMessage", otherTarget, sentAt(time.Minute), text, ErrEditNotOwnMessage},
+		{"OtherUsersOldMessage", otherTarget, sentAt(30 * 24 * time.Hour), text, ErrEditNotOwnMessage},
+		{"Image", ownTarget, sentAt(time.Minute), &event.MessageEventContent{MsgType: event.MsgImage}, ErrEditUnsupportedType},
+		{"File", ownTarget, sentAt(time.Minute), &event.MessageEventContent{MsgType: event.MsgFile}, ErrEditUnsupportedType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkEditEligibility(ownJID, test.target, test.msg, test.content, now)
+			if test.expect == nil && err != nil {
+				t.Errorf("checkEditEligibility() returned unexpected error %v", err)
+			} else if test.expect != nil && !errors.Is(err, errors.Unwrap(test.expect)) {
+				t.Errorf("checkEditEligibility() = %v, expected %v", err, test.expect)
+			}
+		})
+	}
+}
@@ -24,16 +24,21 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"go.mau.fi/util/jsontime"
 	"go.mau.fi/util/ptr"
 	"go.mau.fi/whatsmeow/appstate"
+	waBinary "go.mau.fi/whatsmeow/binary"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	"maunium.net/go/mautrix/bridge/status"
 	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
 	"maunium.net/go/mautrix/bridgev2/networkid"
 	"maunium.net/go/mautrix/bridgev2/simplevent"
 	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
 
+	"go.mau.fi/mautrix-whatsapp/pkg/msgconv"
 	"go.mau.fi/mautrix-whatsapp/pkg/waid"
 )
 
@@ -153,10 +158,13 @@ func (wa *WhatsAppClient) handleWAEvent(rawEvt any) {
 		go wa.syncGhost(evt.JID, "push name event", nil)
 	case *events.BusinessName:
 		go wa.syncGhost(evt.JID, "business name event", nil)
+	case *events.UserAbout:
+		go wa.handleWAUserAbout(evt)
 
 	case *events.Connected:
 		log.Debug().Msg("Connected to WhatsApp socket")
 		wa.UserLogin.BridgeState.Send(status.BridgeState{StateEvent: status.StateConnected})
+		go wa.noticeConnected()
 		if len(wa.GetStore().PushName) > 0 {
 			go func() {
 				err := wa.Client.SendPresence(types.PresenceUnavailable)
@@ -191,6 +199,7 @@ func (wa *WhatsAppClient) handleWAEvent(rawEvt any) {
 		if wa.UserLogin.BridgeState.GetPrev().Error != WAPhoneOffline && wa.PhoneRecentlySeen(false) {
 			wa.UserLogin.BridgeState.Send(status.BridgeState{StateEvent: status.StateTransientDisconnect, Error: WADisconnected})
 		}
+		go wa.noticeDisconnected("connection lost")
 		wa.notifyOfflineSyncWaiter(fmt.Errorf("disconnected"))
 	case *events.StreamError:
 		var message string
@@ -212,9 +221,11 @@ func (wa *WhatsAppClient) handleWAEvent(rawEvt any) {
 		wa.notifyOfflineSyncWaiter(fmt.Errorf("stream replaced"))
 	case *events.KeepAliveTimeout:
 		wa.UserLogin.BridgeState.Send(status.BridgeState{StateEvent: status.StateTransientDisconnect, Error: WAKeepaliveTimeout})
+		go wa.noticeDisconnected("keepalive timeout")
 	case *events.KeepAliveRestored:
 		log.Info().Msg("Keepalive restored after timeouts, sending connected event")
 		wa.UserLogin.BridgeState.Send(status.BridgeState{StateEvent: status.StateConnected})
+		go wa.noticeConnected()
 	case *events.ConnectFailure:
 		wa.UserLogin.BridgeState.Send(status.BridgeState{
 			StateEvent: status.StateUnknownError,
@@ -243,15 +254,42 @@ func (wa *WhatsAppClient) handleWAMessage(evt *events.Message) {
 		Any("info", evt.Info).
 		Any("payload", evt.Message).
 		Msg("Received WhatsApp message")
-	if evt.Info.Chat.Server == types.HiddenUserServer || evt.Info.Sender.Server == types.HiddenUserServer {
+	if evt.Info.Sender.Server == types.HiddenUserServer && evt.Info.Chat.Server == types.GroupServer &&
+		(evt.Message.GetReactionMessage() != nil || evt.Message.GetEncReactionMessage() != nil) {
+		// Reactions from LID senders are attributed to the phone number ghost if the mapping is known,
+		// and to a separate LID ghost otherwise, instead of being dropped.
+		if pn, ok := wa.resolveLIDSender(evt.Info.Chat, evt.Info.Sender); ok {
+			evt.Info.Sender = pn
+		} else {
+			wa.UserLogin.Log.Debug().
+				Stringer("chat_jid", evt.Info.Chat).
+				Stringer("sender_lid", evt.Info.Sender).
+				Msg("Couldn't find phone number for LID reaction sender, using LID ghost")
+		}
+	} else if evt.Info.Chat.Server == types.HiddenUserServer || evt.Info.Sender.Server == types.HiddenUserServer {
 		return
 	}
 	if evt.Info.Chat == types.StatusBroadcastJID && !wa.Main.Config.EnableStatusBroadcast {
 		return
 	}
+	if evt.Info.IsGroup && evt.Message.GetSenderKeyDistributionMessage() != nil {
+		go wa.retryUndecryptable(evt.Info.Chat, evt.Info.Sender)
+	}
 	parsedMessageType := getMessageType(evt.Message)
 	if parsedMessageType == "ignore" || strings.HasPrefix(parsedMessageType, "unknown_protocol_") {
 		return
+	} else if parsedMessageType == "revoke" && wa.isOwnRevokeEcho(evt) {
+		return
+	} else if wa.Main.Config.IgnoreOwnDeviceEchoes && wa.isOwnDeviceEcho(evt.Info) {
+		wa.UserLogin.Log.Debug().
+			Str("message_id", evt.Info.ID).
+			Stringer("chat_jid", evt.Info.Chat).
+			Msg("Ignoring echo of message sent by the bridge's own device")
+		return
+	}
+	if evt.Info.IsFromMe && evt.Info.IsIncomingBroadcast() && evt.Message.GetProtocolMessage() == nil &&
+		evt.Message.GetReactionMessage() == nil && wa.trackBroadcastCopy(evt.Info, parsedMessageType, evt.Message) {
+		return
 	}
 	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &WAMessageEvent{
 		MessageInfoWrapper: &MessageInfoWrapper{
@@ -265,6 +303,43 @@ func (wa *WhatsAppClient) handleWAMessage(evt *events.Message) {
 	})
 }
 
+// isOwnDeviceEcho checks if the given message was sent by the bridge's own device, rather than by the phone
+// or another linked device. Messages from other own devices are bridged normally and marked as sent by the user
+// through makeEventSender, while messages sent through the bridge already exist in the database.
+func (wa *WhatsAppClient) isOwnDeviceEcho(info types.MessageInfo) bool {
+	return info.IsFromMe && info.Sender.User == wa.JID.User && info.Sender.Device == wa.JID.Device
+}
+
+// isOwnRevokeEcho checks if the given revoke message was sent by the bridge in response to a Matrix redaction.
+func (wa *WhatsAppClient) isOwnRevokeEcho(evt *events.Message) bool {
+	if !evt.Info.IsFromMe {
+		return false
+	}
+	targetID := msgconv.KeyToMessageID(wa.Client, evt.Info.Chat, evt.Info.Sender, evt.Message.GetProtocolMessage().GetKey())
+	ctx := wa.UserLogin.Log.WithContext(context.Background())
+	target, err := wa.Main.Bridge.DB.Message.GetPartByID(ctx, wa.makeWAPortalKey(evt.Info.Chat).Receiver, targetID, "")
+	if err != nil {
+		wa.UserLogin.Log.Err(err).Str("target_id", string(targetID)).Msg("Failed to get revoke target message")
+		return false
+	} else if !isRevokeSentByBridge(target, evt.Info.ID) {
+		return false
+	}
+	wa.UserLogin.Log.Debug().
+		Str("target_id", string(targetID)).
+		Str("revoke_id", evt.Info.ID).
+		Msg("Ignoring echo of revoke sent from Matrix")
+	return true
+}
+
+// isRevokeSentByBridge checks if the revoke with the given ID is the one the bridge sent when deleting the target from Matrix.
+func isRevokeSentByBridge(target *database.Message, revokeID types.MessageID) bool {
+	if target == nil {
+		return false
+	}
+	meta, ok := target.Metadata.(*waid.MessageMetadata)
+	return ok && meta.RevokeID != "" && meta.RevokeID == revokeID
+}
+
 func (wa *WhatsAppClient) handleWAUndecryptableMessage(evt *events.UndecryptableMessage) {
 	wa.UserLogin.Log.Debug().
 		Any("info", evt.Info).
@@ -278,6 +353,16 @@ func (wa *WhatsAppClient) handleWAUndecryptableMessage(evt *events.Undecryptable
 	if evt.Info.Chat == types.StatusBroadcastJID && !wa.Main.Config.EnableStatusBroadcast {
 		return
 	}
+	if evt.Info.IsGroup && !evt.IsUnavailable {
+		wa.queueUndecryptable(evt.Info)
+	}
+	if evt.UnavailableType != events.UnavailableTypeViewOnce {
+		wa.addPendingPlaceholder(
+			wa.getPortalKeyByMessageSource(evt.Info.MessageSource),
+			waid.MakeMessageID(evt.Info.Chat, evt.Info.Sender, evt.Info.ID),
+			evt.Info.Sender,
+		)
+	}
 	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &WAUndecryptableMessage{
 		MessageInfoWrapper: &MessageInfoWrapper{
 			Info: evt.Info,
@@ -310,6 +395,12 @@ func (wa *WhatsAppClient) handleWAReceipt(evt *events.Receipt) {
 	for i, id := range evt.MessageIDs {
 		targets[i] = waid.MakeMessageID(evt.Chat, messageSender, id)
 	}
+	if !evt.IsFromMe && messageSender.User == wa.JID.User {
+		targets = wa.trackDeliveryStatus(evt, targets)
+		if len(targets) == 0 {
+			return
+		}
+	}
 	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &simplevent.Receipt{
 		EventMeta: simplevent.EventMeta{
 			Type:      evtType,
@@ -321,6 +412,255 @@ func (wa *WhatsAppClient) handleWAReceipt(evt *events.Receipt) {
 	})
 }
 
+// deliveryStatusFlushDelay is how long delivery status changes are buffered before being written to the database.
+// In large groups, every participant sends a receipt for every message, so writing them one by one would be
+// one database write per member per message.
+const deliveryStatusFlushDelay = 5 * time.Second
+
+// pendingDeliveryStatus is a buffered delivery status change of a single outgoing message.
+type pendingDeliveryStatus struct {
+	portalKey networkid.PortalKey
+	// delta only contains the fields changed by receipts since the last flush
+	delta *waid.MessageMetadata
+	// aggregate is set if the read receipt should only be bridged once all group participants have read the message
+	aggregate  bool
+	lastReader types.JID
+	lastReadAt jsontime.Unix
+}
+
+// trackDeliveryStatus stores the first delivery and read receipt timestamps of
+// outgoing messages in the message metadata for the message-status command.
+// Only the changes are buffered in memory, they're merged into the database rows by flushDeliveryStatus.
+//
+// If aggregate group read receipts are enabled, read receipts of group messages are removed from
+// the returned targets, and flushDeliveryStatus bridges them once all participants have read the message.
+func (wa *WhatsAppClient) trackDeliveryStatus(evt *events.Receipt, targets []networkid.MessageID) []networkid.MessageID {
+	aggregate := evt.Type == types.ReceiptTypeRead &&
+		evt.Chat.Server == types.GroupServer &&
+		wa.Main.Config.GroupReadReceipts == GroupReadReceiptsAggregate
+	portalKey := wa.makeWAPortalKey(evt.Chat)
+	ts := jsontime.U(evt.Timestamp)
+	wa.deliveryStatusLock.Lock()
+	defer wa.deliveryStatusLock.Unlock()
+	if len(wa.deliveryStatusPending) == 0 {
+		time.AfterFunc(deliveryStatusFlushDelay, wa.flushDeliveryStatus)
+	}
+	if wa.deliveryStatusPending == nil {
+		wa.deliveryStatusPending = make(map[networkid.MessageID]*pendingDeliveryStatus)
+	}
+	for _, target := range targets {
+		pending, ok := wa.deliveryStatusPending[target]
+		if !ok {
+			pending = &pendingDeliveryStatus{
+				portalKey: portalKey,
+				delta:     &waid.MessageMetadata{},
+			}
+			wa.deliveryStatusPending[target] = pending
+		}
+		if pending.delta.DeliveredAt == nil {
+			// Read receipts imply delivery, even if the delivery receipt wasn't received
+			pending.delta.DeliveredAt = &ts
+		}
+		if evt.Chat.Server == types.GroupServer {
+			trackRecipientReceipt(pending.delta, evt.Sender.User, evt.Type, ts)
+		}
+		if aggregate {
+			pending.aggregate = true
+			pending.lastReader = evt.Sender
+			pending.lastReadAt = ts
+		} else if evt.Type == types.ReceiptTypeRead && pending.delta.ReadAt == nil {
+			pending.delta.ReadAt = &ts
+		}
+	}
+	if aggregate {
+		return nil
+	}
+	return targets
+}
+
+// flushDeliveryStatus merges the buffered delivery status changes into the messages in the database.
+func (wa *WhatsAppClient) flushDeliveryStatus() {
+	wa.deliveryStatusLock.Lock()
+	pending := wa.deliveryStatusPending
+	wa.deliveryStatusPending = nil
+	wa.deliveryStatusLock.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	// Flushes are serialized so that two flushes never read and write the same row concurrently
+	wa.deliveryStatusFlushLock.Lock()
+	defer wa.deliveryStatusFlushLock.Unlock()
+	log := wa.UserLogin.Log.With().Str("action", "flush delivery status").Logger()
+	ctx := log.WithContext(context.Background())
+	for id, status := range pending {
+		msg, err := wa.Main.Bridge.DB.Message.GetPartByID(ctx, status.portalKey.Receiver, id, "")
+		if err != nil {
+			log.Err(err).Str("message_id", string(id)).Msg("Failed to get message to save delivery status")
+			continue
+		} else if msg == nil {
+			if status.aggregate {
+				wa.queueAggregateReadReceipt(status, id)
+			}
+			continue
+		}
+		meta := msg.Metadata.(*waid.MessageMetadata)
+		changed := mergeDeliveryStatus(meta, status.delta)
+		if status.aggregate && meta.ReadAt == nil {
+			chatJID, _ := waid.ParsePortalID(status.portalKey.ID)
+			recipientCount := wa.getGroupRecipientCount(chatJID)
+			if recipientCount > 0 && countReadReceipts(meta) >= recipientCount {
+				meta.ReadAt = &status.lastReadAt
+				changed = true
+				wa.queueAggregateReadReceipt(status, id)
+			}
+		}
+		if !changed {
+			continue
+		}
+		err = wa.Main.Bridge.DB.Message.Update(ctx, msg)
+		if err != nil {
+			log.Err(err).Str("message_id", string(id)).Msg("Failed to save delivery status")
+		}
+	}
+}
+
+// queueAggregateReadReceipt bridges a group read receipt that was held back until all participants had read the message.
+func (wa *WhatsAppClient) queueAggregateReadReceipt(status *pendingDeliveryStatus, id networkid.MessageID) {
+	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &simplevent.Receipt{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventReadReceipt,
+			PortalKey: status.portalKey,
+			Sender:    wa.makeEventSender(status.lastReader),
+			Timestamp: status.lastReadAt.Time,
+		},
+		Targets: []networkid.MessageID{id},
+	})
+}
+
+// mergeDeliveryStatus copies the receipt timestamps from delta into meta, keeping any timestamps that are already set.
+func mergeDeliveryStatus(meta, delta *waid.MessageMetadata) bool {
+	changed := false
+	if meta.DeliveredAt == nil && delta.DeliveredAt != nil {
+		meta.DeliveredAt = delta.DeliveredAt
+		changed = true
+	}
+	if meta.ReadAt == nil && delta.ReadAt != nil {
+		meta.ReadAt = delta.ReadAt
+		changed = true
+	}
+	for user, receipt := range delta.Receipts {
+		if receipt.DeliveredAt != nil && trackRecipientReceipt(meta, user, types.ReceiptTypeDelivered, *receipt.DeliveredAt) {
+			changed = true
+		}
+		if receipt.ReadAt != nil && trackRecipientReceipt(meta, user, types.ReceiptTypeRead, *receipt.ReadAt) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// countReadReceipts returns the number of group participants who have read the message.
+func countReadReceipts(meta *waid.MessageMetadata) int {
+	count := 0
+	for _, receipt := range meta.Receipts {
+		if receipt.ReadAt != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// trackRecipientReceipt stores the receipt of an individual group participant for the message-info command.
+func trackRecipientReceipt(meta *waid.MessageMetadata, user string, receiptType types.ReceiptType, ts jsontime.Unix) bool {
+	if meta.Receipts == nil {
+		meta.Receipts = make(map[string]*waid.MessageReceipt)
+	}
+	receipt, ok := meta.Receipts[user]
+	if !ok {
+		receipt = &waid.MessageReceipt{}
+		meta.Receipts[user] = receipt
+	}
+	changed := !ok
+	if receipt.DeliveredAt == nil {
+		receipt.DeliveredAt = &ts
+		changed = true
+	}
+	if receiptType == types.ReceiptTypeRead && receipt.ReadAt == nil {
+		receipt.ReadAt = &ts
+		changed = true
+	}
+	return changed
+}
+
+const groupRecipientCountCacheTTL = 1 * time.Hour
+
+type groupRecipientCount struct {
+	count   int
+	fetched time.Time
+}
+
+// getGroupRecipientCount returns the number of other participants in a group.
+// The count is cached, and failed fetches are cached too, so that receipts in groups the user
+// can't query (e.g. ones they left) don't cause a new query every time. The query itself is
+// done without holding the lock, so other groups aren't blocked while waiting for the response.
+func (wa *WhatsAppClient) getGroupRecipientCount(jid types.JID) int {
+	wa.groupRecipientCountsLock.Lock()
+	cached, ok := wa.groupRecipientCounts[jid]
+	if ok && time.Since(cached.fetched) < groupRecipientCountCacheTTL {
+		wa.groupRecipientCountsLock.Unlock()
+		return cached.count
+	}
+	// Mark the entry as fresh before fetching, so concurrent callers use the old value instead of querying again
+	wa.groupRecipientCounts[jid] = groupRecipientCount{count: cached.count, fetched: time.Now()}
+	wa.groupRecipientCountsLock.Unlock()
+
+	info, err := wa.Client.GetGroupInfo(jid)
+	if err != nil {
+		wa.UserLogin.Log.Err(err).Stringer("group_jid", jid).Msg("Failed to get group info to count receipt recipients")
+		return cached.count
+	}
+	count := len(info.Participants) - 1
+	wa.groupRecipientCountsLock.Lock()
+	wa.groupRecipientCounts[jid] = groupRecipientCount{count: count, fetched: time.Now()}
+	wa.groupRecipientCountsLock.Unlock()
+	wa.storeLIDMappings(info.Participants)
+	return count
+}
+
+// storeLIDMappings remembers the phone number JIDs of group participants by their LIDs.
+func (wa *WhatsAppClient) storeLIDMappings(participants []types.GroupParticipant) {
+	wa.lidMappingsLock.Lock()
+	defer wa.lidMappingsLock.Unlock()
+	for _, participant := range participants {
+		if !participant.LID.IsEmpty() && participant.JID.Server == types.DefaultUserServer {
+			wa.lidMappings[participant.LID.ToNonAD()] = participant.JID.ToNonAD()
+		}
+	}
+}
+
+// resolveLIDSender finds the phone number JID of a LID user in a group using the LID mappings
+// collected from group participant lists. If the mapping isn't known yet, the group participants
+// are fetched in the background (at most once per cache period), so that later events can be resolved.
+func (wa *WhatsAppClient) resolveLIDSender(chat, lid types.JID) (types.JID, bool) {
+	wa.lidMappingsLock.RLock()
+	pn, ok := wa.lidMappings[lid.ToNonAD()]
+	wa.lidMappingsLock.RUnlock()
+	if !ok {
+		if chat.Server == types.GroupServer {
+			wa.groupRecipientCountsLock.Lock()
+			cached, hasCached := wa.groupRecipientCounts[chat]
+			wa.groupRecipientCountsLock.Unlock()
+			if !hasCached || time.Since(cached.fetched) >= groupRecipientCountCacheTTL {
+				// Also refreshes the LID mappings
+				go wa.getGroupRecipientCount(chat)
+			}
+		}
+		return lid, false
+	}
+	pn.Device = lid.Device
+	return pn, true
+}
+
 func (wa *WhatsAppClient) handleWAChatPresence(evt *events.ChatPresence) {
 	typingType := bridgev2.TypingTypeText
 	timeout := 15 * time.Second
@@ -354,6 +694,8 @@ func (wa *WhatsAppClient) handleWALogout(reason events.ConnectFailureReason, onC
 	wa.Client.Disconnect()
 	wa.Client = nil
 	wa.JID = types.EmptyJID
+	// The login can't reconnect without logging in again, so stop counting it as down in the health status
+	wa.Main.clients.CompareAndDelete(wa.UserLogin.ID, wa)
 	wa.UserLogin.Metadata.(*waid.UserLoginMetadata).WADeviceID = 0
 	wa.UserLogin.BridgeState.Send(status.BridgeState{
 		StateEvent: status.StateBadCredentials,
@@ -373,7 +715,7 @@ func (wa *WhatsAppClient) handleWACallStart(sender types.JID, id, callType strin
 			LogContext:   nil,
 			PortalKey:    wa.makeWAPortalKey(sender),
 			Sender:       wa.makeEventSender(sender),
-			CreatePortal: true,
+			CreatePortal: wa.Main.Config.ChatFilter.Allows(sender),
 			Timestamp:    ts,
 		},
 		Data:               callType,
@@ -437,6 +779,114 @@ func convertIdentityChange(ctx context.Context, portal *bridgev2.Portal, intent
 	}, nil
 }
 
+type numberChange struct {
+	OldJID types.JID
+	NewJID types.JID
+}
+
+// handleGroupNumberChanges detects contacts changing their phone number from group notifications.
+// WhatsApp announces number changes to every group the user is in with a modify element, which
+// whatsmeow doesn't parse, so it ends up in UnknownChanges. The notification is sent by the new
+// number and the modify element lists the old number as a participant.
+func (wa *WhatsAppClient) handleGroupNumberChanges(evt *events.GroupInfo) {
+	if evt.Sender == nil || evt.Sender.Server != types.DefaultUserServer {
+		return
+	}
+	newJID := evt.Sender.ToNonAD()
+	for _, change := range evt.UnknownChanges {
+		if change.Tag != "modify" {
+			continue
+		}
+		for _, child := range change.GetChildrenByTag("participant") {
+			oldJID, ok := child.Attrs["jid"].(types.JID)
+			if !ok || oldJID.Server != types.DefaultUserServer || oldJID.User == newJID.User {
+				continue
+			}
+			ctx := wa.UserLogin.Log.With().Stringer("group_jid", evt.JID).Logger().WithContext(context.Background())
+			err := wa.migrateContactNumber(ctx, oldJID.ToNonAD(), newJID)
+			if err != nil {
+				zerolog.Ctx(ctx).Err(err).
+					Stringer("old_jid", oldJID).
+					Stringer("new_jid", newJID).
+					Msg("Failed to migrate contact after number change")
+			}
+		}
+	}
+}
+
+// migrateContactNumber moves the DM portal of a contact who changed their phone number
+// to the new JID, so that the new number doesn't end up with a separate duplicate portal.
+//
+// This is called when a number change is announced in a group, see handleGroupNumberChanges,
+// and from the migrate-number command. Contacts who don't share any groups with the user
+// have to be migrated with the command.
+func (wa *WhatsAppClient) migrateContactNumber(ctx context.Context, oldJID, newJID types.JID) error {
+	log := zerolog.Ctx(ctx).With().
+		Str("action", "migrate contact number").
+		Stringer("old_jid", oldJID).
+		Stringer("new_jid", newJID).
+		Logger()
+	ctx = log.WithContext(ctx)
+	oldKey := wa.makeWAPortalKey(oldJID)
+	newKey := wa.makeWAPortalKey(newJID)
+	result, portal, err := wa.Main.Bridge.ReIDPortal(ctx, oldKey, newKey)
+	if err != nil {
+		return fmt.Errorf("failed to move portal: %w", err)
+	}
+	wa.syncGhost(newJID, "number change", nil)
+	if result == bridgev2.ReIDResultNoOp {
+		// There's no DM portal with the old number, or it was already moved by an earlier notification
+		return nil
+	}
+	log.Info().Any("result", result).Msg("Moved DM portal to new number")
+	if portal == nil || portal.MXID == "" {
+		return nil
+	}
+	wa.UserLogin.QueueRemoteEvent(&simplevent.ChatResync{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventChatResync,
+			PortalKey: newKey,
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("sync_reason", "number change")
+			},
+		},
+		GetChatInfoFunc: wa.GetChatInfo,
+	})
+	ts := time.Now()
+	wa.UserLogin.QueueRemoteEvent(&simplevent.Message[*numberChange]{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventMessage,
+			PortalKey: newKey,
+			Sender:    wa.makeEventSender(newJID),
+			Timestamp: ts,
+		},
+		Data:               &numberChange{OldJID: oldJID, NewJID: newJID},
+		ID:                 waid.MakeFakeMessageID(newJID, newJID, "numberchange-"+strconv.FormatInt(ts.UnixMilli(), 10)),
+		ConvertMessageFunc: convertNumberChange,
+	})
+	return nil
+}
+
+func convertNumberChange(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, data *numberChange) (*bridgev2.ConvertedMessage, error) {
+	ghost, err := portal.Bridge.GetGhostByID(ctx, waid.MakeUserID(data.NewJID))
+	if err != nil {
+		return nil, err
+	}
+	name := ghost.Name
+	if name == "" {
+		name = "+" + data.NewJID.User
+	}
+	return &bridgev2.ConvertedMessage{
+		Parts: []*bridgev2.ConvertedMessagePart{{
+			Type: event.EventMessage,
+			Content: &event.MessageEventContent{
+				MsgType: event.MsgNotice,
+				Body:    fmt.Sprintf("%s changed their WhatsApp number from +%s to +%s.", name, data.OldJID.User, data.NewJID.User),
+			},
+		}},
+	}, nil
+}
+
 func (wa *WhatsAppClient) handleWADeleteChat(evt *events.DeleteChat) {
 	wa.UserLogin.QueueRemoteEvent(&simplevent.ChatDelete{
 		EventMeta: simplevent.EventMeta{
@@ -488,15 +938,39 @@ func (wa *WhatsAppClient) syncGhost(jid types.JID, reason string, pictureID *str
 	if pictureID != nil && *pictureID != "" && ghost.AvatarID == networkid.AvatarID(*pictureID) {
 		return
 	}
-	userInfo, err := wa.getUserInfo(ctx, jid, pictureID != nil)
+	userInfo, err := wa.getUserInfo(ctx, jid, ghostVerifiedName(ghost), pictureID != nil)
 	if err != nil {
 		log.Err(err).Msg("Failed to get user info")
 	} else {
+		applyGhostAbout(userInfo, ghost.Metadata.(*waid.GhostMetadata).About)
 		ghost.UpdateInfo(ctx, userInfo)
 		log.Debug().Msg("Synced ghost info")
 	}
 }
 
+func (wa *WhatsAppClient) handleWAUserAbout(evt *events.UserAbout) {
+	log := wa.UserLogin.Log.With().
+		Str("action", "sync ghost about").
+		Stringer("jid", evt.JID).
+		Logger()
+	ctx := log.WithContext(context.Background())
+	ghost, err := wa.Main.Bridge.GetGhostByID(ctx, waid.MakeUserID(evt.JID))
+	if err != nil {
+		log.Err(err).Msg("Failed to get ghost")
+		return
+	} else if ghost.Metadata.(*waid.GhostMetadata).About == evt.Status {
+		return
+	}
+	userInfo, err := wa.getUserInfo(ctx, evt.JID, ghostVerifiedName(ghost), false)
+	if err != nil {
+		log.Err(err).Msg("Failed to get user info")
+		return
+	}
+	applyGhostAbout(userInfo, evt.Status)
+	ghost.UpdateInfo(ctx, userInfo)
+	log.Debug().Msg("Synced ghost about text")
+}
+
 func (wa *WhatsAppClient) handleWAPictureUpdate(evt *events.Picture) {
 	if evt.JID.Server == types.DefaultUserServer {
 		wa.syncGhost(evt.JID, "picture event", &evt.PictureID)
@@ -529,11 +1003,14 @@ func (wa *WhatsAppClient) handleWAPictureUpdate(evt *events.Picture) {
 }
 
 func (wa *WhatsAppClient) handleWAGroupInfoChange(evt *events.GroupInfo) {
+	if len(evt.UnknownChanges) > 0 {
+		wa.handleGroupNumberChanges(evt)
+	}
 	eventMeta := simplevent.EventMeta{
 		Type:         bridgev2.RemoteEventChatInfoChange,
 		LogContext:   nil,
 		PortalKey:    wa.makeWAPortalKey(evt.JID),
-		CreatePortal: true,
+		CreatePortal: wa.Main.Config.ChatFilter.Allows(evt.JID),
 		Timestamp:    evt.Timestamp,
 	}
 	if evt.Sender != nil {
@@ -543,23 +1020,212 @@ func (wa *WhatsAppClient) handleWAGroupInfoChange(evt *events.GroupInfo) {
 		eventMeta.Type = bridgev2.RemoteEventChatDelete
 		wa.UserLogin.QueueRemoteEvent(&simplevent.ChatDelete{EventMeta: eventMeta})
 	} else {
-		wa.UserLogin.QueueRemoteEvent(&simplevent.ChatInfoChange{
-			EventMeta:      eventMeta,
-			ChatInfoChange: wa.wrapGroupInfoChange(evt),
+		var portalMeta *waid.PortalMetadata
+		if evt.Announce != nil || evt.Locked != nil || evt.Topic != nil {
+			portalMeta = wa.getExistingPortalMetadata(evt.JID)
+		}
+		changes := wa.wrapGroupInfoChange(evt, portalMeta)
+		if changes.ChatInfo != nil || changes.MemberChanges != nil {
+			wa.UserLogin.QueueRemoteEvent(&simplevent.ChatInfoChange{
+				EventMeta:      eventMeta,
+				ChatInfoChange: changes,
+			})
+		} else if evt.Topic != nil {
+			wa.UserLogin.Log.Debug().
+				Stringer("chat_jid", evt.JID).
+				Str("topic_id", evt.Topic.TopicID).
+				Msg("Ignoring duplicate group topic change")
+		}
+	}
+	if len(evt.Join) > 0 && evt.Delete == nil && wa.Main.Config.DisappearingJoinNotices {
+		ctx := wa.UserLogin.Log.WithContext(context.Background())
+		portal, err := wa.Main.Bridge.GetExistingPortalByKey(ctx, wa.makeWAPortalKey(evt.JID))
+		if err != nil {
+			wa.UserLogin.Log.Err(err).Stringer("chat_jid", evt.JID).Msg("Failed to get portal to check disappearing timer")
+		} else if portal != nil && portal.MXID != "" && portal.Disappear.Timer > 0 {
+			wa.queueDisappearingTimerNotice(evt.JID, "join-"+strconv.FormatInt(evt.Timestamp.UnixMilli(), 10))
+		}
+	}
+	for _, node := range evt.UnknownChanges {
+		if node.Tag == "created_membership_requests" {
+			wa.handleGroupJoinRequest(evt, node)
+		}
+	}
+}
+
+type groupJoinRequest struct {
+	Requester types.JID
+}
+
+// handleGroupJoinRequest posts a notice about a new join request in groups that require admin approval.
+// whatsmeow doesn't parse these notifications, so they're read from the unknown changes of the group info event.
+func (wa *WhatsAppClient) handleGroupJoinRequest(evt *events.GroupInfo, node *waBinary.Node) {
+	var requesters []types.JID
+	for _, child := range node.GetChildrenByTag("requested_user") {
+		if jid, ok := child.Attrs["jid"].(types.JID); ok {
+			requesters = append(requesters, jid)
+		}
+	}
+	if len(requesters) == 0 && evt.Sender != nil {
+		requesters = append(requesters, *evt.Sender)
+	}
+	for _, requester := range requesters {
+		if requester.Server != types.DefaultUserServer {
+			continue
+		}
+		wa.UserLogin.QueueRemoteEvent(&simplevent.Message[*groupJoinRequest]{
+			EventMeta: simplevent.EventMeta{
+				Type:      bridgev2.RemoteEventMessage,
+				PortalKey: wa.makeWAPortalKey(evt.JID),
+				Timestamp: evt.Timestamp,
+			},
+			Data:               &groupJoinRequest{Requester: requester.ToNonAD()},
+			ID:                 waid.MakeFakeMessageID(evt.JID, requester, "joinrequest-"+strconv.FormatInt(evt.Timestamp.UnixMilli(), 10)),
+			ConvertMessageFunc: wa.convertGroupJoinRequest,
 		})
 	}
 }
 
+func (wa *WhatsAppClient) convertGroupJoinRequest(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, data *groupJoinRequest) (*bridgev2.ConvertedMessage, error) {
+	name := wa.getPublicContactName(data.Requester)
+	prefix := wa.Main.Bridge.Config.CommandPrefix
+	phone := "+" + data.Requester.User
+	content := format.RenderMarkdown(fmt.Sprintf(
+		"%s wants to join this group. Use `%s approve-member %s` or `%s reject-member %s` to respond.",
+		name, prefix, phone, prefix, phone,
+	), true, false)
+	content.MsgType = event.MsgNotice
+	return &bridgev2.ConvertedMessage{
+		Parts: []*bridgev2.ConvertedMessagePart{{
+			Type:    event.EventMessage,
+			Content: &content,
+		}},
+	}, nil
+}
+
+// getExistingPortalMetadata returns a copy of the metadata of the given chat's portal, or nil if it doesn't exist.
+func (wa *WhatsAppClient) getExistingPortalMetadata(jid types.JID) *waid.PortalMetadata {
+	ctx := wa.UserLogin.Log.WithContext(context.Background())
+	portal, err := wa.Main.Bridge.GetExistingPortalByKey(ctx, wa.makeWAPortalKey(jid))
+	if err != nil {
+		wa.UserLogin.Log.Err(err).Stringer("chat_jid", jid).Msg("Failed to get portal to check group settings")
+		return nil
+	} else if portal == nil {
+		return nil
+	}
+	meta := *portal.Metadata.(*waid.PortalMetadata)
+	return &meta
+}
+
 func (wa *WhatsAppClient) handleWAJoinedGroup(evt *events.JoinedGroup) {
 	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &simplevent.ChatResync{
 		EventMeta: simplevent.EventMeta{
 			Type:         bridgev2.RemoteEventChatResync,
 			LogContext:   nil,
 			PortalKey:    wa.makeWAPortalKey(evt.JID),
-			CreatePortal: true,
+			CreatePortal: wa.Main.Config.ChatFilter.Allows(evt.JID),
 		},
 		ChatInfo: wa.wrapGroupInfo(&evt.GroupInfo),
 	})
+	if wa.Main.Config.GroupJoinNotices {
+		wa.queueGroupJoinNotice(evt)
+	}
+	if wa.Main.Config.DisappearingJoinNotices && evt.IsEphemeral {
+		wa.queueDisappearingTimerNotice(evt.JID, "joined-"+joinedGroupDedupKey(evt))
+	}
+}
+
+// joinedGroupDedupKey returns a key that identifies the user's join to the group for fake message IDs.
+// The participant version ID stays the same when the notification is replayed, but it isn't always present,
+// so the current time is used instead to avoid all those joins colliding on the same message ID.
+func joinedGroupDedupKey(evt *events.JoinedGroup) string {
+	if evt.ParticipantVersionID != "" {
+		return evt.ParticipantVersionID
+	}
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
+
+// queueDisappearingTimerNotice posts the current disappearing message timer of the portal as context for new members.
+func (wa *WhatsAppClient) queueDisappearingTimerNotice(chat types.JID, dedupKey string) {
+	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &simplevent.Message[struct{}]{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventMessage,
+			PortalKey: wa.makeWAPortalKey(chat),
+			Timestamp: time.Now(),
+		},
+		ID:                 waid.MakeFakeMessageID(chat, wa.JID, "disappearing-"+dedupKey),
+		ConvertMessageFunc: convertDisappearingTimerNotice,
+	})
+}
+
+func convertDisappearingTimerNotice(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, _ struct{}) (*bridgev2.ConvertedMessage, error) {
+	return &bridgev2.ConvertedMessage{
+		Parts: []*bridgev2.ConvertedMessagePart{{
+			Type:    event.EventMessage,
+			Content: bridgev2.DisappearingMessageNotice(portal.Disappear.Timer, false),
+			// The timer may have been turned off before the event was handled
+			DontBridge: portal.Disappear.Timer == 0,
+		}},
+	}, nil
+}
+
+type groupJoinNotice struct {
+	Created bool
+	Creator types.JID
+	Reason  string
+}
+
+// queueGroupJoinNotice posts a notice about the group being created or the user being added to it.
+// The message ID is derived from the group state, so replayed notifications don't produce duplicate notices.
+func (wa *WhatsAppClient) queueGroupJoinNotice(evt *events.JoinedGroup) {
+	notice := &groupJoinNotice{Reason: evt.Reason}
+	eventMeta := simplevent.EventMeta{
+		Type:      bridgev2.RemoteEventMessage,
+		PortalKey: wa.makeWAPortalKey(evt.JID),
+		Timestamp: time.Now(),
+	}
+	var msgID networkid.MessageID
+	if evt.Type == "new" && !evt.OwnerJID.IsEmpty() {
+		notice.Created = true
+		notice.Creator = evt.OwnerJID.ToNonAD()
+		eventMeta.Sender = wa.makeEventSender(notice.Creator)
+		if !evt.GroupCreated.IsZero() {
+			eventMeta.Timestamp = evt.GroupCreated
+		}
+		msgID = waid.MakeFakeMessageID(evt.JID, notice.Creator, "created-"+strconv.FormatInt(evt.GroupCreated.Unix(), 10))
+	} else {
+		// whatsmeow doesn't include who added the user, so the notice is sent by the bridge bot
+		msgID = waid.MakeFakeMessageID(evt.JID, wa.JID, "joined-"+joinedGroupDedupKey(evt))
+	}
+	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &simplevent.Message[*groupJoinNotice]{
+		EventMeta:          eventMeta,
+		Data:               notice,
+		ID:                 msgID,
+		ConvertMessageFunc: wa.convertGroupJoinNotice,
+	})
+}
+
+func (wa *WhatsAppClient) convertGroupJoinNotice(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, data *groupJoinNotice) (*bridgev2.ConvertedMessage, error) {
+	var body string
+	switch {
+	case data.Created && data.Creator.User == wa.JID.User:
+		body = "You created this group"
+	case data.Created:
+		body = fmt.Sprintf("%s created this group", wa.getPublicContactName(data.Creator))
+	case data.Reason == "invite":
+		body = "You joined this group using an invite link"
+	default:
+		body = "You were added to this group"
+	}
+	return &bridgev2.ConvertedMessage{
+		Parts: []*bridgev2.ConvertedMessagePart{{
+			Type: event.EventMessage,
+			Content: &event.MessageEventContent{
+				MsgType: event.MsgNotice,
+				Body:    body,
+			},
+		}},
+	}, nil
 }
 
 func (wa *WhatsAppClient) handleWANewsletterJoin(evt *events.NewsletterJoin) {
@@ -568,12 +1234,47 @@ func (wa *WhatsAppClient) handleWANewsletterJoin(evt *events.NewsletterJoin) {
 			Type:         bridgev2.RemoteEventChatResync,
 			LogContext:   nil,
 			PortalKey:    wa.makeWAPortalKey(evt.ID),
-			CreatePortal: true,
+			CreatePortal: wa.Main.Config.ChatFilter.Allows(evt.ID),
 		},
 		ChatInfo: wa.wrapNewsletterInfo(&evt.NewsletterMetadata),
 	})
 }
 
+// handleNewsletterRoleChange updates the user's own power level in a newsletter portal
+// after their role changed (e.g. when they were promoted to admin or demoted).
+func (wa *WhatsAppClient) handleNewsletterRoleChange(jid types.JID, role types.NewsletterRole) {
+	ownPowerLevel := newsletterRolePowerLevel(role)
+	wa.UserLogin.QueueRemoteEvent(&simplevent.ChatInfoChange{
+		EventMeta: simplevent.EventMeta{
+			Type:      bridgev2.RemoteEventChatInfoChange,
+			PortalKey: wa.makeWAPortalKey(jid),
+			Timestamp: time.Now(),
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("newsletter_role", string(role))
+			},
+		},
+		ChatInfoChange: &bridgev2.ChatInfoChange{
+			ChatInfo: &bridgev2.ChatInfo{
+				// Capabilities depend on the role, so they need to be updated after the role is stored
+				ExtraUpdates: bridgev2.MergeExtraUpdaters(
+					updateNewsletterRole(role),
+					func(ctx context.Context, portal *bridgev2.Portal) bool {
+						return portal.UpdateCapabilities(ctx, wa.UserLogin, false)
+					},
+				),
+			},
+			MemberChanges: &bridgev2.ChatMemberList{
+				MemberMap: map[networkid.UserID]bridgev2.ChatMember{
+					waid.MakeUserID(wa.JID): {
+						EventSender: wa.makeEventSender(wa.JID),
+						PowerLevel:  &ownPowerLevel,
+					},
+				},
+			},
+		},
+	})
+}
+
 func (wa *WhatsAppClient) handleWANewsletterLeave(evt *events.NewsletterLeave) {
 	wa.Main.Bridge.QueueRemoteEvent(wa.UserLogin, &simplevent.ChatDelete{
 		EventMeta: simplevent.EventMeta{
@@ -0,0 +1,103 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/util/jsontime"
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/bridgev2/database"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+func TestIsOwnDeviceEcho(t *testing.T) {
+	bridgeJID := types.JID{User: "15551234567", Device: 12, Server: types.DefaultUserServer}
+	wa := &WhatsAppClient{JID: bridgeJID}
+	phone := types.JID{User: "15551234567", Server: types.DefaultUserServer}
+	otherLinkedDevice := types.JID{User: "15551234567", Device: 3, Server: types.DefaultUserServer}
+	otherUser := types.JID{User: "15559876543", Device: 12, Server: types.DefaultUserServer}
+
+	tests := []struct {
+		name   string
+		info   types.MessageInfo
+		expect bool
+	}{
+		{"SentByBridge", types.MessageInfo{MessageSource: types.MessageSource{Sender: bridgeJID, IsFromMe: true}}, true},
+		{"SentFromPhone", types.MessageInfo{MessageSource: types.MessageSource{Sender: phone, IsFromMe: true}}, false},
+		{"SentFromOtherLinkedDevice", types.MessageInfo{MessageSource: types.MessageSource{Sender: otherLinkedDevice, IsFromMe: true}}, false},
+		{"IncomingWithSameDeviceID", types.MessageInfo{MessageSource: types.MessageSource{Sender: otherUser}}, false},
+		{"NotFromMe", types.MessageInfo{MessageSource: types.MessageSource{Sender: bridgeJID}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := wa.isOwnDeviceEcho(test.info); got != test.expect {
+				t.Errorf("isOwnDeviceEcho() = %t, expected %t", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestIsRevokeSentByBridge(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   *database.Message
+		revokeID types.MessageID
+		expect   bool
+	}{
+		{"RevokedFromMatrix", &database.Message{Metadata: &waid.MessageMetadata{RevokeID: "3EB0AAAA"}}, "3EB0AAAA", true},
+		{"RevokedFromPhone", &database.Message{Metadata: &waid.MessageMetadata{RevokeID: "3EB0AAAA"}}, "3A1BBBBB", false},
+		{"NeverRevokedFromMatrix", &database.Message{Metadata: &waid.MessageMetadata{}}, "3A1BBBBB", false},
+		{"EmptyRevokeID", &database.Message{Metadata: &waid.MessageMetadata{}}, "", false},
+		{"UnknownTarget", nil, "3EB0AAAA", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isRevokeSentByBridge(test.target, test.revokeID); got != test.expect {
+				t.Errorf("isRevokeSentByBridge() = %t, expected %t", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestMergeDeliveryStatus(t *testing.T) {
+	early := jsontime.U(time.Unix(1700000000, 0))
+	late := jsontime.U(time.Unix(1700000100, 0))
+	// The row was modified after the receipts were buffered, e.g. by a Matrix redaction
+	meta := &waid.MessageMetadata{
+		RevokeID:    "3EB0BBBBBBBBBBBB",
+		DeliveredAt: &early,
+		Receipts: map[string]*waid.MessageReceipt{
+			"15550000001": {DeliveredAt: &early},
+		},
+	}
+	delta := &waid.MessageMetadata{
+		DeliveredAt: &late,
+		ReadAt:      &late,
+		Receipts: map[string]*waid.MessageReceipt{
+			"15550000001": {DeliveredAt: &late, ReadAt: &late},
+			"15550000002": {DeliveredAt: &late},
+		},
+	}
+	if !mergeDeliveryStatus(meta, delta) {
+		t.Error("mergeDeliveryStatus() = false, expected changes")
+	}
+	if meta.RevokeID != "3EB0BBBBBBBBBBBB" {
+		t.Errorf("RevokeID = %q, expected it to be preserved", meta.RevokeID)
+	}
+	if !meta.DeliveredAt.Equal(early.Time) {
+		t.Errorf("DeliveredAt = %v, expected the existing timestamp %v", meta.DeliveredAt, early)
+	}
+	if meta.ReadAt == nil || !meta.ReadAt.Equal(late.Time) {
+		t.Errorf("ReadAt = %v, expected %v", meta.ReadAt, late)
+	}
+	if receipt := meta.Receipts["15550000001"]; !receipt.DeliveredAt.Equal(early.Time) || receipt.ReadAt == nil {
+		t.Errorf("existing recipient receipt = %+v, expected the old delivery and a new read timestamp", receipt)
+	}
+	if _, ok := meta.Receipts["15550000002"]; !ok {
+		t.Error("new recipient receipt is missing")
+	}
+	if mergeDeliveryStatus(meta, delta) {
+		t.Error("merging the same delta twice reported changes")
+	}
+}
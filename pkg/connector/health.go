@@ -0,0 +1,106 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2024 Tulir Asokan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package connector
+
+import (
+	"time"
+
+	"maunium.net/go/mautrix/bridge/status"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+type LoginHealth struct {
+	ID              networkid.UserLoginID       `json:"id"`
+	Connected       bool                        `json:"connected"`
+	LoggedOut       bool                        `json:"logged_out"`
+	StateEvent      status.BridgeStateEvent     `json:"state_event,omitempty"`
+	Error           status.BridgeStateErrorCode `json:"error,omitempty"`
+	LastHistorySync *time.Time                  `json:"last_history_sync,omitempty"`
+}
+
+type HealthStatus struct {
+	Healthy         bool       `json:"healthy"`
+	Total           int        `json:"total"`
+	Connected       int        `json:"connected"`
+	Disconnected    int        `json:"disconnected"`
+	LoggedOut       int        `json:"logged_out"`
+	LastHistorySync *time.Time `json:"last_history_sync,omitempty"`
+	// Number of media files currently being transferred from WhatsApp to Matrix
+	MediaTransfers int64 `json:"media_transfers_in_flight"`
+	// Number of times profile picture queries have been rate limited since the bridge started
+	ProfilePictureRateLimits int64 `json:"profile_picture_rate_limits"`
+
+	Logins []*LoginHealth `json:"logins,omitempty"`
+}
+
+func (wa *WhatsAppClient) getHealth() *LoginHealth {
+	prevState := wa.UserLogin.BridgeState.GetPrev()
+	health := &LoginHealth{
+		ID:         wa.UserLogin.ID,
+		StateEvent: prevState.StateEvent,
+		Error:      prevState.Error,
+	}
+	if wa.Client == nil || prevState.StateEvent == status.StateBadCredentials {
+		health.LoggedOut = true
+	} else {
+		health.Connected = wa.Client.IsConnected() && wa.Client.IsLoggedIn()
+	}
+	meta := wa.UserLogin.Metadata.(*waid.UserLoginMetadata)
+	lastSync := meta.LastHistorySync.Time
+	if meta.HistorySyncCursor != nil && meta.HistorySyncCursor.UpdatedAt.After(lastSync) {
+		lastSync = meta.HistorySyncCursor.UpdatedAt.Time
+	}
+	if !lastSync.IsZero() && lastSync.Unix() > 0 {
+		health.LastHistorySync = &lastSync
+	}
+	return health
+}
+
+// GetHealth summarizes the WhatsApp connection state of all logins the bridge is currently connecting.
+// Logins that were logged out or disconnected on purpose (e.g. deleted or replaced) aren't included.
+// The status is unhealthy if at least health_down_threshold percent of logins are disconnected or logged out.
+func (wa *WhatsAppConnector) GetHealth(includeLogins bool) *HealthStatus {
+	resp := &HealthStatus{}
+	wa.clients.Range(func(_, value any) bool {
+		client := value.(*WhatsAppClient)
+		login := client.getHealth()
+		resp.ProfilePictureRateLimits += client.profilePictureRateLimits.Load()
+		resp.Total++
+		switch {
+		case login.LoggedOut:
+			resp.LoggedOut++
+		case login.Connected:
+			resp.Connected++
+		default:
+			resp.Disconnected++
+		}
+		if login.LastHistorySync != nil && (resp.LastHistorySync == nil || login.LastHistorySync.After(*resp.LastHistorySync)) {
+			resp.LastHistorySync = login.LastHistorySync
+		}
+		if includeLogins {
+			resp.Logins = append(resp.Logins, login)
+		}
+		return true
+	})
+	resp.MediaTransfers = wa.MsgConv.InFlightMediaTransfers()
+	threshold := wa.Config.HealthDownThreshold
+	down := resp.Disconnected + resp.LoggedOut
+	resp.Healthy = threshold <= 0 || resp.Total == 0 || down*100 < threshold*resp.Total
+	return resp
+}
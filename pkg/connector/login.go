@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog"
 	"go.mau.fi/util/exsync"
 	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
 	"maunium.net/go/mautrix/bridge/status"
@@ -298,6 +299,34 @@ func (wl *WALogin) Wait(ctx context.Context) (*bridgev2.LoginStep, error) {
 	}
 
 	newLoginID := waid.MakeUserLoginID(wl.LoginSuccess.ID)
+	meta := &waid.UserLoginMetadata{
+		WADeviceID: wl.LoginSuccess.ID.Device,
+		Timezone:   wl.Timezone,
+
+		HistorySyncPortalsNeedCreating: true,
+	}
+	var oldDeviceID uint16
+	if existing := wl.Main.Bridge.GetCachedUserLoginByID(newLoginID); existing != nil && existing.UserMXID == wl.User.MXID {
+		// Re-linking an existing login: keep the old metadata so settings and sync state aren't lost
+		existingMeta := *existing.Metadata.(*waid.UserLoginMetadata)
+		oldDeviceID = existingMeta.WADeviceID
+		existingMeta.WADeviceID = meta.WADeviceID
+		existingMeta.HistorySyncPortalsNeedCreating = true
+		if meta.Timezone != "" {
+			existingMeta.Timezone = meta.Timezone
+		}
+		meta = &existingMeta
+		wl.Log.Debug().
+			Uint16("old_device_id", oldDeviceID).
+			Uint16("new_device_id", meta.WADeviceID).
+			Msg("Re-linking existing login")
+		// The new device is paired now, so the old connection can be closed
+		// to avoid both devices fighting over the login.
+		if oldClient, ok := existing.Client.(*WhatsAppClient); ok && oldClient.Client != nil && oldClient.Client.IsConnected() {
+			wl.Log.Debug().Msg("Disconnecting old device after re-linking")
+			oldClient.Disconnect()
+		}
+	}
 	ul, err := wl.User.NewLogin(ctx, &database.UserLogin{
 		ID:         newLoginID,
 		RemoteName: "+" + wl.LoginSuccess.ID.User,
@@ -305,18 +334,16 @@ func (wl *WALogin) Wait(ctx context.Context) (*bridgev2.LoginStep, error) {
 			Phone: "+" + wl.LoginSuccess.ID.User,
 			Name:  wl.LoginSuccess.BusinessName,
 		},
-		Metadata: &waid.UserLoginMetadata{
-			WADeviceID: wl.LoginSuccess.ID.Device,
-			Timezone:   wl.Timezone,
-
-			HistorySyncPortalsNeedCreating: true,
-		},
+		Metadata: meta,
 	}, &bridgev2.NewLoginParams{
 		DeleteOnConflict: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user login: %w", err)
 	}
+	if oldDeviceID != 0 && oldDeviceID != meta.WADeviceID {
+		wl.deleteOldDevice(waid.ParseUserLoginID(newLoginID, oldDeviceID))
+	}
 
 	ul.Client.(*WhatsAppClient).isNewLogin = true
 	ul.Client.Connect(ul.Log.WithContext(context.Background()))
@@ -332,6 +359,18 @@ func (wl *WALogin) Wait(ctx context.Context) (*bridgev2.LoginStep, error) {
 	}, nil
 }
 
+func (wl *WALogin) deleteOldDevice(jid types.JID) {
+	device, err := wl.Main.DeviceStore.GetDevice(jid)
+	if err != nil {
+		wl.Log.Err(err).Stringer("old_jid", jid).Msg("Failed to get old device from store")
+	} else if device != nil {
+		err = device.Delete()
+		if err != nil {
+			wl.Log.Err(err).Stringer("old_jid", jid).Msg("Failed to delete old device from store")
+		}
+	}
+}
+
 func (wl *WALogin) Cancel() {
 	wl.Closed.Store(true)
 	wl.Client.RemoveEventHandler(wl.EventHandlerID)
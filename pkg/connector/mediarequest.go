@@ -18,13 +18,17 @@ package connector
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/rs/zerolog"
 	"go.mau.fi/whatsmeow/types"
 	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
 	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/bridgev2/simplevent"
 
 	"go.mau.fi/mautrix-whatsapp/pkg/connector/wadb"
 	"go.mau.fi/mautrix-whatsapp/pkg/msgconv"
@@ -163,3 +167,63 @@ func (wa *WhatsAppClient) sendMediaRequestDirect(rawMsgID networkid.MessageID, k
 		},
 	}, key)
 }
+
+// resendFailedMedia tries to download a media message that previously failed to bridge again.
+// If the media still can't be downloaded, a media retry request is sent to the phone,
+// and the message will be updated when the phone responds.
+func (wa *WhatsAppClient) resendFailedMedia(part *database.Message) error {
+	meta := part.Metadata.(*waid.MessageMetadata)
+	if meta.FailedMediaMeta == nil {
+		return errors.New("message doesn't have media metadata")
+	}
+	var mediaMeta msgconv.PreparedMedia
+	err := json.Unmarshal(meta.FailedMediaMeta, &mediaMeta)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal media metadata: %w", err)
+	}
+	parsedID, err := waid.ParseMessageID(part.ID)
+	if err != nil {
+		return fmt.Errorf("failed to parse message ID: %w", err)
+	}
+	wa.UserLogin.QueueRemoteEvent(&simplevent.Message[*msgconv.PreparedMedia]{
+		EventMeta: simplevent.EventMeta{
+			Type: bridgev2.RemoteEventEdit,
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("action", "resend failed media").Str("message_id", string(part.ID))
+			},
+			PortalKey: part.Room,
+			Sender:    wa.makeEventSender(parsedID.Sender),
+			Timestamp: time.Now(),
+		},
+		Data:            &mediaMeta,
+		TargetMessage:   part.ID,
+		ConvertEditFunc: wa.convertResentMedia,
+	})
+	return nil
+}
+
+func (wa *WhatsAppClient) convertResentMedia(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, existing []*database.Message, mediaMeta *msgconv.PreparedMedia) (*bridgev2.ConvertedEdit, error) {
+	meta := existing[0].Metadata.(*waid.MessageMetadata)
+	if meta.Error != waid.MsgErrMediaNotFound {
+		return nil, fmt.Errorf("%w: message doesn't have media error", bridgev2.ErrIgnoringRemoteEvent)
+	}
+	err := wa.mediaRetryLock.Acquire(ctx, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire media retry lock: %w", err)
+	}
+	defer wa.mediaRetryLock.Release(1)
+	log := zerolog.Ctx(ctx)
+	edit := wa.Main.MsgConv.MediaRetryToMatrix(ctx, mediaMeta, wa.Client, intent, portal, existing[0])
+	if _, failed := edit.ModifiedParts[0].Extra[msgconv.FailedMediaField]; failed {
+		log.Debug().Msg("Media download failed again, asking phone to reupload it")
+		err = wa.sendMediaRequestDirect(existing[0].ID, mediaMeta.FailedKeys.Key)
+		if err != nil {
+			log.Err(err).Msg("Failed to send media retry request")
+		}
+		return nil, fmt.Errorf("%w: media download failed again", bridgev2.ErrIgnoringRemoteEvent)
+	}
+	log.Info().Msg("Successfully downloaded media that previously failed to bridge")
+	meta.Error = waid.MsgNoError
+	meta.FailedMediaMeta = nil
+	return edit, nil
+}
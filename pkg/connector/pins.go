@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+// DefaultPinDuration is how long messages pinned from Matrix stay pinned on WhatsApp.
+// Matrix pins don't expire, so use the longest duration WhatsApp allows.
+const DefaultPinDuration = 30 * 24 * time.Hour
+
+// handleMatrixPinnedEvents bridges changes to the m.room.pinned_events state to WhatsApp.
+// bridgev2 doesn't handle pinned events, so this is registered directly on the Matrix event processor.
+func (wa *WhatsAppConnector) handleMatrixPinnedEvents(ctx context.Context, evt *event.Event) {
+	if evt.Sender == wa.Bridge.Bot.GetMXID() || wa.Bridge.IsGhostMXID(evt.Sender) {
+		return
+	}
+	log := wa.Bridge.Log.With().
+		Str("action", "handle matrix pinned events").
+		Stringer("room_id", evt.RoomID).
+		Stringer("event_id", evt.ID).
+		Stringer("sender", evt.Sender).
+		Logger()
+	ctx = log.WithContext(ctx)
+	portal, err := wa.Bridge.GetPortalByMXID(ctx, evt.RoomID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get portal")
+		return
+	} else if portal == nil {
+		return
+	}
+	user, err := wa.Bridge.GetExistingUserByMXID(ctx, evt.Sender)
+	if err != nil {
+		log.Err(err).Msg("Failed to get user")
+		return
+	} else if user == nil {
+		return
+	}
+	login, _, err := portal.FindPreferredLogin(ctx, user, false)
+	if err != nil || login == nil {
+		log.Debug().Err(err).Msg("Ignoring pinned events change from user without a login in the portal")
+		return
+	}
+	client, ok := login.Client.(*WhatsAppClient)
+	if !ok || client.Client == nil {
+		return
+	}
+	newPins := parsePinnedEvents(&evt.Content)
+	var oldPins []id.EventID
+	if evt.Unsigned.PrevContent != nil {
+		oldPins = parsePinnedEvents(evt.Unsigned.PrevContent)
+	}
+	for _, eventID := range newPins {
+		if !slices.Contains(oldPins, eventID) {
+			client.sendPinInChat(ctx, portal, eventID, true)
+		}
+	}
+	for _, eventID := range oldPins {
+		if !slices.Contains(newPins, eventID) {
+			client.sendPinInChat(ctx, portal, eventID, false)
+		}
+	}
+}
+
+func parsePinnedEvents(content *event.Content) []id.EventID {
+	if content.Parsed == nil {
+		_ = content.ParseRaw(event.StatePinnedEvents)
+	}
+	return content.AsPinnedEvents().Pinned
+}
+
+func (wa *WhatsAppClient) sendPinInChat(ctx context.Context, portal *bridgev2.Portal, eventID id.EventID, pin bool) {
+	log := zerolog.Ctx(ctx).With().Stringer("target_event_id", eventID).Bool("pin", pin).Logger()
+	target, err := wa.Main.Bridge.DB.Message.GetPartByMXID(ctx, eventID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get pinned message from database")
+		return
+	} else if target == nil {
+		log.Debug().Msg("Pinned event isn't a bridged message")
+		return
+	} else if target.Room != portal.PortalKey {
+		// Pinned events can reference any event ID, so don't allow pinning messages from other chats
+		log.Warn().Any("target_portal", target.Room).Msg("Pinned event is in a different portal")
+		return
+	}
+	parsedID, err := waid.ParseMessageID(target.ID)
+	if err != nil {
+		log.Err(err).Msg("Failed to parse pinned message ID")
+		return
+	}
+	waMsg := &waE2E.Message{
+		PinInChatMessage: &waE2E.PinInChatMessage{
+			Key:               wa.messageIDToKey(parsedID),
+			Type:              waE2E.PinInChatMessage_UNPIN_FOR_ALL.Enum(),
+			SenderTimestampMS: proto.Int64(time.Now().UnixMilli()),
+		},
+	}
+	if pin {
+		waMsg.PinInChatMessage.Type = waE2E.PinInChatMessage_PIN_FOR_ALL.Enum()
+		waMsg.MessageContextInfo = &waE2E.MessageContextInfo{
+			MessageAddOnDurationInSecs: proto.Uint32(uint32(DefaultPinDuration.Seconds())),
+		}
+	}
+	resp, err := wa.Client.SendMessage(ctx, parsedID.Chat, waMsg)
+	if err != nil {
+		log.Err(err).Msg("Failed to send pin message to WhatsApp")
+		return
+	}
+	log.Debug().Str("pin_message_id", resp.ID).Msg("Sent pin message to WhatsApp")
+}
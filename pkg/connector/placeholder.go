@@ -0,0 +1,145 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2024 Tulir Asokan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/bridgev2/simplevent"
+	"maunium.net/go/mautrix/event"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+const (
+	// pendingPlaceholderTimeout is how long to wait for the real content of a "waiting for this message" placeholder.
+	pendingPlaceholderTimeout = 6 * time.Hour
+	pendingPlaceholderCheck   = 10 * time.Minute
+)
+
+const ExpiredPlaceholderNotice = "❌ This message never arrived on the bridge. Check WhatsApp on your phone to see it."
+
+type pendingPlaceholder struct {
+	sender  types.JID
+	addedAt time.Time
+}
+
+// addPendingPlaceholder remembers a placeholder that was bridged for an undecryptable message,
+// so that it can be cleaned up if the real message never arrives.
+func (wa *WhatsAppClient) addPendingPlaceholder(portalKey networkid.PortalKey, msgID networkid.MessageID, sender types.JID) {
+	wa.pendingPlaceholdersLock.Lock()
+	defer wa.pendingPlaceholdersLock.Unlock()
+	portalPlaceholders, ok := wa.pendingPlaceholders[portalKey]
+	if !ok {
+		portalPlaceholders = make(map[networkid.MessageID]*pendingPlaceholder)
+		wa.pendingPlaceholders[portalKey] = portalPlaceholders
+	}
+	portalPlaceholders[msgID] = &pendingPlaceholder{sender: sender, addedAt: time.Now()}
+}
+
+// resolvePendingPlaceholder removes a placeholder from the pending list after the real message arrived.
+func (wa *WhatsAppClient) resolvePendingPlaceholder(portalKey networkid.PortalKey, msgID networkid.MessageID) {
+	wa.pendingPlaceholdersLock.Lock()
+	defer wa.pendingPlaceholdersLock.Unlock()
+	delete(wa.pendingPlaceholders[portalKey], msgID)
+	if len(wa.pendingPlaceholders[portalKey]) == 0 {
+		delete(wa.pendingPlaceholders, portalKey)
+	}
+}
+
+func (wa *WhatsAppClient) popExpiredPlaceholders() map[networkid.PortalKey]map[networkid.MessageID]*pendingPlaceholder {
+	wa.pendingPlaceholdersLock.Lock()
+	defer wa.pendingPlaceholdersLock.Unlock()
+	cutoff := time.Now().Add(-pendingPlaceholderTimeout)
+	expired := make(map[networkid.PortalKey]map[networkid.MessageID]*pendingPlaceholder)
+	for portalKey, portalPlaceholders := range wa.pendingPlaceholders {
+		for msgID, placeholder := range portalPlaceholders {
+			if placeholder.addedAt.Before(cutoff) {
+				if expired[portalKey] == nil {
+					expired[portalKey] = make(map[networkid.MessageID]*pendingPlaceholder)
+				}
+				expired[portalKey][msgID] = placeholder
+				delete(portalPlaceholders, msgID)
+			}
+		}
+		if len(portalPlaceholders) == 0 {
+			delete(wa.pendingPlaceholders, portalKey)
+		}
+	}
+	return expired
+}
+
+func (wa *WhatsAppClient) placeholderCleanupLoop(ctx context.Context) {
+	ticker := time.NewTicker(pendingPlaceholderCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			wa.expirePlaceholders()
+		}
+	}
+}
+
+func (wa *WhatsAppClient) expirePlaceholders() {
+	for portalKey, portalPlaceholders := range wa.popExpiredPlaceholders() {
+		for msgID, placeholder := range portalPlaceholders {
+			wa.UserLogin.QueueRemoteEvent(&simplevent.Message[*pendingPlaceholder]{
+				EventMeta: simplevent.EventMeta{
+					Type: bridgev2.RemoteEventEdit,
+					LogContext: func(c zerolog.Context) zerolog.Context {
+						return c.Str("action", "expire placeholder").Str("message_id", string(msgID))
+					},
+					PortalKey: portalKey,
+					Sender:    wa.makeEventSender(placeholder.sender),
+					Timestamp: time.Now(),
+				},
+				Data:            placeholder,
+				TargetMessage:   msgID,
+				ConvertEditFunc: convertExpiredPlaceholder,
+			})
+		}
+	}
+}
+
+func convertExpiredPlaceholder(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, existing []*database.Message, _ *pendingPlaceholder) (*bridgev2.ConvertedEdit, error) {
+	if existing[0].Metadata.(*waid.MessageMetadata).Error != waid.MsgErrDecryptionFailed {
+		return nil, fmt.Errorf("%w: placeholder was already replaced", bridgev2.ErrIgnoringRemoteEvent)
+	}
+	// The error is kept in the metadata, so the placeholder will still be replaced if the message arrives later
+	return &bridgev2.ConvertedEdit{
+		ModifiedParts: []*bridgev2.ConvertedEditPart{{
+			Part: existing[0],
+			Type: event.EventMessage,
+			Content: &event.MessageEventContent{
+				MsgType: event.MsgNotice,
+				Body:    ExpiredPlaceholderNotice,
+			},
+			Extra: map[string]any{
+				"fi.mau.whatsapp.undecryptable": true,
+			},
+		}},
+	}, nil
+}
@@ -0,0 +1,110 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2024 Tulir Asokan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package connector
+
+import (
+	"errors"
+	"strings"
+
+	"go.mau.fi/util/emojirunes"
+	"go.mau.fi/util/variationselector"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/event"
+)
+
+var ErrReactionNotEmoji = bridgev2.WrapErrorInStatus(errors.New("WhatsApp only supports emoji reactions")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+var ErrReactionMultipleEmojis = bridgev2.WrapErrorInStatus(errors.New("WhatsApp reactions can only contain a single emoji")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+
+// textReactions maps text reactions that some Matrix clients send to the equivalent emoji.
+// Other non-emoji reactions (including custom mxc:// emojis) are rejected.
+var textReactions = map[string]string{
+	"+1":      "👍",
+	"-1":      "👎",
+	":+1:":    "👍",
+	":-1:":    "👎",
+	"<3":      "❤",
+	":heart:": "❤",
+	":)":      "🙂",
+	":(":      "🙁",
+	":D":      "😃",
+	":P":      "😛",
+	";)":      "😉",
+	":O":      "😮",
+}
+
+const (
+	zeroWidthJoiner     = '\u200d'
+	variationSelector16 = '\ufe0f'
+	keycapCombiner      = '\u20e3'
+)
+
+func isSkinToneModifier(r rune) bool {
+	return r >= 0x1f3fb && r <= 0x1f3ff
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+func isEmojiTag(r rune) bool {
+	return r >= 0xe0020 && r <= 0xe007f
+}
+
+// countEmojis counts the number of separate emojis in a string that only contains emoji runes.
+// Skin tone modifiers, zero-width joiner sequences, keycaps, flags and tag sequences are counted
+// as a part of the preceding emoji.
+func countEmojis(val string) int {
+	count := 0
+	joinNext := false
+	prevRegionalIndicator := false
+	for _, r := range val {
+		switch {
+		case r == zeroWidthJoiner:
+			joinNext = true
+			continue
+		case r == variationSelector16, r == keycapCombiner, isSkinToneModifier(r), isEmojiTag(r):
+			continue
+		case isRegionalIndicator(r):
+			if prevRegionalIndicator {
+				prevRegionalIndicator = false
+				continue
+			}
+			prevRegionalIndicator = true
+		default:
+			prevRegionalIndicator = false
+		}
+		if !joinNext {
+			count++
+		}
+		joinNext = false
+	}
+	return count
+}
+
+// normalizeReactionEmoji converts a Matrix reaction key into the form WhatsApp expects.
+// Variation selectors are removed, as WhatsApp clients don't include them in reactions.
+func normalizeReactionEmoji(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if mapped, ok := textReactions[key]; ok {
+		return mapped, nil
+	} else if !emojirunes.IsOnlyEmojis(strings.ReplaceAll(key, string(keycapCombiner), "")) {
+		return "", ErrReactionNotEmoji
+	} else if countEmojis(key) != 1 {
+		return "", ErrReactionMultipleEmojis
+	}
+	return variationselector.Remove(key), nil
+}
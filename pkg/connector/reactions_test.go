@@ -0,0 +1,76 @@
+package connector
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCountEmojis(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect int
+	}{
+		{"Single", "👍", 1},
+		{"WithVariationSelector", "❤️", 1},
+		{"SkinTone", "👍🏽", 1},
+		{"ZWJFamily", "👨‍👩‍👧‍👦", 1},
+		{"ZWJWithSkinTones", "🧑🏻‍🤝‍🧑🏿", 1},
+		{"ZWJProfession", "👩‍🚀", 1},
+		{"Flag", "🇫🇮", 1},
+		{"TwoFlags", "🇫🇮🇺🇸", 2},
+		{"Keycap", "1️⃣", 1},
+		{"KeycapWithoutVariationSelector", "#⃣", 1},
+		{"TagSequence", "🏴󠁧󠁢󠁳󠁣󠁴󠁿", 1},
+		{"Two", "👍👎", 2},
+		{"TwoWithSkinTones", "👍🏻👎🏿", 2},
+		{"FlagAndEmoji", "🇫🇮👍", 2},
+		{"Empty", "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := countEmojis(test.input); got != test.expect {
+				t.Errorf("countEmojis(%q) = %d, expected %d", test.input, got, test.expect)
+			}
+		})
+	}
+}
+
+func TestNormalizeReactionEmoji(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expect    string
+		expectErr error
+	}{
+		{"Plain", "👍", "👍", nil},
+		{"StripsVariationSelector", "❤️", "❤", nil},
+		{"TrimsSpace", " 👍 ", "👍", nil},
+		{"SkinTone", "👍🏽", "👍🏽", nil},
+		{"ZWJ", "👨‍👩‍👧‍👦", "👨‍👩‍👧‍👦", nil},
+		{"Flag", "🇫🇮", "🇫🇮", nil},
+		{"Keycap", "1️⃣", "1⃣", nil},
+		{"TagSequence", "🏴󠁧󠁢󠁳󠁣󠁴󠁿", "🏴󠁧󠁢󠁳󠁣󠁴󠁿", nil},
+		{"TextThumbsUp", "+1", "👍", nil},
+		{"TextHeart", "<3", "❤", nil},
+		{"Text", "lol", "", ErrReactionNotEmoji},
+		{"CustomEmoji", "mxc://example.com/abc", "", ErrReactionNotEmoji},
+		{"EmojiWithText", "👍 nice", "", ErrReactionNotEmoji},
+		{"TwoEmojis", "👍👎", "", ErrReactionMultipleEmojis},
+		{"TwoFlags", "🇫🇮🇺🇸", "", ErrReactionMultipleEmojis},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := normalizeReactionEmoji(test.input)
+			if test.expectErr != nil {
+				if !errors.Is(err, errors.Unwrap(test.expectErr)) {
+					t.Errorf("normalizeReactionEmoji(%q) returned error %v, expected %v", test.input, err, test.expectErr)
+				}
+			} else if err != nil {
+				t.Errorf("normalizeReactionEmoji(%q) returned unexpected error %v", test.input, err)
+			} else if got != test.expect {
+				t.Errorf("normalizeReactionEmoji(%q) = %q, expected %q", test.input, got, test.expect)
+			}
+		})
+	}
+}
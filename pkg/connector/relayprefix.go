@@ -0,0 +1,54 @@
+package connector
+
+import (
+	"cmp"
+	"fmt"
+
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+// applyRelayPrefix replaces the bridge-wide relay formatting of messages from relayed Matrix users with
+// relay_prefix_template if relay_mode is enabled in the config. Messages from the login owner are never prefixed.
+// The returned content is a copy, the original event content is never modified.
+func (wa *WhatsAppClient) applyRelayPrefix(
+	evt *event.Event,
+	origSender *bridgev2.OrigSender,
+	content *event.MessageEventContent,
+) (*event.MessageEventContent, error) {
+	if !wa.Main.Config.RelayMode || origSender == nil {
+		return content, nil
+	}
+	// bridgev2 has already applied the bridge-wide relay format to content, so start over from the original event
+	original, ok := evt.Content.Parsed.(*event.MessageEventContent)
+	if !ok {
+		return content, nil
+	} else if original.NewContent != nil {
+		original = original.NewContent
+	}
+	switch content.MsgType {
+	case event.MsgText, event.MsgNotice, event.MsgEmote:
+	case event.MsgImage, event.MsgVideo, event.MsgAudio, event.MsgFile:
+		if original.FileName == "" || original.FileName == original.Body {
+			// Media without a caption can't have a prefix
+			return content, nil
+		}
+	default:
+		return content, nil
+	}
+	prefix, err := wa.Main.Config.FormatRelayPrefix(&RelayPrefixParams{
+		DisplayName: cmp.Or(origSender.Displayname, origSender.UserID.String()),
+		UserID:      origSender.UserID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to format relay prefix: %w", err)
+	}
+	contentCopy := *original
+	contentCopy.MsgType = content.MsgType
+	contentCopy.NewContent = nil
+	contentCopy.EnsureHasHTML()
+	contentCopy.FormattedBody = prefix + contentCopy.FormattedBody
+	contentCopy.Body = format.HTMLToText(contentCopy.FormattedBody)
+	return &contentCopy, nil
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"math/rand/v2"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog"
 	"go.mau.fi/util/exzerolog"
@@ -21,6 +23,7 @@ import (
 )
 
 const resyncMinInterval = 7 * 24 * time.Hour
+const newsletterResyncMinInterval = 24 * time.Hour
 const resyncLoopInterval = 4 * time.Hour
 
 func (wa *WhatsAppClient) EnqueueGhostResync(ghost *bridgev2.Ghost) {
@@ -41,7 +44,7 @@ func (wa *WhatsAppClient) EnqueueGhostResync(ghost *bridgev2.Ghost) {
 
 func (wa *WhatsAppClient) EnqueuePortalResync(portal *bridgev2.Portal) {
 	jid, _ := waid.ParsePortalID(portal.ID)
-	if jid.Server != types.GroupServer || portal.Metadata.(*waid.PortalMetadata).LastSync.Add(resyncMinInterval).After(time.Now()) {
+	if portal.Metadata.(*waid.PortalMetadata).LastSync.Add(portalResyncMinInterval(jid)).After(time.Now()) {
 		return
 	}
 	wa.resyncQueueLock.Lock()
@@ -55,6 +58,18 @@ func (wa *WhatsAppClient) EnqueuePortalResync(portal *bridgev2.Portal) {
 	wa.resyncQueueLock.Unlock()
 }
 
+func portalResyncMinInterval(jid types.JID) time.Duration {
+	switch jid.Server {
+	case types.GroupServer:
+		return resyncMinInterval
+	case types.NewsletterServer:
+		// Newsletters are resynced more often to keep the subscriber count up to date
+		return newsletterResyncMinInterval
+	default:
+		return 100 * 365 * 24 * time.Hour
+	}
+}
+
 func (wa *WhatsAppClient) ghostResyncLoop(ctx context.Context) {
 	log := wa.UserLogin.Log.With().Str("action", "ghost resync loop").Logger()
 	ctx = log.WithContext(ctx)
@@ -103,12 +118,14 @@ func (wa *WhatsAppClient) doGhostResync(ctx context.Context, queue map[types.JID
 	var portals []*bridgev2.Portal
 	for jid, item := range queue {
 		var lastSync time.Time
+		minInterval := resyncMinInterval
 		if item.ghost != nil {
 			lastSync = item.ghost.Metadata.(*waid.GhostMetadata).LastSync.Time
 		} else if item.portal != nil {
 			lastSync = item.portal.Metadata.(*waid.PortalMetadata).LastSync.Time
+			minInterval = portalResyncMinInterval(jid)
 		}
-		if lastSync.Add(resyncMinInterval).After(time.Now()) {
+		if lastSync.Add(minInterval).After(time.Now()) {
 			log.Debug().
 				Stringer("jid", jid).
 				Time("last_sync", lastSync).
@@ -150,11 +167,17 @@ func (wa *WhatsAppClient) doGhostResync(ctx context.Context, queue map[types.JID
 			log.Warn().Stringer("jid", jid).Msg("Didn't get info for puppet in background sync")
 			continue
 		}
-		userInfo, err := wa.getUserInfo(ctx, jid, info.PictureID != "" && string(ghost.AvatarID) != info.PictureID)
+		var verifiedName string
+		if info.VerifiedName != nil {
+			verifiedName = info.VerifiedName.Details.GetVerifiedName()
+		}
+		userInfo, err := wa.getUserInfo(ctx, jid, verifiedName, info.PictureID != "" && string(ghost.AvatarID) != info.PictureID)
 		if err != nil {
 			log.Err(err).Stringer("jid", jid).Msg("Failed to get user info for puppet in background sync")
 			continue
 		}
+		applyGhostAbout(userInfo, info.Status)
+		applyGhostVerifiedName(userInfo, verifiedName)
 		ghost.UpdateInfo(ctx, userInfo)
 	}
 }
@@ -162,29 +185,122 @@ func (wa *WhatsAppClient) doGhostResync(ctx context.Context, queue map[types.JID
 func (wa *WhatsAppClient) GetUserInfo(ctx context.Context, ghost *bridgev2.Ghost) (*bridgev2.UserInfo, error) {
 	if ghost.Name != "" {
 		wa.EnqueueGhostResync(ghost)
+		wa.refreshGhostIfExpired(ghost)
 		return nil, nil
 	}
 	jid := waid.ParseUserID(ghost.ID)
-	return wa.getUserInfo(ctx, jid, ghost.AvatarID == "")
+	return wa.getUserInfo(ctx, jid, ghostVerifiedName(ghost), ghost.AvatarID == "")
 }
 
-func (wa *WhatsAppClient) getUserInfo(ctx context.Context, jid types.JID, fetchAvatar bool) (*bridgev2.UserInfo, error) {
+func (wa *WhatsAppClient) getUserInfo(ctx context.Context, jid types.JID, verifiedName string, fetchAvatar bool) (*bridgev2.UserInfo, error) {
 	contact, err := wa.GetStore().Contacts.GetContact(jid)
 	if err != nil {
 		return nil, err
 	}
-	return wa.contactToUserInfo(jid, contact, fetchAvatar), nil
+	return wa.contactToUserInfo(jid, contact, verifiedName, fetchAvatar), nil
 }
 
-func (wa *WhatsAppClient) contactToUserInfo(jid types.JID, contact types.ContactInfo, getAvatar bool) *bridgev2.UserInfo {
+type ghostCacheEntry struct {
+	name       string
+	expiresAt  time.Time
+	refreshing atomic.Bool
+}
+
+func (wa *WhatsAppClient) cacheGhostName(jid types.JID, name string) {
+	ttl := time.Duration(wa.Main.Config.GhostCacheTTL) * time.Second
+	if ttl <= 0 {
+		return
+	}
+	wa.ghostCache.Store(jid, &ghostCacheEntry{name: name, expiresAt: time.Now().Add(ttl)})
+}
+
+// cacheUpdatedGhostName is an extra updater that caches the final name of the ghost after
+// all other changes (like the about text) have been applied to it.
+func (wa *WhatsAppClient) cacheUpdatedGhostName(_ context.Context, ghost *bridgev2.Ghost) bool {
+	wa.cacheGhostName(waid.ParseUserID(ghost.ID), ghost.Name)
+	return false
+}
+
+// refreshGhostIfExpired refreshes the display name and avatar of the given ghost in the background
+// if its cache entry has expired. Ghosts that haven't been seen since startup are assumed to be fresh.
+func (wa *WhatsAppClient) refreshGhostIfExpired(ghost *bridgev2.Ghost) {
+	if wa.Main.Config.GhostCacheTTL <= 0 {
+		return
+	}
+	jid := waid.ParseUserID(ghost.ID)
+	val, ok := wa.ghostCache.Load(jid)
+	if !ok {
+		wa.cacheGhostName(jid, ghost.Name)
+		return
+	}
+	entry := val.(*ghostCacheEntry)
+	if time.Now().Before(entry.expiresAt) || !entry.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		log := wa.UserLogin.Log.With().
+			Str("action", "refresh ghost").
+			Stringer("jid", jid).
+			Logger()
+		ctx := log.WithContext(context.Background())
+		contact, err := wa.GetStore().Contacts.GetContact(jid)
+		if err != nil {
+			log.Err(err).Msg("Failed to get contact info to refresh ghost")
+			entry.refreshing.Store(false)
+			return
+		}
+		userInfo := wa.contactToUserInfo(jid, contact, ghostVerifiedName(ghost), true)
+		applyGhostAbout(userInfo, ghost.Metadata.(*waid.GhostMetadata).About)
+		if *userInfo.Name != entry.name {
+			log.Debug().Str("old_name", entry.name).Str("new_name", *userInfo.Name).Msg("Ghost name changed, updating")
+		}
+		ghost.UpdateInfo(ctx, userInfo)
+	}()
+}
+
+// contactDisplayName returns the best available plain name for a contact, falling back to the phone number.
+func contactDisplayName(jid types.JID, contact types.ContactInfo) string {
+	switch {
+	case contact.FullName != "":
+		return contact.FullName
+	case contact.BusinessName != "":
+		return contact.BusinessName
+	case contact.PushName != "":
+		return contact.PushName
+	default:
+		return "+" + jid.User
+	}
+}
+
+func (wa *WhatsAppClient) getContactName(jid types.JID) string {
+	contact, err := wa.GetStore().Contacts.GetContact(jid)
+	if err != nil {
+		wa.UserLogin.Log.Warn().Err(err).Stringer("jid", jid).Msg("Failed to get contact info")
+	}
+	return contactDisplayName(jid, contact)
+}
+
+// getPublicContactName returns a name for the given user that's safe to show in shared portal rooms.
+// Unlike getContactName, it never uses names from the user's own address book.
+func (wa *WhatsAppClient) getPublicContactName(jid types.JID) string {
+	contact, err := wa.GetStore().Contacts.GetContact(jid)
+	if err != nil {
+		wa.UserLogin.Log.Warn().Err(err).Stringer("jid", jid).Msg("Failed to get contact info")
+	}
+	contact.FirstName = ""
+	contact.FullName = ""
+	return contactDisplayName(jid, contact)
+}
+
+func (wa *WhatsAppClient) contactToUserInfo(jid types.JID, contact types.ContactInfo, verifiedName string, getAvatar bool) *bridgev2.UserInfo {
 	if jid == types.MetaAIJID && contact.PushName == jid.User {
 		contact.PushName = "Meta AI"
 	}
 	ui := &bridgev2.UserInfo{
-		Name:         ptr.Ptr(wa.Main.Config.FormatDisplayname(jid, contact)),
+		Name:         ptr.Ptr(wa.Main.Config.FormatDisplayname(jid, contact, verifiedName)),
 		IsBot:        ptr.Ptr(jid.IsBot()),
 		Identifiers:  []string{fmt.Sprintf("tel:+%s", jid.User)},
-		ExtraUpdates: updateGhostLastSyncAt,
+		ExtraUpdates: bridgev2.MergeExtraUpdaters(updateGhostLastSyncAt, wa.cacheUpdatedGhostName),
 	}
 	if getAvatar {
 		ui.ExtraUpdates = bridgev2.MergeExtraUpdaters(ui.ExtraUpdates, wa.fetchGhostAvatar)
@@ -192,6 +308,64 @@ func (wa *WhatsAppClient) contactToUserInfo(jid types.JID, contact types.Contact
 	return ui
 }
 
+// applyGhostAbout adds the given about text to the user info. bridgev2 doesn't have
+// custom profile fields, so the about text is appended to the displayname, truncated
+// so that the whole name stays within maxDisplaynameLength.
+func applyGhostAbout(ui *bridgev2.UserInfo, about string) {
+	if ui.Name != nil && about != "" {
+		const prefix, suffix, ellipsis = " (About: ", ")", "…"
+		space := maxDisplaynameLength - len(*ui.Name) - len(prefix) - len(suffix)
+		if len(about) > space {
+			about = truncateUTF8(about, space-len(ellipsis)) + ellipsis
+		}
+		if space > len(ellipsis) {
+			ui.Name = ptr.Ptr(*ui.Name + prefix + about + suffix)
+		}
+	}
+	ui.ExtraUpdates = bridgev2.MergeExtraUpdaters(ui.ExtraUpdates, func(_ context.Context, ghost *bridgev2.Ghost) bool {
+		meta := ghost.Metadata.(*waid.GhostMetadata)
+		if meta.About == about {
+			return false
+		}
+		meta.About = about
+		return true
+	})
+}
+
+// truncateUTF8 cuts the string to at most maxBytes bytes without splitting multibyte characters.
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	} else if maxBytes <= 0 {
+		return ""
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
+
+// ghostVerifiedName returns the verified business name stored for the given ghost, if any.
+func ghostVerifiedName(ghost *bridgev2.Ghost) string {
+	if ghost == nil {
+		return ""
+	}
+	return ghost.Metadata.(*waid.GhostMetadata).VerifiedName
+}
+
+// applyGhostVerifiedName stores the verified business name in the ghost metadata,
+// so that it's available for the displayname template without fetching the user info again.
+func applyGhostVerifiedName(ui *bridgev2.UserInfo, verifiedName string) {
+	ui.ExtraUpdates = bridgev2.MergeExtraUpdaters(ui.ExtraUpdates, func(_ context.Context, ghost *bridgev2.Ghost) bool {
+		meta := ghost.Metadata.(*waid.GhostMetadata)
+		if meta.VerifiedName == verifiedName {
+			return false
+		}
+		meta.VerifiedName = verifiedName
+		return true
+	})
+}
+
 func updateGhostLastSyncAt(_ context.Context, ghost *bridgev2.Ghost) bool {
 	meta := ghost.Metadata.(*waid.GhostMetadata)
 	forceSave := time.Since(meta.LastSync.Time) > 24*time.Hour
@@ -206,8 +380,11 @@ func (wa *WhatsAppClient) fetchGhostAvatar(ctx context.Context, ghost *bridgev2.
 		existingID = ""
 	}
 	var wrappedAvatar *bridgev2.Avatar
-	avatar, err := wa.Client.GetProfilePictureInfo(jid, &whatsmeow.GetProfilePictureParams{ExistingID: existingID})
-	if errors.Is(err, whatsmeow.ErrProfilePictureNotSet) {
+	avatar, err := wa.getProfilePictureInfo(ctx, jid, &whatsmeow.GetProfilePictureParams{ExistingID: existingID})
+	if errors.Is(err, errProfilePictureRateLimited) {
+		wa.deferAvatar(jid, true)
+		return false
+	} else if errors.Is(err, whatsmeow.ErrProfilePictureNotSet) {
 		wrappedAvatar = &bridgev2.Avatar{
 			ID:     "remove",
 			Remove: true,
@@ -247,7 +424,9 @@ func (wa *WhatsAppClient) resyncContacts(forceAvatarSync bool) {
 		if err != nil {
 			log.Err(err).Msg("Failed to get ghost")
 		} else if ghost != nil {
-			ghost.UpdateInfo(ctx, wa.contactToUserInfo(jid, contact, forceAvatarSync || ghost.AvatarID == ""))
+			userInfo := wa.contactToUserInfo(jid, contact, ghostVerifiedName(ghost), forceAvatarSync || ghost.AvatarID == "")
+			applyGhostAbout(userInfo, ghost.Metadata.(*waid.GhostMetadata).About)
+			ghost.UpdateInfo(ctx, userInfo)
 		}
 	}
 }
@@ -0,0 +1,39 @@
+package connector
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.mau.fi/util/ptr"
+	"maunium.net/go/mautrix/bridgev2"
+)
+
+func TestApplyGhostAbout(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		about  string
+		expect string
+	}{
+		{"Short", "Alice (WA)", "Hey there!", "Alice (WA) (About: Hey there!)"},
+		{"NoAbout", "Alice (WA)", "", "Alice (WA)"},
+		{"LongAbout", "Alice (WA)", strings.Repeat("a", 300), "Alice (WA) (About: " + strings.Repeat("a", 232) + "…)"},
+		{"MultibyteAbout", "Alice (WA)", strings.Repeat("ä", 200), "Alice (WA) (About: " + strings.Repeat("ä", 116) + "…)"},
+		{"NameAtLimit", strings.Repeat("n", maxDisplaynameLength), "Hey there!", strings.Repeat("n", maxDisplaynameLength)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ui := &bridgev2.UserInfo{Name: ptr.Ptr(test.input)}
+			applyGhostAbout(ui, test.about)
+			if *ui.Name != test.expect {
+				t.Errorf("name = %q, expected %q", *ui.Name, test.expect)
+			}
+			if len(*ui.Name) > maxDisplaynameLength {
+				t.Errorf("name is %d bytes long, expected at most %d", len(*ui.Name), maxDisplaynameLength)
+			} else if !utf8.ValidString(*ui.Name) {
+				t.Errorf("name %q isn't valid UTF-8", *ui.Name)
+			}
+		})
+	}
+}
@@ -14,6 +14,8 @@ type Database struct {
 	Message      *MessageQuery
 	PollOption   *PollOptionQuery
 	MediaRequest *MediaRequestQuery
+	Sticker      *StickerQuery
+	GroupInvite  *GroupInviteQuery
 }
 
 func New(bridgeID networkid.BridgeID, db *dbutil.Database, log zerolog.Logger) *Database {
@@ -40,5 +42,15 @@ func New(bridgeID networkid.BridgeID, db *dbutil.Database, log zerolog.Logger) *
 				return &MediaRequest{}
 			}),
 		},
+		GroupInvite: &GroupInviteQuery{
+			BridgeID: bridgeID,
+			Database: db,
+		},
+		Sticker: &StickerQuery{
+			BridgeID: bridgeID,
+			QueryHelper: dbutil.MakeQueryHelper(db, func(_ *dbutil.QueryHelper[*Sticker]) *Sticker {
+				return &Sticker{}
+			}),
+		},
 	}
 }
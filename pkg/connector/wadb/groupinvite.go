@@ -0,0 +1,47 @@
+package wadb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+)
+
+// GroupInviteQuery finds bridged group invite messages using the group JID stored in the message metadata.
+type GroupInviteQuery struct {
+	BridgeID networkid.BridgeID
+	*dbutil.Database
+}
+
+// The JSON expressions must match whatsapp_message_group_invite_jid_idx for the index to be used.
+const (
+	getLatestGroupInvitePostgresQuery = `
+		SELECT id, part_id FROM message
+		WHERE bridge_id=$1 AND room_receiver=$2 AND (metadata->'group_invite'->>'jid')=$3 AND metadata->'group_invite' IS NOT NULL
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`
+	getLatestGroupInviteSQLiteQuery = `
+		SELECT id, part_id FROM message
+		WHERE bridge_id=$1 AND room_receiver=$2 AND json_extract(metadata, '$.group_invite.jid')=$3 AND json_extract(metadata, '$.group_invite') IS NOT NULL
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`
+)
+
+// GetLatest returns the ID and part ID of the most recent invite message to the given group.
+// The returned message ID is empty if there are no invites.
+func (giq *GroupInviteQuery) GetLatest(ctx context.Context, receiver networkid.UserLoginID, groupJID types.JID) (msgID networkid.MessageID, partID networkid.PartID, err error) {
+	query := getLatestGroupInviteSQLiteQuery
+	if giq.Dialect == dbutil.Postgres {
+		query = getLatestGroupInvitePostgresQuery
+	}
+	err = giq.QueryRow(ctx, query, giq.BridgeID, receiver, groupJID.String()).Scan(&msgID, &partID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return
+}
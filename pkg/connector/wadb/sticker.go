@@ -0,0 +1,155 @@
+package wadb
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"google.golang.org/protobuf/proto"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+)
+
+type StickerQuery struct {
+	BridgeID networkid.BridgeID
+	*dbutil.QueryHelper[*Sticker]
+}
+
+type Sticker struct {
+	BridgeID      networkid.BridgeID
+	UserLoginID   networkid.UserLoginID
+	FileSHA256    []byte
+	URL           string
+	DirectPath    string
+	MediaKey      []byte
+	FileEncSHA256 []byte
+	MimeType      string
+	Width         uint32
+	Height        uint32
+	FileLength    uint64
+	IsLottie      bool
+	LastSent      time.Time
+}
+
+func NewSticker(loginID networkid.UserLoginID, meta *waHistorySync.StickerMetadata) *Sticker {
+	return &Sticker{
+		UserLoginID:   loginID,
+		FileSHA256:    meta.GetFileSHA256(),
+		URL:           meta.GetURL(),
+		DirectPath:    meta.GetDirectPath(),
+		MediaKey:      meta.GetMediaKey(),
+		FileEncSHA256: meta.GetFileEncSHA256(),
+		MimeType:      meta.GetMimetype(),
+		Width:         meta.GetWidth(),
+		Height:        meta.GetHeight(),
+		FileLength:    meta.GetFileLength(),
+		IsLottie:      meta.GetIsLottie(),
+		LastSent:      time.UnixMilli(meta.GetLastStickerSentTS()),
+	}
+}
+
+// ToMessage builds a WhatsApp sticker message that reuses the already uploaded sticker file.
+func (s *Sticker) ToMessage() *waE2E.Message {
+	return &waE2E.Message{
+		StickerMessage: &waE2E.StickerMessage{
+			URL:           proto.String(s.URL),
+			DirectPath:    proto.String(s.DirectPath),
+			MediaKey:      s.MediaKey,
+			FileSHA256:    s.FileSHA256,
+			FileEncSHA256: s.FileEncSHA256,
+			Mimetype:      proto.String(s.MimeType),
+			Width:         proto.Uint32(s.Width),
+			Height:        proto.Uint32(s.Height),
+			FileLength:    proto.Uint64(s.FileLength),
+			IsLottie:      proto.Bool(s.IsLottie),
+		},
+	}
+}
+
+const (
+	upsertRecentStickerQuery = `
+		INSERT INTO whatsapp_recent_sticker (
+			bridge_id, user_login_id, file_sha256, url, direct_path, media_key, file_enc_sha256,
+			mimetype, width, height, file_length, is_lottie, last_sent
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (bridge_id, user_login_id, file_sha256)
+		DO UPDATE SET
+			url=excluded.url,
+			direct_path=excluded.direct_path,
+			media_key=excluded.media_key,
+			file_enc_sha256=excluded.file_enc_sha256,
+			last_sent=CASE
+				WHEN excluded.last_sent > whatsapp_recent_sticker.last_sent THEN excluded.last_sent
+				ELSE whatsapp_recent_sticker.last_sent
+			END
+	`
+	getRecentStickersQuery = `
+		SELECT
+			bridge_id, user_login_id, file_sha256, url, direct_path, media_key, file_enc_sha256,
+			mimetype, width, height, file_length, is_lottie, last_sent
+		FROM whatsapp_recent_sticker
+		WHERE bridge_id=$1 AND user_login_id=$2
+		ORDER BY last_sent DESC, file_sha256
+		LIMIT $3 OFFSET $4
+	`
+	countRecentStickersQuery = "SELECT COUNT(*) FROM whatsapp_recent_sticker WHERE bridge_id=$1 AND user_login_id=$2"
+)
+
+func (sq *StickerQuery) Put(ctx context.Context, sticker *Sticker) error {
+	sticker.BridgeID = sq.BridgeID
+	return sq.Exec(ctx, upsertRecentStickerQuery, sticker.sqlVariables()...)
+}
+
+func (sq *StickerQuery) GetRecent(ctx context.Context, loginID networkid.UserLoginID, limit, offset int) ([]*Sticker, error) {
+	return sq.QueryMany(ctx, getRecentStickersQuery, sq.BridgeID, loginID, limit, offset)
+}
+
+func (sq *StickerQuery) Count(ctx context.Context, loginID networkid.UserLoginID) (count int, err error) {
+	err = sq.GetDB().QueryRow(ctx, countRecentStickersQuery, sq.BridgeID, loginID).Scan(&count)
+	return
+}
+
+func (s *Sticker) sqlVariables() []any {
+	return []any{
+		s.BridgeID,
+		s.UserLoginID,
+		s.FileSHA256,
+		s.URL,
+		s.DirectPath,
+		s.MediaKey,
+		s.FileEncSHA256,
+		s.MimeType,
+		s.Width,
+		s.Height,
+		int64(s.FileLength),
+		s.IsLottie,
+		s.LastSent.UnixMilli(),
+	}
+}
+
+func (s *Sticker) Scan(row dbutil.Scannable) (*Sticker, error) {
+	var fileLength, lastSent int64
+	err := row.Scan(
+		&s.BridgeID,
+		&s.UserLoginID,
+		&s.FileSHA256,
+		&s.URL,
+		&s.DirectPath,
+		&s.MediaKey,
+		&s.FileEncSHA256,
+		&s.MimeType,
+		&s.Width,
+		&s.Height,
+		&fileLength,
+		&s.IsLottie,
+		&lastSent,
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.FileLength = uint64(fileLength)
+	s.LastSent = time.UnixMilli(lastSent)
+	return s, nil
+}
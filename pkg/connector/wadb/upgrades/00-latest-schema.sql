@@ -1,4 +1,4 @@
--- v0 -> v4 (compatible with v3+): Latest revision
+-- v0 -> v6 (compatible with v3+): Latest revision
 
 CREATE TABLE whatsapp_poll_option_id (
     bridge_id TEXT  NOT NULL,
@@ -74,3 +74,29 @@ CREATE TABLE whatsapp_media_backfill_request (
 );
 CREATE INDEX whatsapp_media_backfill_request_portal_idx ON whatsapp_media_backfill_request (bridge_id, portal_id, portal_receiver);
 CREATE INDEX whatsapp_media_backfill_request_message_idx ON whatsapp_media_backfill_request (bridge_id, portal_receiver, message_id, _part_id);
+
+CREATE TABLE whatsapp_recent_sticker (
+    bridge_id       TEXT    NOT NULL,
+    user_login_id   TEXT    NOT NULL,
+    file_sha256     bytea   NOT NULL,
+
+    url             TEXT    NOT NULL,
+    direct_path     TEXT    NOT NULL,
+    media_key       bytea   NOT NULL,
+    file_enc_sha256 bytea   NOT NULL,
+    mimetype        TEXT    NOT NULL,
+    width           INTEGER NOT NULL,
+    height          INTEGER NOT NULL,
+    file_length     BIGINT  NOT NULL,
+    is_lottie       BOOLEAN NOT NULL,
+    last_sent       BIGINT  NOT NULL,
+
+    PRIMARY KEY (bridge_id, user_login_id, file_sha256),
+    CONSTRAINT whatsapp_recent_sticker_user_login_fkey FOREIGN KEY (bridge_id, user_login_id)
+        REFERENCES user_login (bridge_id, id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+-- only: postgres
+CREATE INDEX whatsapp_message_group_invite_jid_idx ON message (bridge_id, room_receiver, (metadata->'group_invite'->>'jid')) WHERE metadata->'group_invite' IS NOT NULL;
+-- only: sqlite
+CREATE INDEX whatsapp_message_group_invite_jid_idx ON message (bridge_id, room_receiver, json_extract(metadata, '$.group_invite.jid')) WHERE json_extract(metadata, '$.group_invite') IS NOT NULL;
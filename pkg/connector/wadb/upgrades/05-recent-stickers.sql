@@ -0,0 +1,21 @@
+-- v5 (compatible with v3+): Add table for recent stickers from history syncs
+CREATE TABLE whatsapp_recent_sticker (
+    bridge_id       TEXT    NOT NULL,
+    user_login_id   TEXT    NOT NULL,
+    file_sha256     bytea   NOT NULL,
+
+    url             TEXT    NOT NULL,
+    direct_path     TEXT    NOT NULL,
+    media_key       bytea   NOT NULL,
+    file_enc_sha256 bytea   NOT NULL,
+    mimetype        TEXT    NOT NULL,
+    width           INTEGER NOT NULL,
+    height          INTEGER NOT NULL,
+    file_length     BIGINT  NOT NULL,
+    is_lottie       BOOLEAN NOT NULL,
+    last_sent       BIGINT  NOT NULL,
+
+    PRIMARY KEY (bridge_id, user_login_id, file_sha256),
+    CONSTRAINT whatsapp_recent_sticker_user_login_fkey FOREIGN KEY (bridge_id, user_login_id)
+        REFERENCES user_login (bridge_id, id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+-- v6 (compatible with v3+): Add index for looking up group invite messages by group JID
+-- only: postgres
+CREATE INDEX whatsapp_message_group_invite_jid_idx ON message (bridge_id, room_receiver, (metadata->'group_invite'->>'jid')) WHERE metadata->'group_invite' IS NOT NULL;
+-- only: sqlite
+CREATE INDEX whatsapp_message_group_invite_jid_idx ON message (bridge_id, room_receiver, json_extract(metadata, '$.group_invite.jid')) WHERE json_extract(metadata, '$.group_invite') IS NOT NULL;
@@ -0,0 +1,73 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2024 Tulir Asokan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package msgconv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"go.mau.fi/util/ffmpeg"
+)
+
+const (
+	waveformSampleRate = 8000
+	waveformLength     = 64
+)
+
+// convertAudioToOpus re-encodes the given audio file as an OGG Opus voice message.
+func (mc *MessageConverter) convertAudioToOpus(ctx context.Context, data []byte, mime string) ([]byte, error) {
+	return ffmpeg.ConvertBytes(ctx, data, ".ogg", nil, []string{
+		"-vn", "-c:a", "libopus", "-b:a", "32k", "-ac", "1", "-ar", "48000",
+	}, mime)
+}
+
+// generateWaveform decodes the audio with ffmpeg and samples the peak amplitude of
+// waveformLength evenly sized chunks. The returned values are in the range 0-255.
+// The duration of the audio in milliseconds is returned as well.
+func (mc *MessageConverter) generateWaveform(ctx context.Context, data []byte, mime string) ([]int, int, error) {
+	pcm, err := ffmpeg.ConvertBytes(ctx, data, ".pcm", nil, []string{
+		"-vn", "-ac", "1", "-ar", fmt.Sprint(waveformSampleRate), "-f", "s16le", "-c:a", "pcm_s16le",
+	}, mime)
+	if err != nil {
+		return nil, 0, err
+	}
+	sampleCount := len(pcm) / 2
+	if sampleCount == 0 {
+		return nil, 0, fmt.Errorf("audio doesn't contain any samples")
+	}
+	peaks := make([]int, waveformLength)
+	maxPeak := 1
+	for i := range peaks {
+		start := i * sampleCount / waveformLength
+		end := max((i+1)*sampleCount/waveformLength, start+1)
+		peak := 0
+		for j := start; j < end && j < sampleCount; j++ {
+			sample := int(int16(binary.LittleEndian.Uint16(pcm[j*2:])))
+			if sample < 0 {
+				sample = -sample
+			}
+			peak = max(peak, sample)
+		}
+		peaks[i] = peak
+		maxPeak = max(maxPeak, peak)
+	}
+	for i, peak := range peaks {
+		peaks[i] = peak * 255 / maxPeak
+	}
+	return peaks, sampleCount * 1000 / waveformSampleRate, nil
+}
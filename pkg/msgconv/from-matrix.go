@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/jpeg"
 	"image/png"
 	"net/http"
 	"slices"
@@ -36,6 +37,8 @@ import (
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
 	"golang.org/x/image/webp"
 	"google.golang.org/protobuf/proto"
 	"maunium.net/go/mautrix/bridgev2"
@@ -151,12 +154,17 @@ func (mc *MessageConverter) constructMediaMessage(
 		}
 	case event.MsgAudio:
 		waveform, seconds := getAudioInfo(content)
+		// Only voice messages are sent as push-to-talk, other audio files are sent as regular audio attachments
+		isVoice := content.MSC3245Voice != nil && mime == "audio/ogg; codecs=opus"
+		if !isVoice {
+			waveform = nil
+		}
 
 		return &waE2E.Message{
 			AudioMessage: &waE2E.AudioMessage{
 				Seconds:  &seconds,
 				Waveform: waveform,
-				PTT:      proto.Bool(content.MSC3245Voice != nil),
+				PTT:      proto.Bool(isVoice),
 
 				URL:           proto.String(uploaded.URL),
 				DirectPath:    proto.String(uploaded.DirectPath),
@@ -377,6 +385,21 @@ func (mc *MessageConverter) convertToWebP(img []byte) ([]byte, int, error) {
 	return webpBuffer.Bytes(), size, nil
 }
 
+// convertToJPEG re-encodes images in formats that WhatsApp doesn't accept (e.g. bmp or tiff) as JPEG.
+func (mc *MessageConverter) convertToJPEG(img []byte) ([]byte, error) {
+	decodedImg, _, err := image.Decode(bytes.NewReader(img))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	var jpegBuffer bytes.Buffer
+	if err = jpeg.Encode(&jpegBuffer, decodedImg, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg image: %w", err)
+	}
+	return jpegBuffer.Bytes(), nil
+}
+
+var ErrMediaTooLarge = bridgev2.WrapErrorInStatus(errors.New("file is too large")).WithErrorAsMessage().WithIsCertain(true).WithSendNotice(true).WithErrorReason(event.MessageStatusUnsupported)
+
 func (mc *MessageConverter) reuploadFileToWhatsApp(
 	ctx context.Context, content *event.MessageEventContent,
 ) (*whatsmeow.UploadResponse, []byte, string, error) {
@@ -385,12 +408,17 @@ func (mc *MessageConverter) reuploadFileToWhatsApp(
 	if content.FileName != "" {
 		fileName = content.FileName
 	}
+	if mc.MaxFileSize > 0 && int64(content.GetInfo().Size) > mc.MaxFileSize {
+		return nil, nil, mime, ErrMediaTooLarge
+	}
 	data, err := mc.Bridge.Bot.DownloadMedia(ctx, content.URL, content.File)
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("%w: %w", bridgev2.ErrMediaDownloadFailed, err)
+	} else if mc.MaxFileSize > 0 && int64(len(data)) > mc.MaxFileSize {
+		return nil, nil, mime, ErrMediaTooLarge
 	}
 
-	if mime == "" {
+	if mime == "" || (mime == "application/octet-stream" && content.MsgType == event.MsgFile) {
 		mime = http.DetectContentType(data)
 	}
 	if mime == "image/gif" {
@@ -425,7 +453,11 @@ func (mc *MessageConverter) reuploadFileToWhatsApp(
 			}
 			mime = "image/png"
 		default:
-			return nil, nil, mime, fmt.Errorf("%w %s in image message", bridgev2.ErrUnsupportedMediaType, mime)
+			data, err = mc.convertToJPEG(data)
+			if err != nil {
+				return nil, nil, mime, fmt.Errorf("%w %s in image message: %w", bridgev2.ErrUnsupportedMediaType, mime, err)
+			}
+			mime = "image/jpeg"
 		}
 	case event.MsgVideo:
 		switch mime {
@@ -454,14 +486,37 @@ func (mc *MessageConverter) reuploadFileToWhatsApp(
 		}
 		mediaType = whatsmeow.MediaVideo
 	case event.MsgAudio:
+		isVoice := content.MSC3245Voice != nil
 		switch mime {
-		case "audio/aac", "audio/mp4", "audio/amr", "audio/mpeg", "audio/ogg; codecs=opus":
-			// Allowed
+		case "audio/ogg; codecs=opus":
+			// Allowed, sent as a voice message if the Matrix event is one
 		case "audio/ogg":
 			// Hopefully it's opus already
 			mime = "audio/ogg; codecs=opus"
+		case "audio/aac", "audio/mp4", "audio/amr", "audio/mpeg":
+			if isVoice && ffmpeg.Supported() {
+				data, err = mc.convertAudioToOpus(ctx, data, mime)
+				if err != nil {
+					return nil, nil, mime, fmt.Errorf("%w (%s to opus): %w", bridgev2.ErrMediaConvertFailed, mime, err)
+				}
+				mime = "audio/ogg; codecs=opus"
+			}
+			// Otherwise sent as a regular audio file
 		default:
-			return nil, nil, mime, fmt.Errorf("%w %s in audio message", bridgev2.ErrUnsupportedMediaType, mime)
+			if !ffmpeg.Supported() {
+				return nil, nil, mime, fmt.Errorf("%w %s in audio message", bridgev2.ErrUnsupportedMediaType, mime)
+			}
+			data, err = mc.convertAudioToOpus(ctx, data, mime)
+			if err != nil {
+				return nil, nil, mime, fmt.Errorf("%w (%s to opus): %w", bridgev2.ErrMediaConvertFailed, mime, err)
+			}
+			mime = "audio/ogg; codecs=opus"
+		}
+		if mc.MaxFileSize > 0 && int64(len(data)) > mc.MaxFileSize {
+			return nil, nil, mime, ErrMediaTooLarge
+		}
+		if isVoice && mime == "audio/ogg; codecs=opus" && (content.MSC1767Audio == nil || len(content.MSC1767Audio.Waveform) == 0) {
+			mc.fillWaveform(ctx, content, data, mime)
 		}
 		mediaType = whatsmeow.MediaAudio
 	case event.MsgFile:
@@ -480,8 +535,14 @@ func (mc *MessageConverter) reuploadFileToWhatsApp(
 		return nil, nil, "", fmt.Errorf("%w: %w", bridgev2.ErrMediaReuploadFailed, err)
 	}
 	var thumbnail []byte
-	// Audio doesn't have thumbnails
-	if mediaType != whatsmeow.MediaAudio {
+	info := content.GetInfo()
+	if mediaType == whatsmeow.MediaVideo && info.ThumbnailURL == "" && info.ThumbnailFile == nil && ffmpeg.Supported() {
+		thumbnail, err = mc.extractVideoThumbnail(ctx, data, mime)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to extract thumbnail from video, sending without thumbnail")
+		}
+	} else if mediaType != whatsmeow.MediaAudio {
+		// Audio doesn't have thumbnails
 		thumbnail, err = mc.downloadThumbnail(ctx, data, content.GetInfo().ThumbnailURL, content.GetInfo().ThumbnailFile, isSticker)
 		// Ignore format errors for non-image files, we don't care about those thumbnails
 		if err != nil && (!errors.Is(err, image.ErrFormat) || mediaType == whatsmeow.MediaImage) {
@@ -509,6 +570,28 @@ func parseGeoURI(uri string) (lat, long float64, err error) {
 	return
 }
 
+// fillWaveform generates a waveform for voice messages sent by clients that don't include one.
+func (mc *MessageConverter) fillWaveform(ctx context.Context, content *event.MessageEventContent, data []byte, mime string) {
+	if !ffmpeg.Supported() {
+		return
+	}
+	waveform, duration, err := mc.generateWaveform(ctx, data, mime)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to generate waveform for voice message")
+		return
+	}
+	if content.MSC1767Audio == nil {
+		content.MSC1767Audio = &event.MSC1767Audio{}
+	}
+	content.MSC1767Audio.Waveform = waveform
+	if content.MSC1767Audio.Duration == 0 {
+		content.MSC1767Audio.Duration = duration
+	}
+	if content.Info != nil && content.Info.Duration == 0 {
+		content.Info.Duration = duration
+	}
+}
+
 func getAudioInfo(content *event.MessageEventContent) (output []byte, duration uint32) {
 	duration = uint32(content.Info.Duration / 1000)
 	audioInfo := content.MSC1767Audio
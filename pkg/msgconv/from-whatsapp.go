@@ -116,9 +116,13 @@ func (mc *MessageConverter) ToMatrix(
 	case waMsg.TemplateMessage != nil:
 		part, contextInfo = mc.convertTemplateMessage(ctx, info, waMsg.TemplateMessage)
 	case waMsg.HighlyStructuredMessage != nil:
-		part, contextInfo = mc.convertTemplateMessage(ctx, info, waMsg.HighlyStructuredMessage.GetHydratedHsm())
+		part, contextInfo = mc.ConvertHighlyStructuredMessage(ctx, info, waMsg.HighlyStructuredMessage)
 	case waMsg.TemplateButtonReplyMessage != nil:
 		part, contextInfo = mc.convertTemplateButtonReplyMessage(ctx, waMsg.TemplateButtonReplyMessage)
+	case waMsg.ButtonsMessage != nil:
+		part, contextInfo = mc.convertButtonsMessage(ctx, info, waMsg.ButtonsMessage)
+	case waMsg.ButtonsResponseMessage != nil:
+		part, contextInfo = mc.convertButtonsResponseMessage(ctx, waMsg.ButtonsResponseMessage)
 	case waMsg.ListMessage != nil:
 		part, contextInfo = mc.convertListMessage(ctx, waMsg.ListMessage)
 	case waMsg.ListResponseMessage != nil:
@@ -131,6 +135,8 @@ func (mc *MessageConverter) ToMatrix(
 		part, contextInfo = mc.convertPollCreationMessage(ctx, waMsg.PollCreationMessageV3)
 	case waMsg.PollUpdateMessage != nil:
 		part, contextInfo = mc.convertPollUpdateMessage(ctx, info, waMsg.PollUpdateMessage)
+	case waMsg.PollResultSnapshotMessage != nil:
+		part, contextInfo = mc.convertPollResultSnapshotMessage(ctx, info, waMsg.PollResultSnapshotMessage)
 	case waMsg.EventMessage != nil:
 		part, contextInfo = mc.convertEventMessage(ctx, waMsg.EventMessage)
 	case waMsg.ImageMessage != nil:
@@ -161,8 +167,16 @@ func (mc *MessageConverter) ToMatrix(
 		part, contextInfo = mc.convertPlaceholderMessage(ctx, waMsg)
 	case waMsg.GroupInviteMessage != nil:
 		part, contextInfo = mc.convertGroupInviteMessage(ctx, info, waMsg.GroupInviteMessage)
+	case waMsg.StickerPackMessage != nil:
+		part, contextInfo = mc.convertStickerPackMessage(ctx, waMsg.StickerPackMessage)
+	case waMsg.SendPaymentMessage != nil, waMsg.RequestPaymentMessage != nil,
+		waMsg.DeclinePaymentRequestMessage != nil, waMsg.CancelPaymentRequestMessage != nil,
+		waMsg.PaymentInviteMessage != nil:
+		part, contextInfo = mc.convertPaymentMessage(ctx, info, waMsg)
 	case waMsg.ProtocolMessage != nil && waMsg.ProtocolMessage.GetType() == waE2E.ProtocolMessage_EPHEMERAL_SETTING:
 		part, contextInfo = mc.convertEphemeralSettingMessage(ctx, waMsg.ProtocolMessage)
+	case waMsg.PinInChatMessage != nil:
+		part, contextInfo = mc.convertPinInChatMessage(ctx, info, waMsg)
 	default:
 		part, contextInfo = mc.convertUnknownMessage(ctx, waMsg)
 	}
@@ -173,6 +187,12 @@ func (mc *MessageConverter) ToMatrix(
 	}
 	dbMeta := part.DBMetadata.(*waid.MessageMetadata)
 	dbMeta.SenderDeviceID = info.Sender.Device
+	if info.Chat.Server == types.NewsletterServer {
+		dbMeta.NewsletterServerID = info.ServerID
+	}
+	if mc.StoreSearchText {
+		dbMeta.SearchText = part.Content.Body
+	}
 	if info.IsIncomingBroadcast() {
 		dbMeta.BroadcastListJID = &info.Chat
 		if part.Extra == nil {
@@ -187,12 +207,15 @@ func (mc *MessageConverter) ToMatrix(
 	}
 	if contextInfo.GetExpiration() > 0 {
 		cm.Disappear.Timer = time.Duration(contextInfo.GetExpiration()) * time.Second
-		cm.Disappear.Type = database.DisappearingTypeAfterRead
+		// WhatsApp's disappearing timer starts when the message is sent, not when it's read
+		cm.Disappear.Type = database.DisappearingTypeAfterSend
 		if portal.Disappear.Timer != cm.Disappear.Timer && portal.Metadata.(*waid.PortalMetadata).DisappearingTimerSetAt < contextInfo.GetEphemeralSettingTimestamp() {
 			portal.UpdateDisappearingSetting(ctx, cm.Disappear, intent, info.Timestamp, true, true)
 		}
 	}
-	if contextInfo.GetStanzaID() != "" {
+	if isStatusReply(contextInfo) {
+		mc.addStatusReplyQuote(ctx, contextInfo, part)
+	} else if contextInfo.GetStanzaID() != "" {
 		pcp, _ := types.ParseJID(contextInfo.GetParticipant())
 		chat, _ := types.ParseJID(contextInfo.GetRemoteJID())
 		if chat.IsEmpty() {
@@ -17,6 +17,9 @@
 package msgconv
 
 import (
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/format"
 
@@ -43,12 +46,20 @@ type MessageConverter struct {
 	DisableViewOnce       bool
 	DirectMedia           bool
 	OldMediaSuffix        string
+	StoreSearchText       bool
+	// Media larger than this is streamed through a temporary file instead of being buffered in memory
+	MediaStreamThreshold int64
+
+	mediaTransfers    *semaphore.Weighted
+	inFlightTransfers atomic.Int64
 }
 
 func New(br *bridgev2.Bridge) *MessageConverter {
 	mc := &MessageConverter{
 		Bridge:      br,
 		MaxFileSize: 50 * 1024 * 1024,
+
+		MediaStreamThreshold: uploadFileThreshold,
 	}
 	mc.HTMLParser = &format.HTMLParser{
 		PillConverter: mc.convertPill,
@@ -72,3 +83,18 @@ func New(br *bridgev2.Bridge) *MessageConverter {
 	}
 	return mc
 }
+
+// SetMediaConcurrency limits how many media files can be transferred from WhatsApp to Matrix at the same time.
+// Zero or a negative limit means there's no limit. This must be called before the converter is used.
+func (mc *MessageConverter) SetMediaConcurrency(limit int) {
+	if limit > 0 {
+		mc.mediaTransfers = semaphore.NewWeighted(int64(limit))
+	} else {
+		mc.mediaTransfers = nil
+	}
+}
+
+// InFlightMediaTransfers returns the number of media files currently being transferred from WhatsApp to Matrix.
+func (mc *MessageConverter) InFlightMediaTransfers() int64 {
+	return mc.inFlightTransfers.Load()
+}
@@ -25,6 +25,7 @@ import (
 	"image/png"
 
 	"github.com/rs/zerolog"
+	"go.mau.fi/util/ffmpeg"
 	"golang.org/x/image/draw"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
@@ -93,3 +94,12 @@ func (mc *MessageConverter) downloadThumbnail(ctx context.Context, original []by
 	}
 	return createThumbnail(original, png)
 }
+
+// extractVideoThumbnail uses ffmpeg to extract the first frame of a video and turns it into a thumbnail.
+func (mc *MessageConverter) extractVideoThumbnail(ctx context.Context, video []byte, mime string) ([]byte, error) {
+	frame, err := ffmpeg.ConvertBytes(ctx, video, ".jpg", nil, []string{"-frames:v", "1"}, mime)
+	if err != nil {
+		return nil, err
+	}
+	return createThumbnail(frame, false)
+}
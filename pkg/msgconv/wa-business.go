@@ -17,18 +17,140 @@
 package msgconv
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"html"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"go.mau.fi/util/random"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/format"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
 )
 
+var hsmPlaceholderRegex = regexp.MustCompile(`\{\{(\d+)\}\}`)
+
+// hsmParams returns the parameter values of a highly structured message.
+// Localizable params carry a default value preformatted by the sender, which is preferred over the raw param.
+func hsmParams(msg *waE2E.HighlyStructuredMessage) []string {
+	params := make([]string, len(msg.GetParams()))
+	copy(params, msg.GetParams())
+	for i, lp := range msg.GetLocalizableParams() {
+		def := lp.GetDefault()
+		if def == "" {
+			continue
+		} else if i < len(params) {
+			params[i] = def
+		} else {
+			params = append(params, def)
+		}
+	}
+	return params
+}
+
+// fillHSMPlaceholders replaces 1-indexed {{N}} placeholders with the corresponding parameter.
+func fillHSMPlaceholders(text string, params []string) string {
+	if len(params) == 0 || !strings.Contains(text, "{{") {
+		return text
+	}
+	return hsmPlaceholderRegex.ReplaceAllStringFunc(text, func(match string) string {
+		idx, err := strconv.Atoi(match[2 : len(match)-2])
+		if err != nil || idx < 1 || idx > len(params) {
+			return match
+		}
+		return params[idx-1]
+	})
+}
+
+// fillHSMTemplate fills the placeholders in the text fields of a hydrated template in place.
+// This must happen before the text is converted to HTML, so that the params get escaped like any other text.
+func fillHSMTemplate(tpl *waE2E.TemplateMessage_HydratedFourRowTemplate, params []string) {
+	if tpl == nil {
+		return
+	}
+	if tpl.HydratedContentText != nil {
+		tpl.HydratedContentText = proto.String(fillHSMPlaceholders(tpl.GetHydratedContentText(), params))
+	}
+	if tpl.HydratedFooterText != nil {
+		tpl.HydratedFooterText = proto.String(fillHSMPlaceholders(tpl.GetHydratedFooterText(), params))
+	}
+	if title, ok := tpl.GetTitle().(*waE2E.TemplateMessage_HydratedFourRowTemplate_HydratedTitleText); ok {
+		title.HydratedTitleText = fillHSMPlaceholders(title.HydratedTitleText, params)
+	}
+}
+
+func (mc *MessageConverter) ConvertHighlyStructuredMessage(ctx context.Context, info *types.MessageInfo, msg *waE2E.HighlyStructuredMessage) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
+	params := hsmParams(msg)
+	lang := cmp.Or(msg.GetDeterministicLg(), msg.GetFallbackLg())
+	if locale := cmp.Or(msg.GetDeterministicLc(), msg.GetFallbackLc()); locale != "" && lang != "" {
+		lang = fmt.Sprintf("%s_%s", lang, locale)
+	}
+
+	var converted *bridgev2.ConvertedMessagePart
+	var contextInfo *waE2E.ContextInfo
+	hsm := msg.GetHydratedHsm()
+	if hsm.GetHydratedTemplate() != nil || hsm.GetHydratedFourRowTemplate() != nil {
+		hsm = proto.Clone(hsm).(*waE2E.TemplateMessage)
+		fillHSMTemplate(hsm.GetHydratedTemplate(), params)
+		fillHSMTemplate(hsm.GetHydratedFourRowTemplate(), params)
+		converted, contextInfo = mc.convertTemplateMessage(ctx, info, hsm)
+	} else {
+		// The template couldn't be resolved, so fall back to describing it with the raw parameters.
+		// The parameters come from the sender, so they're escaped instead of being rendered as markdown.
+		var body, formattedBody strings.Builder
+		body.WriteString("Business message")
+		formattedBody.WriteString("Business message")
+		if msg.GetElementName() != "" {
+			_, _ = fmt.Fprintf(&body, " (template %s", msg.GetElementName())
+			_, _ = fmt.Fprintf(&formattedBody, " (template <code>%s</code>", html.EscapeString(msg.GetElementName()))
+			if lang != "" {
+				_, _ = fmt.Fprintf(&body, ", language %s", lang)
+				_, _ = fmt.Fprintf(&formattedBody, ", language <code>%s</code>", html.EscapeString(lang))
+			}
+			body.WriteString(")")
+			formattedBody.WriteString(")")
+		}
+		if len(params) > 0 {
+			body.WriteString("\n")
+			formattedBody.WriteString("<ul>")
+			for _, param := range params {
+				_, _ = fmt.Fprintf(&body, "\n* %s", param)
+				_, _ = fmt.Fprintf(&formattedBody, "<li>%s</li>", event.TextToHTML(param))
+			}
+			formattedBody.WriteString("</ul>")
+		}
+		converted = &bridgev2.ConvertedMessagePart{
+			Type: event.EventMessage,
+			Content: &event.MessageEventContent{
+				MsgType:       event.MsgText,
+				Body:          body.String(),
+				Format:        event.FormatHTML,
+				FormattedBody: formattedBody.String(),
+			},
+		}
+		contextInfo = hsm.GetContextInfo()
+	}
+
+	if converted.DBMetadata == nil {
+		converted.DBMetadata = &waid.MessageMetadata{}
+	}
+	converted.DBMetadata.(*waid.MessageMetadata).HSMTemplate = &waid.HSMTemplateMeta{
+		Namespace:   msg.GetNamespace(),
+		ElementName: msg.GetElementName(),
+		Params:      params,
+		Language:    lang,
+	}
+	return converted, contextInfo
+}
+
 func (mc *MessageConverter) convertTemplateMessage(ctx context.Context, info *types.MessageInfo, tplMsg *waE2E.TemplateMessage) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
 	converted := &bridgev2.ConvertedMessagePart{
 		Type: event.EventMessage,
@@ -88,27 +210,7 @@ func (mc *MessageConverter) convertTemplateMessage(ctx context.Context, info *ty
 	converted.Content.Body = content
 	mc.parseFormatting(converted.Content, true, false)
 	if convertedTitle != nil {
-		converted.Content = convertedTitle.Content
-		converted.Extra = convertedTitle.Extra
-		converted.DBMetadata = convertedTitle.DBMetadata
-		if content != "" {
-			if converted.Content.FileName == "" || converted.Content.FileName == converted.Content.Body {
-				converted.Content.FileName = converted.Content.Body
-				converted.Content.Body = ""
-			}
-			if converted.Content.Body != "" {
-				converted.Content.Body += "\n\n"
-			}
-			converted.Content.Body += content
-			contentHTML := parseWAFormattingToHTML(content, true)
-			if contentHTML != event.TextToHTML(content) || converted.Content.FormattedBody != "" {
-				converted.Content.EnsureHasHTML()
-				if converted.Content.FormattedBody != "" {
-					converted.Content.FormattedBody += "<br><br>"
-				}
-				converted.Content.FormattedBody += contentHTML
-			}
-		}
+		converted = mergeBusinessMediaHeader(convertedTitle, content)
 	}
 	if converted.Extra == nil {
 		converted.Extra = make(map[string]any)
@@ -117,6 +219,110 @@ func (mc *MessageConverter) convertTemplateMessage(ctx context.Context, info *ty
 	return converted, tplMsg.GetContextInfo()
 }
 
+// mergeBusinessMediaHeader uses a converted media header of a business message as the message itself,
+// with the text content of the business message appended as the caption.
+func mergeBusinessMediaHeader(header *bridgev2.ConvertedMessagePart, content string) *bridgev2.ConvertedMessagePart {
+	if content == "" {
+		return header
+	}
+	if header.Content.FileName == "" || header.Content.FileName == header.Content.Body {
+		header.Content.FileName = header.Content.Body
+		header.Content.Body = ""
+	}
+	if header.Content.Body != "" {
+		header.Content.Body += "\n\n"
+	}
+	header.Content.Body += content
+	contentHTML := parseWAFormattingToHTML(content, true)
+	if contentHTML != event.TextToHTML(content) || header.Content.FormattedBody != "" {
+		header.Content.EnsureHasHTML()
+		if header.Content.FormattedBody != "" {
+			header.Content.FormattedBody += "<br><br>"
+		}
+		header.Content.FormattedBody += contentHTML
+	}
+	return header
+}
+
+func (mc *MessageConverter) convertButtonsMessage(ctx context.Context, info *types.MessageInfo, msg *waE2E.ButtonsMessage) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
+	content := msg.GetContentText()
+	buttons := make([]map[string]any, 0, len(msg.GetButtons()))
+	if len(msg.GetButtons()) > 0 {
+		descriptions := make([]string, 0, len(msg.GetButtons()))
+		for _, button := range msg.GetButtons() {
+			if button.GetType() != waE2E.ButtonsMessage_Button_RESPONSE {
+				// Native flow buttons have no text to show and no way to be clicked outside the WhatsApp app
+				continue
+			}
+			descriptions = append(descriptions, fmt.Sprintf("<%s>", button.GetButtonText().GetDisplayText()))
+			buttons = append(buttons, map[string]any{
+				"id":   button.GetButtonID(),
+				"text": button.GetButtonText().GetDisplayText(),
+			})
+		}
+		if len(descriptions) > 0 {
+			content = fmt.Sprintf("%s\n\n%s\nUse the WhatsApp app to click buttons", content, strings.Join(descriptions, " - "))
+		}
+	}
+	if footer := msg.GetFooterText(); footer != "" {
+		content = fmt.Sprintf("%s\n\n%s", content, footer)
+	}
+
+	var convertedHeader *bridgev2.ConvertedMessagePart
+	switch header := msg.GetHeader().(type) {
+	case *waE2E.ButtonsMessage_DocumentMessage:
+		convertedHeader, _ = mc.convertMediaMessage(ctx, header.DocumentMessage, "file attachment", info, false, nil)
+	case *waE2E.ButtonsMessage_ImageMessage:
+		convertedHeader, _ = mc.convertMediaMessage(ctx, header.ImageMessage, "photo", info, false, nil)
+	case *waE2E.ButtonsMessage_VideoMessage:
+		convertedHeader, _ = mc.convertMediaMessage(ctx, header.VideoMessage, "video attachment", info, false, nil)
+	case *waE2E.ButtonsMessage_LocationMessage:
+		content = fmt.Sprintf("Unsupported location message\n\n%s", content)
+	case *waE2E.ButtonsMessage_Text:
+		if header.Text != "" {
+			content = fmt.Sprintf("%s\n\n%s", header.Text, content)
+		}
+	}
+
+	converted := &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			Body:    content,
+			MsgType: event.MsgText,
+		},
+	}
+	mc.parseFormatting(converted.Content, true, false)
+	if convertedHeader != nil {
+		converted = mergeBusinessMediaHeader(convertedHeader, content)
+	}
+	if converted.Extra == nil {
+		converted.Extra = make(map[string]any)
+	}
+	converted.Extra["fi.mau.whatsapp.buttons"] = buttons
+	return converted, msg.GetContextInfo()
+}
+
+// convertButtonsResponseMessage converts a tapped quick reply button. The context info of the response
+// points at the buttons message, so the result is bridged as a reply to it.
+func (mc *MessageConverter) convertButtonsResponseMessage(ctx context.Context, msg *waE2E.ButtonsResponseMessage) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
+	body := msg.GetSelectedDisplayText()
+	if body == "" {
+		body = "Unsupported buttons reply message"
+	}
+	return &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			Body:    body,
+			MsgType: event.MsgText,
+		},
+		Extra: map[string]any{
+			"fi.mau.whatsapp.buttons_reply": map[string]any{
+				"id": msg.GetSelectedButtonID(),
+			},
+		},
+	}, msg.GetContextInfo()
+}
+
 func (mc *MessageConverter) convertTemplateButtonReplyMessage(ctx context.Context, msg *waE2E.TemplateButtonReplyMessage) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
 	return &bridgev2.ConvertedMessagePart{
 		Type: event.EventMessage,
@@ -23,7 +23,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -60,7 +62,7 @@ func (mc *MessageConverter) convertMediaMessage(
 				MsgType: event.MsgNotice,
 				Body:    fmt.Sprintf("You received a view once %s. For added privacy, you can only open it on the WhatsApp app.", typeName),
 			},
-		}, nil
+		}, msg.GetContextInfo()
 	}
 	preparedMedia := prepareMediaMessage(msg)
 	preparedMedia.TypeDescription = typeName
@@ -69,6 +71,9 @@ func (mc *MessageConverter) convertMediaMessage(
 	}
 	contextInfo = preparedMedia.ContextInfo
 	if cachedPart != nil && msg.GetDirectPath() == "" {
+		if cachedPart.Content.FileName == "" {
+			cachedPart.Content.FileName = preparedMedia.FileName
+		}
 		cachedPart.Content.Body = preparedMedia.Body
 		cachedPart.Content.Format = preparedMedia.Format
 		cachedPart.Content.FormattedBody = preparedMedia.FormattedBody
@@ -204,6 +209,13 @@ type MediaMessageWithDuration interface {
 	GetSeconds() uint32
 }
 
+func pluralize(count uint32, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
+
 func prepareMediaMessage(rawMsg MediaMessage) *PreparedMedia {
 	extraInfo := map[string]any{}
 	data := &PreparedMedia{
@@ -222,6 +234,9 @@ func prepareMediaMessage(rawMsg MediaMessage) *PreparedMedia {
 	case *waE2E.DocumentMessage:
 		data.MsgType = event.MsgFile
 		data.FileName = msg.GetFileName()
+		if msg.GetPageCount() > 0 {
+			extraInfo["fi.mau.whatsapp.page_count"] = msg.GetPageCount()
+		}
 	case *waE2E.AudioMessage:
 		data.MsgType = event.MsgAudio
 		data.MSC1767Audio = &event.MSC1767Audio{
@@ -261,17 +276,29 @@ func prepareMediaMessage(rawMsg MediaMessage) *PreparedMedia {
 	}
 	if captionMsg, ok := rawMsg.(MediaMessageWithCaption); ok && captionMsg.GetCaption() != "" {
 		data.Body = captionMsg.GetCaption()
+	} else if docMsg, ok := rawMsg.(*waE2E.DocumentMessage); ok && docMsg.GetPageCount() > 0 && docMsg.GetMimetype() == "application/pdf" {
+		data.Body = fmt.Sprintf("📄 %s — %d %s", data.FileName, docMsg.GetPageCount(), pluralize(docMsg.GetPageCount(), "page", "pages"))
 	} else {
 		data.Body = data.FileName
 	}
 
 	data.Info.Size = int(rawMsg.GetFileLength())
 	data.Info.MimeType = rawMsg.GetMimetype()
+	if (data.Info.MimeType == "" || data.Info.MimeType == "application/octet-stream") && data.FileName != "" {
+		// WhatsApp clients sometimes send documents without a proper MIME type, so guess it from the extension.
+		if guessed := mime.TypeByExtension(filepath.Ext(data.FileName)); guessed != "" {
+			data.Info.MimeType = guessed
+		}
+	}
+	if data.FileName == "" && data.Body != "" {
+		// Make sure the caption isn't mistaken for the file name if the sender didn't include one
+		data.FillFileName()
+	}
 	data.ContextInfo = rawMsg.GetContextInfo()
 	return data
 }
 
-// TODO read this from config?
+// uploadFileThreshold is the default for MessageConverter.MediaStreamThreshold
 const uploadFileThreshold = 5 * 1024 * 1024
 
 func (mc *MessageConverter) MediaRetryToMatrix(
@@ -310,12 +337,27 @@ func (mc *MessageConverter) reuploadWhatsAppAttachment(
 	message whatsmeow.DownloadableMessage,
 	part *PreparedMedia,
 ) error {
+	if mc.MaxFileSize > 0 && int64(part.Info.Size) > mc.MaxFileSize {
+		return fmt.Errorf(
+			"%w: file is too large (%.2f MiB, the limit is %.2f MiB)",
+			bridgev2.ErrMediaReuploadFailed, float64(part.Info.Size)/1024/1024, float64(mc.MaxFileSize)/1024/1024,
+		)
+	}
+	if mc.mediaTransfers != nil {
+		err := mc.mediaTransfers.Acquire(ctx, 1)
+		if err != nil {
+			return fmt.Errorf("failed to wait for media transfer slot: %w", err)
+		}
+		defer mc.mediaTransfers.Release(1)
+	}
+	mc.inFlightTransfers.Add(1)
+	defer mc.inFlightTransfers.Add(-1)
 	client := getClient(ctx)
 	intent := getIntent(ctx)
 	portal := getPortal(ctx)
 	var thumbnailData []byte
 	var thumbnailInfo *event.FileInfo
-	if part.Info.Size > uploadFileThreshold {
+	if int64(part.Info.Size) > mc.MediaStreamThreshold {
 		var err error
 		part.URL, part.File, err = intent.UploadMediaStream(ctx, portal.MXID, -1, true, func(file io.Writer) (*bridgev2.FileStreamResult, error) {
 			err := client.DownloadToFile(message, file.(*os.File))
@@ -351,7 +393,7 @@ func (mc *MessageConverter) reuploadWhatsAppAttachment(
 				return err
 			}
 		}
-		if part.Info.MimeType == "" {
+		if part.Info.MimeType == "" || part.Info.MimeType == "application/octet-stream" {
 			part.Info.MimeType = http.DetectContentType(data)
 		}
 		part.FillFileName()
@@ -360,6 +402,21 @@ func (mc *MessageConverter) reuploadWhatsAppAttachment(
 			return fmt.Errorf("%w: %w", bridgev2.ErrMediaReuploadFailed, err)
 		}
 	}
+	if docMsg, ok := message.(*waE2E.DocumentMessage); ok && len(docMsg.GetJPEGThumbnail()) > 0 {
+		thumbnailData = docMsg.GetJPEGThumbnail()
+		thumbnailInfo = &event.FileInfo{
+			MimeType: "image/jpeg",
+			Width:    int(docMsg.GetThumbnailWidth()),
+			Height:   int(docMsg.GetThumbnailHeight()),
+			Size:     len(thumbnailData),
+		}
+		if thumbnailInfo.Width == 0 || thumbnailInfo.Height == 0 {
+			if cfg, _, err := image.DecodeConfig(bytes.NewReader(thumbnailData)); err == nil {
+				thumbnailInfo.Width = cfg.Width
+				thumbnailInfo.Height = cfg.Height
+			}
+		}
+	}
 	if thumbnailData != nil && thumbnailInfo != nil {
 		var err error
 		part.Info.ThumbnailURL, part.Info.ThumbnailFile, err = intent.UploadMedia(
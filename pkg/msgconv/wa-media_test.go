@@ -0,0 +1,109 @@
+package msgconv
+
+import (
+	"context"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/event"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+func TestCaptionedMediaReplyRoundTrip(t *testing.T) {
+	chat := types.JID{User: "120363000000000001", Server: types.GroupServer}
+	quotedSender := types.JID{User: "15550000001", Server: types.DefaultUserServer}
+	quotedID := types.MessageID("3EB0AAAAAAAAAAAA")
+	incomingContext := &waE2E.ContextInfo{
+		StanzaID:      proto.String(quotedID),
+		Participant:   proto.String(quotedSender.String()),
+		QuotedMessage: &waE2E.Message{Conversation: proto.String("original")},
+	}
+
+	tests := []struct {
+		name     string
+		msg      MediaMessage
+		msgType  event.MessageType
+		caption  string
+		fileName string
+	}{
+		{
+			name:    "Image",
+			msg:     &waE2E.ImageMessage{Caption: proto.String("look at this"), Mimetype: proto.String("image/jpeg"), ContextInfo: incomingContext},
+			msgType: event.MsgImage,
+			caption: "look at this",
+		},
+		{
+			name:    "Video",
+			msg:     &waE2E.VideoMessage{Caption: proto.String("a video"), Mimetype: proto.String("video/mp4"), ContextInfo: incomingContext},
+			msgType: event.MsgVideo,
+			caption: "a video",
+		},
+		{
+			name:     "Document",
+			msg:      &waE2E.DocumentMessage{Caption: proto.String("the report"), FileName: proto.String("report.pdf"), Mimetype: proto.String("application/pdf"), ContextInfo: incomingContext},
+			msgType:  event.MsgFile,
+			caption:  "the report",
+			fileName: "report.pdf",
+		},
+		{
+			name:    "DocumentWithoutFileName",
+			msg:     &waE2E.DocumentMessage{Caption: proto.String("unnamed file"), Mimetype: proto.String("application/pdf"), ContextInfo: incomingContext},
+			msgType: event.MsgFile,
+			caption: "unnamed file",
+		},
+	}
+
+	mc := New(nil)
+	portal := &bridgev2.Portal{Portal: &database.Portal{Metadata: &waid.PortalMetadata{}}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// WhatsApp -> Matrix
+			prepared := prepareMediaMessage(test.msg)
+			if prepared.MsgType != test.msgType {
+				t.Errorf("MsgType = %s, expected %s", prepared.MsgType, test.msgType)
+			}
+			if prepared.GetCaption() != test.caption {
+				t.Errorf("Matrix caption = %q, expected %q", prepared.GetCaption(), test.caption)
+			}
+			if test.fileName != "" && prepared.FileName != test.fileName {
+				t.Errorf("FileName = %q, expected %q", prepared.FileName, test.fileName)
+			}
+			if prepared.ContextInfo.GetStanzaID() != quotedID || prepared.ContextInfo.GetParticipant() != quotedSender.String() {
+				t.Errorf("reply info was lost: %+v", prepared.ContextInfo)
+			}
+
+			// Matrix -> WhatsApp
+			replyTo := &database.Message{ID: waid.MakeMessageID(chat, quotedSender, quotedID)}
+			contextInfo, err := mc.generateContextInfo(replyTo, portal)
+			if err != nil {
+				t.Fatalf("generateContextInfo returned error: %v", err)
+			}
+			out := mc.constructMediaMessage(context.Background(), prepared.MessageEventContent, &event.Event{}, &whatsmeow.UploadResponse{}, nil, contextInfo, prepared.Info.MimeType)
+			var caption string
+			var outContext *waE2E.ContextInfo
+			switch {
+			case out.GetImageMessage() != nil:
+				caption, outContext = out.GetImageMessage().GetCaption(), out.GetImageMessage().GetContextInfo()
+			case out.GetVideoMessage() != nil:
+				caption, outContext = out.GetVideoMessage().GetCaption(), out.GetVideoMessage().GetContextInfo()
+			case out.GetDocumentWithCaptionMessage() != nil:
+				doc := out.GetDocumentWithCaptionMessage().GetMessage().GetDocumentMessage()
+				caption, outContext = doc.GetCaption(), doc.GetContextInfo()
+			default:
+				t.Fatalf("unexpected WhatsApp message %v", out)
+			}
+			if caption != test.caption {
+				t.Errorf("WhatsApp caption = %q, expected %q", caption, test.caption)
+			}
+			if outContext.GetStanzaID() != quotedID || outContext.GetParticipant() != quotedSender.String() {
+				t.Errorf("WhatsApp reply info = %+v, expected a reply to %s from %s", outContext, quotedID, quotedSender)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@
 package msgconv
 
 import (
+	"cmp"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -72,10 +73,51 @@ func (mc *MessageConverter) convertPlaceholderMessage(ctx context.Context, rawMs
 	}
 }
 
-const inviteMsg = `%s<hr/>This invitation to join "%s" expires at %s. Reply to this message with <code>%s accept</code> to accept the invite.`
-const inviteMsgBroken = `%s<hr/>This invitation to join "%s" expires at %s. However, the invite message is broken or unsupported and cannot be accepted.`
+func (mc *MessageConverter) convertStickerPackMessage(ctx context.Context, msg *waE2E.StickerPackMessage) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
+	name := msg.GetName()
+	if name == "" {
+		name = "Unnamed sticker pack"
+	}
+	var html strings.Builder
+	if msg.GetCaption() != "" {
+		_, _ = fmt.Fprintf(&html, "%s<hr/>", event.TextToHTML(msg.GetCaption()))
+	}
+	_, _ = fmt.Fprintf(&html, "<p>Sticker pack <strong>%s</strong>", event.TextToHTML(name))
+	if msg.GetPublisher() != "" {
+		_, _ = fmt.Fprintf(&html, " by %s", event.TextToHTML(msg.GetPublisher()))
+	}
+	if count := len(msg.GetStickers()); count > 0 {
+		_, _ = fmt.Fprintf(&html, " (%d stickers)", count)
+	}
+	html.WriteString("</p>")
+	if msg.GetPackDescription() != "" {
+		_, _ = fmt.Fprintf(&html, "<blockquote>%s</blockquote>", event.TextToHTML(msg.GetPackDescription()))
+	}
+	html.WriteString("<p>Open the WhatsApp app to view and add the stickers.</p>")
+	extra := map[string]any{}
+	if msg.GetStickerPackID() != "" {
+		extra["fi.mau.whatsapp.sticker_pack_id"] = msg.GetStickerPackID()
+	}
+	return &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			MsgType:       event.MsgNotice,
+			Body:          format.HTMLToText(html.String()),
+			Format:        event.FormatHTML,
+			FormattedBody: html.String(),
+		},
+		Extra: extra,
+	}, msg.GetContextInfo()
+}
+
+const inviteMsg = `%s<hr/><p>%s invited you to join <strong>%s</strong>.</p><p>The invitation expires at %s. Reply to this message with <code>%s accept</code> or react with %s to accept the invite.</p>`
+const inviteMsgExpired = `%s<hr/><p>%s invited you to join <strong>%s</strong>.</p><p>This invitation expired at %s and can no longer be accepted.</p>`
+const inviteMsgBroken = `%s<hr/><p>%s invited you to join <strong>%s</strong>.</p><p>The invitation expires at %s. However, the invite message is broken or unsupported and cannot be accepted.</p>`
 const GroupInviteMetaField = "fi.mau.whatsapp.invite"
 
+// GroupInviteAcceptReaction is the reaction emoji that can be used on a group invite message to accept it.
+const GroupInviteAcceptReaction = "✅"
+
 func (mc *MessageConverter) convertGroupInviteMessage(ctx context.Context, info *types.MessageInfo, msg *waE2E.GroupInviteMessage) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
 	expiry := time.Unix(msg.GetInviteExpiration(), 0)
 	template := inviteMsg
@@ -91,18 +133,49 @@ func (mc *MessageConverter) convertGroupInviteMessage(ctx context.Context, info
 			Code:       msg.GetInviteCode(),
 			Expiration: msg.GetInviteExpiration(),
 			Inviter:    info.Sender.ToNonAD(),
+			GroupName:  msg.GetGroupName(),
+
+			IsCommunity: msg.GetGroupType() == waE2E.GroupInviteMessage_PARENT,
 		}
 		extraAttrs = map[string]any{
 			GroupInviteMetaField: inviteMeta,
 		}
+		if inviteMeta.IsExpired() {
+			template = inviteMsgExpired
+		}
+	}
+	inviterMXID, inviterName, err := mc.getBasicUserInfo(ctx, waid.MakeUserID(info.Sender.ToNonAD()))
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get group invite sender info")
+	}
+	if inviterName == "" {
+		inviterName = info.PushName
+	}
+	if inviterName == "" {
+		inviterName = "+" + info.Sender.User
 	}
+	inviterHTML := event.TextToHTML(inviterName)
+	if inviterMXID != "" {
+		inviterHTML = fmt.Sprintf(`<a href="%s">%s</a>`, inviterMXID.URI().MatrixToURL(), inviterHTML)
+	}
+	groupName := event.TextToHTML(msg.GetGroupName())
+	if msg.GetGroupType() == waE2E.GroupInviteMessage_PARENT {
+		groupName = "the community " + groupName
+	}
+	formattedExpiry := expiry.UTC().Format("2006-01-02 15:04 MST")
 
-	htmlMessage := fmt.Sprintf(template, event.TextToHTML(msg.GetCaption()), msg.GetGroupName(), expiry, mc.Bridge.Config.CommandPrefix)
+	var htmlMessage string
+	if template == inviteMsg {
+		htmlMessage = fmt.Sprintf(template, event.TextToHTML(msg.GetCaption()), inviterHTML, groupName, formattedExpiry, mc.Bridge.Config.CommandPrefix, GroupInviteAcceptReaction)
+	} else {
+		htmlMessage = fmt.Sprintf(template, event.TextToHTML(msg.GetCaption()), inviterHTML, groupName, formattedExpiry)
+	}
 	content := &event.MessageEventContent{
 		MsgType:       event.MsgText,
 		Body:          format.HTMLToText(htmlMessage),
 		Format:        event.FormatHTML,
 		FormattedBody: htmlMessage,
+		Mentions:      &event.Mentions{},
 	}
 	return &bridgev2.ConvertedMessagePart{
 		Type:    event.EventMessage,
@@ -118,7 +191,7 @@ func (mc *MessageConverter) convertEphemeralSettingMessage(ctx context.Context,
 	portal := getPortal(ctx)
 	portalMeta := portal.Metadata.(*waid.PortalMetadata)
 	disappear := database.DisappearingSetting{
-		Type:  database.DisappearingTypeAfterRead,
+		Type:  database.DisappearingTypeAfterSend,
 		Timer: time.Duration(msg.GetEphemeralExpiration()) * time.Second,
 	}
 	if disappear.Timer == 0 {
@@ -143,6 +216,51 @@ func (mc *MessageConverter) convertEphemeralSettingMessage(ctx context.Context,
 	}, nil
 }
 
+func (mc *MessageConverter) convertPinInChatMessage(ctx context.Context, info *types.MessageInfo, rawMsg *waE2E.Message) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
+	msg := rawMsg.GetPinInChatMessage()
+	portal := getPortal(ctx)
+	var action string
+	switch msg.GetType() {
+	case waE2E.PinInChatMessage_PIN_FOR_ALL:
+		action = "pinned"
+	case waE2E.PinInChatMessage_UNPIN_FOR_ALL:
+		action = "unpinned"
+	default:
+		return mc.convertUnknownMessage(ctx, rawMsg)
+	}
+	_, senderName, err := mc.getBasicUserInfo(ctx, waid.MakeUserID(info.Sender.ToNonAD()))
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get pin sender info")
+	}
+	senderName = cmp.Or(senderName, info.PushName, "+"+info.Sender.User)
+	content := &event.MessageEventContent{
+		MsgType: event.MsgNotice,
+		Body:    fmt.Sprintf("%s %s a message", senderName, action),
+	}
+	targetID := KeyToMessageID(getClient(ctx), info.Chat, info.Sender, msg.GetKey())
+	target, err := mc.Bridge.DB.Message.GetFirstPartByID(ctx, portal.Receiver, targetID)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("target_id", string(targetID)).Msg("Failed to get pinned message from database")
+	} else if target != nil && portal.MXID != "" {
+		targetURL := portal.MXID.EventURI(target.MXID, mc.Bridge.Matrix.ServerName()).MatrixToURL()
+		content.Format = event.FormatHTML
+		content.FormattedBody = fmt.Sprintf(`%s %s <a href="%s">a message</a>`, event.TextToHTML(senderName), action, targetURL)
+		content.Body += ": " + targetURL
+	}
+	if duration := rawMsg.GetMessageContextInfo().GetMessageAddOnDurationInSecs(); duration > 0 && action == "pinned" {
+		expiry := info.Timestamp.Add(time.Duration(duration) * time.Second)
+		suffix := fmt.Sprintf(" (until %s)", expiry.UTC().Format("2006-01-02 15:04 MST"))
+		content.Body += suffix
+		if content.FormattedBody != "" {
+			content.FormattedBody += suffix
+		}
+	}
+	return &bridgev2.ConvertedMessagePart{
+		Type:    event.EventMessage,
+		Content: content,
+	}, nil
+}
+
 const eventMessageTemplate = `
 {{- if .Name -}}
 	<h4>{{ .Name }}</h4>
@@ -0,0 +1,181 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2024 Tulir Asokan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package msgconv
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/event"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+func formatPaymentAmount(value int64, offset uint32, currency string) string {
+	amount := float64(value) / math.Pow10(int(offset))
+	return fmt.Sprintf("%s %s", strconv.FormatFloat(amount, 'f', -1, 64), currency)
+}
+
+func getPaymentNote(note *waE2E.Message) string {
+	if note.GetExtendedTextMessage() != nil {
+		return note.GetExtendedTextMessage().GetText()
+	}
+	return note.GetConversation()
+}
+
+const paymentDisclaimer = "Payments can't be sent, accepted or declined from Matrix, please use the WhatsApp app."
+
+// obfuscatePaymentUser hides all but the last few digits of a phone number,
+// so that payment notices don't leak identifiers of the other party.
+func obfuscatePaymentUser(jid string) string {
+	parsed, err := types.ParseJID(jid)
+	if err != nil || parsed.User == "" {
+		return "someone"
+	}
+	user := parsed.User
+	if len(user) <= 4 {
+		return "+" + strings.Repeat("•", len(user))
+	}
+	return "+" + strings.Repeat("•", len(user)-4) + user[len(user)-4:]
+}
+
+func (mc *MessageConverter) convertPaymentMessage(ctx context.Context, info *types.MessageInfo, msg *waE2E.Message) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
+	_, senderName, err := mc.getBasicUserInfo(ctx, waid.MakeUserID(info.Sender))
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get payment sender info")
+	}
+	if senderName == "" {
+		senderName = info.PushName
+	}
+	var body, note string
+	var contextInfo *waE2E.ContextInfo
+	paymentInfo := map[string]any{}
+	switch {
+	case msg.SendPaymentMessage != nil:
+		paymentInfo["type"] = "send"
+		body = fmt.Sprintf("💸 %s sent a payment via WhatsApp Pay", senderName)
+		if msg.SendPaymentMessage.GetRequestMessageKey() != nil {
+			body += " in response to a payment request"
+		}
+		note = getPaymentNote(msg.SendPaymentMessage.GetNoteMessage())
+		contextInfo = msg.SendPaymentMessage.GetNoteMessage().GetExtendedTextMessage().GetContextInfo()
+	case msg.RequestPaymentMessage != nil:
+		req := msg.RequestPaymentMessage
+		amount := formatPaymentAmount(int64(req.GetAmount1000()), 3, req.GetCurrencyCodeIso4217())
+		if req.GetAmount().GetValue() != 0 {
+			amount = formatPaymentAmount(req.GetAmount().GetValue(), req.GetAmount().GetOffset(), req.GetAmount().GetCurrencyCode())
+		}
+		paymentInfo["type"] = "request"
+		paymentInfo["amount"] = amount
+		body = fmt.Sprintf("💸 %s requested %s via WhatsApp Pay", senderName, amount)
+		if req.GetRequestFrom() != "" {
+			body += " from " + obfuscatePaymentUser(req.GetRequestFrom())
+		}
+		if req.GetExpiryTimestamp() > 0 {
+			body += fmt.Sprintf(" (expires %s)", time.Unix(req.GetExpiryTimestamp(), 0).UTC().Format("2006-01-02 15:04 MST"))
+		}
+		note = getPaymentNote(req.GetNoteMessage())
+		contextInfo = req.GetNoteMessage().GetExtendedTextMessage().GetContextInfo()
+	case msg.DeclinePaymentRequestMessage != nil:
+		paymentInfo["type"] = "decline"
+		body = fmt.Sprintf("💸 %s declined a WhatsApp Pay request", senderName)
+	case msg.CancelPaymentRequestMessage != nil:
+		paymentInfo["type"] = "cancel"
+		body = fmt.Sprintf("💸 %s cancelled a WhatsApp Pay request", senderName)
+	case msg.PaymentInviteMessage != nil:
+		paymentInfo["type"] = "invite"
+		body = fmt.Sprintf("💸 %s invited you to use WhatsApp Pay", senderName)
+	default:
+		return mc.convertUnknownMessage(ctx, msg)
+	}
+	if note != "" {
+		body = fmt.Sprintf("%s — %s", body, note)
+	}
+	return &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    fmt.Sprintf("%s\n\n%s", body, paymentDisclaimer),
+		},
+		Extra: map[string]any{
+			"fi.mau.whatsapp.payment": paymentInfo,
+		},
+	}, contextInfo
+}
+
+var paymentStatusNames = map[waWeb.PaymentInfo_Status]string{
+	waWeb.PaymentInfo_PROCESSING:         "processing",
+	waWeb.PaymentInfo_SENT:               "sent",
+	waWeb.PaymentInfo_NEED_TO_ACCEPT:     "waiting to be accepted",
+	waWeb.PaymentInfo_COMPLETE:           "completed",
+	waWeb.PaymentInfo_COULD_NOT_COMPLETE: "failed",
+	waWeb.PaymentInfo_REFUNDED:           "refunded",
+	waWeb.PaymentInfo_EXPIRED:            "expired",
+	waWeb.PaymentInfo_REJECTED:           "rejected",
+	waWeb.PaymentInfo_CANCELLED:          "cancelled",
+	waWeb.PaymentInfo_WAITING_FOR_PAYER:  "waiting for payer",
+	waWeb.PaymentInfo_WAITING:            "waiting",
+}
+
+func paymentInfoAmount(payInfo *waWeb.PaymentInfo) string {
+	if payInfo.GetPrimaryAmount().GetValue() != 0 {
+		return formatPaymentAmount(payInfo.GetPrimaryAmount().GetValue(), payInfo.GetPrimaryAmount().GetOffset(), payInfo.GetPrimaryAmount().GetCurrencyCode())
+	} else if payInfo.GetAmount1000() != 0 && payInfo.GetCurrency() != "" {
+		return formatPaymentAmount(int64(payInfo.GetAmount1000()), 3, payInfo.GetCurrency())
+	}
+	return ""
+}
+
+// ApplyPaymentInfo adds the amount and status from the payment info of a history sync message
+// to a payment notice created by ToMatrix. Live messages don't carry the payment info, so this
+// is only possible for messages that come through history sync.
+func ApplyPaymentInfo(part *bridgev2.ConvertedMessagePart, payInfo *waWeb.PaymentInfo) bool {
+	if payInfo == nil || part == nil {
+		return false
+	}
+	paymentInfo, ok := part.Extra["fi.mau.whatsapp.payment"].(map[string]any)
+	if !ok {
+		return false
+	}
+	body := strings.TrimSuffix(part.Content.Body, "\n\n"+paymentDisclaimer)
+	if amount := paymentInfoAmount(payInfo); amount != "" && paymentInfo["amount"] == nil {
+		paymentInfo["amount"] = amount
+		if paymentInfo["type"] == "send" {
+			body = strings.Replace(body, " sent a payment via", fmt.Sprintf(" sent %s via", amount), 1)
+		}
+	}
+	status := paymentStatusNames[payInfo.GetStatus()]
+	if status != "" {
+		paymentInfo["status"] = status
+		body = fmt.Sprintf("%s\n\nStatus: %s", body, status)
+		if part.DBMetadata == nil {
+			part.DBMetadata = &waid.MessageMetadata{}
+		}
+		part.DBMetadata.(*waid.MessageMetadata).PaymentStatus = status
+	}
+	part.Content.Body = fmt.Sprintf("%s\n\n%s", body, paymentDisclaimer)
+	return true
+}
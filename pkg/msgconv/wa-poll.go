@@ -108,6 +108,9 @@ func KeyToMessageID(client *whatsmeow.Client, chat, sender types.JID, key *waCom
 			if sender.Server == types.LegacyUserServer {
 				sender.Server = types.DefaultUserServer
 			}
+		} else if chat.Server == types.NewsletterServer {
+			// Newsletter posts are always sent by the newsletter itself, e.g. when an admin deletes a post
+			sender = chat
 		} else if chat.Server == types.DefaultUserServer {
 			ownID := ptr.Val(client.Store.ID).ToNonAD()
 			if sender.User == ownID.User {
@@ -191,3 +194,58 @@ func (mc *MessageConverter) convertPollUpdateMessage(ctx context.Context, info *
 		},
 	}, nil
 }
+
+var eventUnstablePollEnd = event.Type{Type: "org.matrix.msc3381.poll.end", Class: event.MessageEventType}
+
+// convertPollResultSnapshotMessage converts the final results WhatsApp sends when a poll is closed.
+// If the original poll was bridged as an extensible event poll, this becomes a poll end event.
+func (mc *MessageConverter) convertPollResultSnapshotMessage(ctx context.Context, info *types.MessageInfo, msg *waE2E.PollResultSnapshotMessage) (*bridgev2.ConvertedMessagePart, *waE2E.ContextInfo) {
+	results := make([]map[string]any, len(msg.GetPollVotes()))
+	resultsText := make([]string, len(results))
+	resultsHTML := make([]string, len(results))
+	for i, vote := range msg.GetPollVotes() {
+		results[i] = map[string]any{
+			"option_name": vote.GetOptionName(),
+			"vote_count":  vote.GetOptionVoteCount(),
+		}
+		resultsText[i] = fmt.Sprintf("%d. %s: %d votes", i+1, vote.GetOptionName(), vote.GetOptionVoteCount())
+		resultsHTML[i] = fmt.Sprintf("<li>%s: %d votes</li>", event.TextToHTML(vote.GetOptionName()), vote.GetOptionVoteCount())
+	}
+	body := fmt.Sprintf("The poll %s has ended. Final results:\n\n%s", msg.GetName(), strings.Join(resultsText, "\n"))
+	formattedBody := fmt.Sprintf("<p>The poll <strong>%s</strong> has ended. Final results:</p><ol>%s</ol>", event.TextToHTML(msg.GetName()), strings.Join(resultsHTML, ""))
+	part := &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			MsgType:       event.MsgNotice,
+			Body:          body,
+			Format:        event.FormatHTML,
+			FormattedBody: formattedBody,
+		},
+		Extra: map[string]any{
+			"fi.mau.whatsapp.poll_results": results,
+		},
+	}
+	contextInfo := msg.GetContextInfo()
+	if !mc.ExtEvPolls || contextInfo.GetStanzaID() == "" {
+		return part, contextInfo
+	}
+	sender, _ := types.ParseJID(contextInfo.GetParticipant())
+	pollMessageID := waid.MakeMessageID(info.Chat, sender, contextInfo.GetStanzaID())
+	pollMessage, err := mc.Bridge.DB.Message.GetPartByID(ctx, getPortal(ctx).Receiver, pollMessageID, "")
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to get poll for result snapshot")
+		return part, contextInfo
+	} else if pollMessage == nil {
+		zerolog.Ctx(ctx).Debug().Str("poll_id", string(pollMessageID)).Msg("Poll for result snapshot not found")
+		return part, contextInfo
+	}
+	part.Type = eventUnstablePollEnd
+	part.Content.RelatesTo = &event.RelatesTo{
+		Type:    event.RelReference,
+		EventID: pollMessage.MXID,
+	}
+	part.Extra["org.matrix.msc3381.poll.end"] = map[string]any{}
+	part.Extra["org.matrix.msc1767.text"] = body
+	// The poll is referenced directly, so don't return the context info to avoid adding a reply relation.
+	return part, nil
+}
@@ -0,0 +1,131 @@
+// mautrix-whatsapp - A Matrix-WhatsApp puppeting bridge.
+// Copyright (C) 2024 Tulir Asokan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package msgconv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"go.mau.fi/mautrix-whatsapp/pkg/waid"
+)
+
+func isStatusReply(contextInfo *waE2E.ContextInfo) bool {
+	return contextInfo.GetStanzaID() != "" && contextInfo.GetRemoteJID() == types.StatusBroadcastJID.String()
+}
+
+// addStatusReplyQuote prepends a quote of the status that a message is replying to.
+// Status replies arrive in DMs, so they can't be bridged as normal Matrix replies.
+func (mc *MessageConverter) addStatusReplyQuote(ctx context.Context, contextInfo *waE2E.ContextInfo, part *bridgev2.ConvertedMessagePart) {
+	log := zerolog.Ctx(ctx)
+	portal := getPortal(ctx)
+	quoted := contextInfo.GetQuotedMessage()
+	var text, mimeType string
+	var thumbnail []byte
+	switch {
+	case quoted.GetImageMessage() != nil:
+		text = quoted.GetImageMessage().GetCaption()
+		thumbnail = quoted.GetImageMessage().GetJPEGThumbnail()
+		mimeType = "image"
+	case quoted.GetVideoMessage() != nil:
+		text = quoted.GetVideoMessage().GetCaption()
+		thumbnail = quoted.GetVideoMessage().GetJPEGThumbnail()
+		mimeType = "video"
+	case quoted.GetExtendedTextMessage() != nil:
+		text = quoted.GetExtendedTextMessage().GetText()
+	default:
+		text = quoted.GetConversation()
+	}
+
+	statusSender, _ := types.ParseJID(contextInfo.GetParticipant())
+	statusMsgID := waid.MakeMessageID(types.StatusBroadcastJID, statusSender, contextInfo.GetStanzaID())
+	var statusURL string
+	statusMsg, err := mc.Bridge.DB.Message.GetFirstPartByID(ctx, portal.Receiver, statusMsgID)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get replied-to status message from database")
+	} else if statusMsg != nil {
+		statusPortal, err := mc.Bridge.GetExistingPortalByKey(ctx, statusMsg.Room)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to get status broadcast portal")
+		} else if statusPortal != nil && statusPortal.MXID != "" {
+			statusURL = statusPortal.MXID.EventURI(statusMsg.MXID, mc.Bridge.Matrix.ServerName()).MatrixToURL()
+		}
+	}
+
+	var thumbnailURL id.ContentURIString
+	if len(thumbnail) > 0 {
+		var file *event.EncryptedFileInfo
+		thumbnailURL, file, err = getIntent(ctx).UploadMedia(ctx, portal.MXID, thumbnail, "status-thumbnail.jpg", "image/jpeg")
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to upload status reply thumbnail")
+		} else if file != nil {
+			// Encrypted files can't be displayed inline
+			thumbnailURL = ""
+		}
+	}
+
+	statusLink := "status"
+	if statusURL != "" {
+		statusLink = fmt.Sprintf(`<a href="%s">status</a>`, statusURL)
+	}
+	if mimeType != "" {
+		statusLink = fmt.Sprintf("%s (%s)", statusLink, mimeType)
+	}
+	var quoteHTML strings.Builder
+	_, _ = fmt.Fprintf(&quoteHTML, "<blockquote><p>Replying to %s</p>", statusLink)
+	if thumbnailURL != "" {
+		_, _ = fmt.Fprintf(&quoteHTML, `<img src="%s" alt="Status thumbnail" height="96"/>`, thumbnailURL)
+	}
+	if text != "" {
+		_, _ = fmt.Fprintf(&quoteHTML, "<p>%s</p>", event.TextToHTML(text))
+	}
+	quoteHTML.WriteString("</blockquote>")
+	quoteText := "> Replying to status"
+	if text != "" {
+		quoteText += ":\n> " + strings.ReplaceAll(text, "\n", "\n> ")
+	}
+
+	if part.Extra == nil {
+		part.Extra = map[string]any{}
+	}
+	statusInfo := map[string]any{"id": statusMsgID}
+	if statusMsg != nil {
+		statusInfo["event_id"] = statusMsg.MXID
+	}
+	part.Extra["fi.mau.whatsapp.status_reply"] = statusInfo
+
+	content := part.Content
+	switch content.MsgType {
+	case event.MsgText, event.MsgNotice, event.MsgEmote:
+	default:
+		// Media messages use the body as the caption, which shouldn't be mixed with the quote.
+		return
+	}
+	if content.Format != event.FormatHTML {
+		content.Format = event.FormatHTML
+		content.FormattedBody = event.TextToHTML(content.Body)
+	}
+	content.FormattedBody = quoteHTML.String() + content.FormattedBody
+	content.Body = quoteText + "\n\n" + content.Body
+}
@@ -20,11 +20,13 @@ import (
 	"crypto/ecdh"
 	"crypto/rand"
 	"encoding/json"
+	"time"
 
 	"go.mau.fi/util/exerrors"
 	"go.mau.fi/util/jsontime"
 	"go.mau.fi/util/random"
 	"go.mau.fi/whatsmeow/types"
+	"maunium.net/go/mautrix/id"
 )
 
 type UserLoginMetadata struct {
@@ -35,9 +37,38 @@ type UserLoginMetadata struct {
 	PushKeys        *PushKeys     `json:"push_keys,omitempty"`
 	APNSEncPubKey   []byte        `json:"apns_enc_pubkey,omitempty"`
 	APNSEncPrivKey  []byte        `json:"apns_enc_privkey,omitempty"`
+	About           string        `json:"about,omitempty"`
 
-	HistorySyncPortalsNeedCreating bool          `json:"history_sync_portals_need_creating,omitempty"`
-	LastHistorySync                jsontime.Unix `json:"last_history_sync,omitempty"`
+	DefaultDisappearingTimer      uint32 `json:"default_disappearing_timer,omitempty"`
+	DefaultDisappearingTimerSetAt int64  `json:"default_disappearing_timer_set_at,omitempty"`
+
+	HistorySyncPortalsNeedCreating bool               `json:"history_sync_portals_need_creating,omitempty"`
+	LastHistorySync                jsontime.Unix      `json:"last_history_sync,omitempty"`
+	HistorySyncCursor              *HistorySyncCursor `json:"history_sync_cursor,omitempty"`
+}
+
+// HistorySyncCursor records the last history sync chunk that was fully stored,
+// so that an interrupted sync can be resumed without reprocessing earlier chunks.
+type HistorySyncCursor struct {
+	SyncType   string        `json:"sync_type"`
+	ChunkOrder uint32        `json:"chunk_order"`
+	Progress   uint32        `json:"progress"`
+	UpdatedAt  jsontime.Unix `json:"updated_at"`
+}
+
+// HistorySyncCursorMaxAge is how long an unfinished sync is considered to be in progress after its last chunk.
+// Syncs that stop before reaching 100% are abandoned after this, so they don't block later syncs forever.
+const HistorySyncCursorMaxAge = 3 * 24 * time.Hour
+
+// InProgress returns true if the cursor points at a sync of the given type that hasn't finished yet.
+func (hsc *HistorySyncCursor) InProgress(syncType string) bool {
+	return hsc != nil && hsc.SyncType == syncType && hsc.Progress < 100 &&
+		time.Since(hsc.UpdatedAt.Time) < HistorySyncCursorMaxAge
+}
+
+// Covers returns true if the given chunk was already stored as part of the in-progress sync.
+func (hsc *HistorySyncCursor) Covers(syncType string, chunkOrder uint32) bool {
+	return hsc.InProgress(syncType) && chunkOrder != 0 && chunkOrder <= hsc.ChunkOrder
 }
 
 type PushKeys struct {
@@ -68,6 +99,22 @@ type GroupInviteMeta struct {
 	Code       string    `json:"code"`
 	Expiration int64     `json:"expiration,string"`
 	Inviter    types.JID `json:"inviter"`
+	GroupName  string    `json:"group_name,omitempty"`
+	// IsCommunity is set for invites to a community (parent group) rather than a normal group.
+	IsCommunity bool `json:"is_community,omitempty"`
+}
+
+func (gim *GroupInviteMeta) IsExpired() bool {
+	return gim.Expiration > 0 && time.Now().Unix() > gim.Expiration
+}
+
+// HSMTemplateMeta stores the template name and parameters of a WhatsApp business
+// highly structured message, so the original template can be inspected later.
+type HSMTemplateMeta struct {
+	Namespace   string   `json:"namespace,omitempty"`
+	ElementName string   `json:"element_name,omitempty"`
+	Params      []string `json:"params,omitempty"`
+	Language    string   `json:"language,omitempty"`
 }
 
 type MessageMetadata struct {
@@ -78,6 +125,25 @@ type MessageMetadata struct {
 	FailedMediaMeta  json.RawMessage  `json:"media_meta,omitempty"`
 	DirectMediaMeta  json.RawMessage  `json:"direct_media_meta,omitempty"`
 	IsMatrixPoll     bool             `json:"is_matrix_poll,omitempty"`
+	HSMTemplate      *HSMTemplateMeta `json:"hsm_template,omitempty"`
+	// Server-assigned ID of newsletter posts, which is separate from the message ID used in the message key
+	NewsletterServerID types.MessageServerID `json:"newsletter_server_id,omitempty"`
+	// ID of the revoke message sent when the message was deleted from Matrix
+	RevokeID string `json:"revoke_id,omitempty"`
+	// Plain text of the message, only stored if message search is enabled
+	SearchText string `json:"search_text,omitempty"`
+	// Last known status of a WhatsApp Pay message, used to avoid re-editing unchanged payment notices
+	PaymentStatus string `json:"payment_status,omitempty"`
+
+	DeliveredAt *jsontime.Unix `json:"delivered_at,omitempty"`
+	ReadAt      *jsontime.Unix `json:"read_at,omitempty"`
+	// Per-recipient receipts of outgoing group messages, keyed by the recipient's phone number
+	Receipts map[string]*MessageReceipt `json:"receipts,omitempty"`
+}
+
+type MessageReceipt struct {
+	DeliveredAt *jsontime.Unix `json:"delivered_at,omitempty"`
+	ReadAt      *jsontime.Unix `json:"read_at,omitempty"`
 }
 
 type ReactionMetadata struct {
@@ -87,8 +153,30 @@ type ReactionMetadata struct {
 type PortalMetadata struct {
 	DisappearingTimerSetAt int64         `json:"disappearing_timer_set_at,omitempty"`
 	LastSync               jsontime.Unix `json:"last_sync,omitempty"`
+	SubscriberCount        int           `json:"subscriber_count,omitempty"`
+	NewsletterRole         string        `json:"newsletter_role,omitempty"`
+	// Whether the user requested encryption with the set-encryption command,
+	// and the room where encryption was last enabled.
+	Encrypted       bool      `json:"encrypted,omitempty"`
+	EncryptedRoomID id.RoomID `json:"encrypted_room_id,omitempty"`
+	// The group settings that affect power levels, used to skip no-op power level updates.
+	GroupSettingsKnown    bool `json:"group_settings_known,omitempty"`
+	GroupAnnounce         bool `json:"group_announce,omitempty"`
+	GroupLocked           bool `json:"group_locked,omitempty"`
+	CommunityAnnouncement bool `json:"community_announcement,omitempty"`
+	// Per-portal overrides set with the portal-settings command.
+	RelayDisabled       bool `json:"relay_disabled,omitempty"`
+	BackfillDisabled    bool `json:"backfill_disabled,omitempty"`
+	MaxBackfillMessages int  `json:"max_backfill_messages,omitempty"`
+	// ID of the current group topic, used to ignore repeated topic change notifications
+	TopicID string `json:"topic_id,omitempty"`
+	// The chat category last sent in the fi.mau.whatsapp.chat_category state event
+	ChatCategory string `json:"chat_category,omitempty"`
 }
 
 type GhostMetadata struct {
 	LastSync jsontime.Unix `json:"last_sync,omitempty"`
+	About    string        `json:"about,omitempty"`
+	// Verified WhatsApp Business name, only fetched in background syncs
+	VerifiedName string `json:"verified_name,omitempty"`
 }